@@ -1,49 +1,323 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/jsandas/bedrock-server/internal/audit"
+	"github.com/jsandas/bedrock-server/internal/checks"
 	"github.com/jsandas/bedrock-server/internal/config"
+	"github.com/jsandas/bedrock-server/internal/consolelog"
+	"github.com/jsandas/bedrock-server/internal/discord"
 	"github.com/jsandas/bedrock-server/internal/downloader"
+	"github.com/jsandas/bedrock-server/internal/events"
+	"github.com/jsandas/bedrock-server/internal/logfile"
+	"github.com/jsandas/bedrock-server/internal/mccli"
+	"github.com/jsandas/bedrock-server/internal/restart"
 	"github.com/jsandas/bedrock-server/internal/runner"
+	"github.com/jsandas/bedrock-server/internal/scheduler"
 	"github.com/jsandas/bedrock-server/internal/server"
+	"github.com/jsandas/bedrock-server/internal/updater"
+	"github.com/jsandas/bedrock-server/internal/watchdog"
+	"github.com/jsandas/bedrock-server/internal/webhook"
 )
 
+// version is the wrapper version, set at build time with
+// -ldflags "-X main.version=..."
+var version = "dev"
+
 var (
 	command       = flag.String("command", "./bedrock_server", "command to execute (used for debugging purposes)")
-	listenAddress = flag.String("listen", ":8080", "address for the web server")
+	listenAddress = flag.String("listen", ":8080", "address for the web server (empty to only serve the control socket)")
 	appDir        = flag.String("app-dir", "", "directory containing the minecraft server (defaults to current directory)")
 	mcVersion     = flag.String("mc-version", "", "Minecraft version to download (if not already present)")
+	mcChannel     = flag.String("mc-channel", downloader.ChannelRelease, "Bedrock server channel to install and update from: release or preview")
 	authKey       = flag.String("auth-key", "", "pre-shared key for authentication (recommended to use AUTH_KEY env var instead)")
+	bufferSize    = flag.Int("output-buffer", server.DefaultBufferSize, "number of output lines kept in memory for replay to reconnecting clients")
+
+	downloadSources = flag.String("download-sources", "", "comma separated mirrors tried in order: http(s):// or file:// base URLs, directories or server zips (default minecraft.net)")
+	downloadProxy   = flag.String("download-proxy", "", "HTTP proxy for downloads (default HTTP_PROXY/HTTPS_PROXY)")
+	downloadNoProxy = flag.String("download-no-proxy", "", "comma separated hosts or .domains downloaded from without the proxy")
+	downloadTimeout = flag.Duration("download-timeout", 30*time.Minute, "limit for downloading a server version across all sources (0 for none)")
+
+	oidcIssuer       = flag.String("oidc-issuer", "", "OpenID Connect issuer URL, enables single sign-on for the web console")
+	oidcClientID     = flag.String("oidc-client-id", "", "OpenID Connect client id")
+	oidcClientSecret = flag.String("oidc-client-secret", "", "OpenID Connect client secret (recommended to use OIDC_CLIENT_SECRET env var instead)")
+	oidcRedirectURL  = flag.String("oidc-redirect-url", "", "OpenID Connect redirect URL, e.g. https://console.example.com/auth/callback")
+	oidcScopes       = flag.String("oidc-scopes", "openid,email,profile", "comma separated OpenID Connect scopes")
+	oidcGroupsClaim  = flag.String("oidc-groups-claim", "groups", "ID token claim holding group membership")
+	oidcAdminGroups  = flag.String("oidc-admin-groups", "", "comma separated groups granted the admin role")
+	oidcAdminEmails  = flag.String("oidc-admin-emails", "", "comma separated emails granted the admin role")
+	oidcViewerGroups = flag.String("oidc-viewer-groups", "", "comma separated groups granted the read-only viewer role")
+	oidcViewerEmails = flag.String("oidc-viewer-emails", "", "comma separated emails granted the read-only viewer role")
+
+	tlsCert       = flag.String("tls-cert", "", "TLS certificate file for the web server, reloaded when it changes")
+	tlsKey        = flag.String("tls-key", "", "TLS private key file for the web server")
+	tlsSelfSigned = flag.Bool("tls-self-signed", false, "serve the web server over TLS with a generated self-signed certificate")
+	tlsClientCA   = flag.String("tls-client-ca", "", "CA bundle for authenticating automation clients with mTLS")
+
+	allowedOrigins  = flag.String("allowed-origins", "", "comma separated origins allowed to open WebSocket connections (default same-origin only, * allows any)")
+	authMaxFailures = flag.Int("auth-max-failures", 5, "failed authentication attempts from one address before it is locked out")
+	authLockout     = flag.Duration("auth-lockout", 15*time.Minute, "how long an address is locked out after repeated failed authentication")
+	rateLimit       = flag.Int("rate-limit", 600, "requests per minute allowed from one address (0 disables the limit)")
+	trustedProxies  = flag.String("trusted-proxies", "", "comma separated proxy addresses or CIDR ranges whose X-Forwarded-For header is trusted")
+
+	auditLog        = flag.String("audit-log", "", "file to record every console command in (disabled when empty)")
+	auditMaxSize    = flag.Int("audit-max-size", 10, "size in megabytes at which the audit log is rotated")
+	auditMaxBackups = flag.Int("audit-max-backups", 5, "number of rotated audit logs to keep")
+
+	controlSocket     = flag.String("control-socket", "", "Unix socket serving the API without an auth key, access is controlled by its file permissions")
+	controlSocketMode = flag.String("control-socket-mode", "0660", "file permissions of the control socket")
+
+	scheduleFile = flag.String("schedule-file", "", "file to persist scheduled announcements in (scheduler disabled when empty)")
+
+	restartSchedule   = flag.String("restart-schedule", "", "daily restart time (HH:MM) or cron expression, in the container's time zone (disabled when empty)")
+	restartWhenOnline = flag.String("restart-when-online", restart.PolicyRestart, "what a scheduled restart does while players are online: restart, skip or wait")
+	restartMaxWait    = flag.Duration("restart-max-wait", time.Hour, "how long a waiting restart waits for players to leave before skipping (0 waits indefinitely)")
+	stopTimeout       = flag.Duration("stop-timeout", runner.DefaultStopTimeout, "how long to wait for the server to stop before killing it")
+
+	processGroup = flag.Bool("process-group", false, "run the server in a process group of its own so stray children are killed with it")
+	rlimitNoFile = flag.String("rlimit-nofile", "", "open files limit for the server: a number or unlimited (default inherited)")
+	rlimitCore   = flag.String("rlimit-core", "", "core dump size limit for the server in bytes: a number or unlimited, 0 disables core dumps (default inherited)")
+	nice         = flag.Int("nice", 0, "CPU scheduling priority of the server, -20 (highest) to 19")
+	ioniceClass  = flag.String("ionice-class", "", "I/O scheduling class of the server: realtime, best-effort or idle (default inherited)")
+	ioniceLevel  = flag.Int("ionice-level", 0, "I/O priority of the server within its class, 0 (highest) to 7")
+	pty          = flag.Bool("pty", false, "run the server on a pseudo-terminal instead of pipes, as when started interactively")
+	maxLineLen   = flag.Int("max-line-length", runner.DefaultMaxLineLength, "longest server output line in bytes, longer lines are split")
+
+	memoryLimit        = flag.Int("memory-limit", 0, "server memory use in megabytes that triggers a graceful restart (disabled when 0)")
+	memoryWarn         = flag.Int("memory-warn", 0, "server memory use in megabytes that logs a warning (default 90% of the limit)")
+	memoryRestartDelay = flag.Duration("memory-restart-delay", watchdog.DefaultDelay, "notice players get before a restart to free memory (0 restarts immediately)")
+
+	autoUpdate         = flag.Bool("auto-update", false, "install new Bedrock server versions as they are published")
+	autoUpdateInterval = flag.Duration("auto-update-interval", updater.DefaultInterval, "how often to check for a new Bedrock server version")
+	autoUpdateWindow   = flag.String("auto-update-window", "", "daily maintenance window (HH:MM-HH:MM) updates may run in with players online")
+	updateReadyTimeout = flag.Duration("update-ready-timeout", updater.DefaultReadyTimeout, "how long an updated server has to start before it is rolled back")
+	updateBackupDir    = flag.String("update-backup-dir", "", "where backups taken before updates are kept (default <app-dir>/backups)")
+	versionCache       = flag.String("version-cache", "", "where downloaded server versions are kept for switching and rollback (default <app-dir>/versions)")
+	versionCacheKeep   = flag.Int("version-cache-keep", 5, "server versions kept in the version cache (0 keeps all)")
+
+	webhookURLs        = flag.String("webhook-urls", "", "comma separated URLs events are POSTed to (disabled when empty)")
+	webhookSecret      = flag.String("webhook-secret", "", "key webhook payloads are signed with (recommended to use WEBHOOK_SECRET env var instead)")
+	webhookEvents      = flag.String("webhook-events", "", "comma separated event types to send to webhooks (default all)")
+	webhookMaxAttempts = flag.Int("webhook-max-attempts", webhook.DefaultMaxAttempts, "delivery attempts before a webhook payload is dead-lettered")
+	webhookDeadLetter  = flag.String("webhook-dead-letter", "", "file recording webhook deliveries that failed (disabled when empty)")
+
+	discordWebhookURL = flag.String("discord-webhook-url", "", "Discord channel webhook server and player events are posted to")
+	discordBotToken   = flag.String("discord-bot-token", "", "Discord bot token for the chat bridge (recommended to use DISCORD_BOT_TOKEN env var instead)")
+	discordChannelID  = flag.String("discord-channel-id", "", "Discord channel the bot posts to and bridges chat with")
+	discordBridge     = flag.Bool("discord-chat-bridge", false, "relay chat between the game and the Discord channel")
+	discordRelay      = flag.String("discord-relay", scheduler.KindTellraw, "command showing Discord messages in game: tellraw or say")
+	discordAPIURL     = flag.String("discord-api-url", discord.DefaultAPIURL, "base URL of the Discord API")
+
+	logDir        = flag.String("log-dir", "", "directory to persist console output in (disabled when empty)")
+	logMaxSize    = flag.Int("log-max-size", 20, "size in megabytes at which the console log is rotated and compressed")
+	logMaxBackups = flag.Int("log-max-backups", 10, "number of rotated console logs to keep")
 )
 
+// notifyDrainTimeout bounds how long the wrapper waits for queued webhook
+// and Discord notifications when the server exits
+const notifyDrainTimeout = 30 * time.Second
+
+// envFlags maps environment variables to the flags they set
+var envFlags = map[string]string{
+	"LISTEN_ADDRESS":       "listen",
+	"APP_DIR":              "app-dir",
+	"MINECRAFT_VER":        "mc-version",
+	"MINECRAFT_CHANNEL":    "mc-channel",
+	"DOWNLOAD_SOURCES":     "download-sources",
+	"DOWNLOAD_PROXY":       "download-proxy",
+	"DOWNLOAD_NO_PROXY":    "download-no-proxy",
+	"DOWNLOAD_TIMEOUT":     "download-timeout",
+	"AUTH_KEY":             "auth-key",
+	"OUTPUT_BUFFER_SIZE":   "output-buffer",
+	"OIDC_ISSUER":          "oidc-issuer",
+	"OIDC_CLIENT_ID":       "oidc-client-id",
+	"OIDC_CLIENT_SECRET":   "oidc-client-secret",
+	"OIDC_REDIRECT_URL":    "oidc-redirect-url",
+	"OIDC_SCOPES":          "oidc-scopes",
+	"OIDC_GROUPS_CLAIM":    "oidc-groups-claim",
+	"OIDC_ADMIN_GROUPS":    "oidc-admin-groups",
+	"OIDC_ADMIN_EMAILS":    "oidc-admin-emails",
+	"OIDC_VIEWER_GROUPS":   "oidc-viewer-groups",
+	"OIDC_VIEWER_EMAILS":   "oidc-viewer-emails",
+	"TLS_CERT_FILE":        "tls-cert",
+	"TLS_KEY_FILE":         "tls-key",
+	"TLS_SELF_SIGNED":      "tls-self-signed",
+	"TLS_CLIENT_CA_FILE":   "tls-client-ca",
+	"ALLOWED_ORIGINS":      "allowed-origins",
+	"AUTH_MAX_FAILURES":    "auth-max-failures",
+	"AUTH_LOCKOUT":         "auth-lockout",
+	"RATE_LIMIT":           "rate-limit",
+	"TRUSTED_PROXIES":      "trusted-proxies",
+	"AUDIT_LOG":            "audit-log",
+	"AUDIT_MAX_SIZE":       "audit-max-size",
+	"AUDIT_MAX_BACKUPS":    "audit-max-backups",
+	"CONTROL_SOCKET":       "control-socket",
+	"CONTROL_SOCKET_MODE":  "control-socket-mode",
+	"SCHEDULE_FILE":        "schedule-file",
+	"RESTART_SCHEDULE":     "restart-schedule",
+	"RESTART_WHEN_ONLINE":  "restart-when-online",
+	"RESTART_MAX_WAIT":     "restart-max-wait",
+	"STOP_TIMEOUT":         "stop-timeout",
+	"PROCESS_GROUP":        "process-group",
+	"RLIMIT_NOFILE":        "rlimit-nofile",
+	"RLIMIT_CORE":          "rlimit-core",
+	"NICE":                 "nice",
+	"IONICE_CLASS":         "ionice-class",
+	"IONICE_LEVEL":         "ionice-level",
+	"PTY":                  "pty",
+	"MAX_LINE_LENGTH":      "max-line-length",
+	"MEMORY_LIMIT":         "memory-limit",
+	"MEMORY_WARN":          "memory-warn",
+	"MEMORY_RESTART_DELAY": "memory-restart-delay",
+	"AUTO_UPDATE":          "auto-update",
+	"AUTO_UPDATE_INTERVAL": "auto-update-interval",
+	"AUTO_UPDATE_WINDOW":   "auto-update-window",
+	"UPDATE_READY_TIMEOUT": "update-ready-timeout",
+	"UPDATE_BACKUP_DIR":    "update-backup-dir",
+	"VERSION_CACHE":        "version-cache",
+	"VERSION_CACHE_KEEP":   "version-cache-keep",
+	"WEBHOOK_URLS":         "webhook-urls",
+	"WEBHOOK_SECRET":       "webhook-secret",
+	"WEBHOOK_EVENTS":       "webhook-events",
+	"WEBHOOK_MAX_ATTEMPTS": "webhook-max-attempts",
+	"WEBHOOK_DEAD_LETTER":  "webhook-dead-letter",
+	"DISCORD_WEBHOOK_URL":  "discord-webhook-url",
+	"DISCORD_BOT_TOKEN":    "discord-bot-token",
+	"DISCORD_CHANNEL_ID":   "discord-channel-id",
+	"DISCORD_CHAT_BRIDGE":  "discord-chat-bridge",
+	"DISCORD_RELAY":        "discord-relay",
+	"DISCORD_API_URL":      "discord-api-url",
+	"LOG_DIR":              "log-dir",
+	"LOG_MAX_SIZE":         "log-max-size",
+	"LOG_MAX_BACKUPS":      "log-max-backups",
+}
+
 func init() {
 	// Set defaults from environment variables if present
-	if envListenAddress := os.Getenv("LISTEN_ADDRESS"); envListenAddress != "" {
-		flag.Set("listen", envListenAddress)
+	for env, name := range envFlags {
+		if value := os.Getenv(env); value != "" {
+			flag.Set(name, value)
+		}
+	}
+}
+
+// subcommands are client tools run instead of the server
+var subcommands = map[string]func(args []string) int{
+	"mccli":          mccli.Run,
+	"check-versions": checks.RunVersions,
+	"check-server":   checks.RunServer,
+	"versions":       mccli.RunVersions,
+	// Names used by the old mccli script
+	"check_versions": checks.RunVersions,
+	"check_server":   checks.RunServer,
+}
+
+// runSubcommand runs a subcommand named by the first argument or by the
+// name the binary was invoked as, e.g. through a /usr/local/bin/mccli symlink
+func runSubcommand() (int, bool) {
+	if run, ok := subcommands[filepath.Base(os.Args[0])]; ok {
+		return run(os.Args[1:]), true
 	}
-	if envAppDir := os.Getenv("APP_DIR"); envAppDir != "" {
-		flag.Set("app-dir", envAppDir)
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			return run(os.Args[2:]), true
+		}
 	}
-	if envMcVer := os.Getenv("MINECRAFT_VER"); envMcVer != "" {
-		flag.Set("mc-version", envMcVer)
+	return 0, false
+}
+
+// installServer downloads MINECRAFT_VER into the version cache, reporting
+// progress in the console, and installs it, extracting the zip as it
+// arrives. SIGTERM aborts the download.
+func installServer(srv *server.Server, cache *downloader.Cache, channel, workDir, installed string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	srv.Log("Downloading Minecraft server %s version %s...", channel, *mcVersion)
+	err := cache.Install(ctx, *mcVersion, downloader.FetchOptions{
+		Sources: *downloadSources,
+		Channel: channel,
+		Timeout: *downloadTimeout,
+		Progress: func(p downloader.Progress) {
+			srv.SetDownload(p)
+			switch p.State {
+			case downloader.StateDownloading:
+				srv.Log("Downloading %s", p)
+			case downloader.StateDone:
+				srv.Log("Downloaded %s", p)
+			}
+		},
+	}, workDir, installed != "")
+	if err != nil {
+		srv.SetDownload(downloader.Progress{Version: *mcVersion, State: downloader.StateFailed, Error: err.Error()})
+		return fmt.Errorf("error installing server: %v", err)
 	}
-	if envAuthKey := os.Getenv("AUTH_KEY"); envAuthKey != "" {
-		flag.Set("auth-key", envAuthKey)
+	cache.Prune(*mcVersion, installed)
+	return nil
+}
+
+// oidcConfig builds the single sign-on settings from flags
+func oidcConfig() server.OIDCConfig {
+	return server.OIDCConfig{
+		IssuerURL:    *oidcIssuer,
+		ClientID:     *oidcClientID,
+		ClientSecret: *oidcClientSecret,
+		RedirectURL:  *oidcRedirectURL,
+		Scopes:       splitList(*oidcScopes),
+		GroupsClaim:  *oidcGroupsClaim,
+		AdminGroups:  splitList(*oidcAdminGroups),
+		AdminEmails:  splitList(*oidcAdminEmails),
+		ViewerGroups: splitList(*oidcViewerGroups),
+		ViewerEmails: splitList(*oidcViewerEmails),
+	}
+}
+
+// splitList splits a comma separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func main() {
+	if code, ok := runSubcommand(); ok {
+		os.Exit(code)
 	}
 
 	flag.Parse()
 
-	// Ensure we have an auth key
-	if *authKey == "" {
+	// Ensure the web server has an auth key unless single sign-on is configured
+	if *listenAddress != "" && *authKey == "" && !oidcConfig().Enabled() {
 		fmt.Fprintf(os.Stderr, "Error: Authentication key is required. Set it using the AUTH_KEY environment variable or --auth-key flag\n")
 		os.Exit(1)
 	}
-}
 
-func main() {
+	if err := oidcConfig().Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v. Set OIDC_ADMIN_GROUPS, OIDC_ADMIN_EMAILS, OIDC_VIEWER_GROUPS or OIDC_VIEWER_EMAILS\n", err)
+		os.Exit(1)
+	}
+
+	proxies, err := server.ParseTrustedProxies(*trustedProxies)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	os.Setenv("LD_LIBRARY_PATH", ".")
 
 	// Check if EULA_ACCEPT is set to true
@@ -67,10 +341,278 @@ func main() {
 		}
 	}
 
-	// Download server if version is specified
-	if *mcVersion != "" {
-		fmt.Printf("Downloading Minecraft server version %s...\n", *mcVersion)
-		if err := downloader.DownloadMinecraftServer(*mcVersion, workDir, ""); err != nil {
+	if err := downloader.SetProxy(*downloadProxy, *downloadNoProxy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error configuring download proxy: %v\n", err)
+		os.Exit(1)
+	}
+
+	// A preview is kept apart from release installs and downloads
+	channel, err := downloader.ParseChannel(*mcChannel)
+	if err == nil {
+		err = downloader.ClaimChannel(workDir, channel)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Downloads are cached so versions can be switched without the network
+	if *versionCache == "" {
+		*versionCache = filepath.Join(workDir, "versions")
+	}
+	if channel == downloader.ChannelPreview {
+		*versionCache = filepath.Join(*versionCache, channel)
+	}
+	cache := downloader.NewCache(*versionCache, *versionCacheKeep)
+
+	// Create command runner, supervised so it can be restarted. It starts once
+	// the server is installed.
+	cmdRunner := runner.NewSupervisor(*command)
+	cmdRunner.Options = runner.Options{
+		ProcessGroup:  *processGroup,
+		Nice:          *nice,
+		IOClass:       *ioniceClass,
+		IOLevel:       *ioniceLevel,
+		PTY:           *pty,
+		MaxLineLength: *maxLineLen,
+		Limits:        runner.Limits{NoFile: *rlimitNoFile, Core: *rlimitCore},
+	}
+	if err := cmdRunner.Options.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Open the command audit log
+	var auditLogger *audit.Logger
+	if *auditLog != "" {
+		var err error
+		auditLogger, err = audit.New(*auditLog, logfile.Options{
+			MaxSize:    int64(*auditMaxSize) * 1024 * 1024,
+			MaxBackups: *auditMaxBackups,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening audit log: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Open the persistent console log
+	var consoleLog *consolelog.Log
+	if *logDir != "" {
+		var err error
+		consoleLog, err = consolelog.Open(*logDir, logfile.Options{
+			MaxSize:    int64(*logMaxSize) * 1024 * 1024,
+			MaxBackups: *logMaxBackups,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening console log: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Load the announcement scheduler, it only sends while the server is running
+	var srv *server.Server
+	var announcer *scheduler.Scheduler
+	if *scheduleFile != "" {
+		var err error
+		announcer, err = scheduler.New(scheduler.Options{
+			Path:  *scheduleFile,
+			Send:  func(command string) { srv.SendAs("system:scheduler", command) },
+			Ready: func() bool { return srv.Status().State == server.StateRunning },
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading announcement schedule: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// The updater also switches versions on request through the API
+	upd, err := updater.New(updater.Options{
+		AppDir:       workDir,
+		BackupDir:    *updateBackupDir,
+		Channel:      channel,
+		Sources:      *downloadSources,
+		Cache:        cache,
+		FetchTimeout: *downloadTimeout,
+		Interval:     *autoUpdateInterval,
+		Window:       *autoUpdateWindow,
+		ReadyTimeout: *updateReadyTimeout,
+		StopTimeout:  *stopTimeout,
+		Process:      cmdRunner,
+		Players:      func() int { return len(srv.Players()) },
+		Ready:        func() bool { return srv.Status().State == server.StateRunning },
+		Send:         func(command string) { srv.SendAs("system:update", command) },
+		Emit:         func(event events.Event) { srv.Emit(event) },
+		Log:          func(format string, args ...interface{}) { srv.Log(format, args...) },
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error configuring auto-update: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Create and start HTTP server
+	srv = server.New(server.ServerConfig{
+		Runner:     cmdRunner,
+		AuthKey:    *authKey,
+		OIDC:       oidcConfig(),
+		BufferSize: *bufferSize,
+		Channel:    channel,
+		AppDir:     workDir,
+		TLS: server.TLSConfig{
+			CertFile:     *tlsCert,
+			KeyFile:      *tlsKey,
+			SelfSigned:   *tlsSelfSigned,
+			ClientCAFile: *tlsClientCA,
+		},
+		AllowedOrigins:  splitList(*allowedOrigins),
+		AuthMaxFailures: *authMaxFailures,
+		AuthLockout:     *authLockout,
+		RateLimit:       *rateLimit,
+		TrustedProxies:  proxies,
+		Audit:           auditLogger,
+		ConsoleLog:      consoleLog,
+		Scheduler:       announcer,
+		Versions:        upd,
+		WrapperVersion:  version,
+	})
+	if announcer != nil {
+		announcer.Start()
+	}
+	cmdRunner.OnRestart = func() {
+		srv.Emit(events.Event{Type: events.ServerStarting, Message: "server restarting"})
+	}
+
+	// Send events to webhooks until the server exits. They subscribe before
+	// the server starts so no events are missed.
+	var notifiers sync.WaitGroup
+	if urls := splitList(*webhookURLs); len(urls) > 0 {
+		var types []events.Type
+		for _, t := range splitList(*webhookEvents) {
+			types = append(types, events.Type(t))
+		}
+		dispatcher, err := webhook.New(webhook.Options{
+			URLs:        urls,
+			Secret:      *webhookSecret,
+			Events:      types,
+			MaxAttempts: *webhookMaxAttempts,
+			DeadLetter:  *webhookDeadLetter,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring webhooks: %v\n", err)
+			os.Exit(1)
+		}
+		sub := srv.SubscribeEvents()
+		notifiers.Add(1)
+		go func() {
+			defer notifiers.Done()
+			dispatcher.Run(sub.C())
+		}()
+	}
+
+	// Post events to Discord and bridge chat
+	if *discordWebhookURL != "" || *discordBotToken != "" {
+		bot, err := discord.New(discord.Options{
+			APIURL:     *discordAPIURL,
+			WebhookURL: *discordWebhookURL,
+			BotToken:   *discordBotToken,
+			ChannelID:  *discordChannelID,
+			Bridge:     *discordBridge,
+			Relay:      *discordRelay,
+			Send:       func(user, command string) { srv.SendAs("discord:"+user, command) },
+			Ready:      func() bool { return srv.Status().State == server.StateRunning },
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring Discord: %v\n", err)
+			os.Exit(1)
+		}
+		bot.Start()
+		sub := srv.SubscribeEvents()
+		notifiers.Add(1)
+		go func() {
+			defer notifiers.Done()
+			bot.Run(sub.C())
+		}()
+	}
+
+	// Schedule restarts, warning players in game beforehand
+	if *restartSchedule != "" {
+		restarter, err := restart.New(restart.Options{
+			Schedule:          *restartSchedule,
+			WhenPlayersOnline: *restartWhenOnline,
+			MaxWait:           *restartMaxWait,
+			Send:              srv.Sender("system:restart"),
+			Players:           func() int { return len(srv.Players()) },
+			Ready:             func() bool { return srv.Status().State == server.StateRunning },
+			Restart:           func() error { return cmdRunner.Restart(*stopTimeout) },
+			Log:               srv.Log,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring scheduled restarts: %v\n", err)
+			os.Exit(1)
+		}
+		restarter.Start()
+	}
+
+	// Restart the server gracefully when its memory use grows too large
+	if *memoryLimit > 0 {
+		restartDelay := *memoryRestartDelay
+		if restartDelay <= 0 {
+			restartDelay = watchdog.NoDelay
+		}
+		memoryWatchdog, err := watchdog.New(watchdog.Options{
+			Limit:   int64(*memoryLimit) * 1024 * 1024,
+			Warn:    int64(*memoryWarn) * 1024 * 1024,
+			Delay:   restartDelay,
+			Pid:     cmdRunner.Pid,
+			Send:    srv.Sender("system:watchdog"),
+			Restart: func() error { return cmdRunner.Restart(*stopTimeout) },
+			Log:     srv.Log,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error configuring memory watchdog: %v\n", err)
+			os.Exit(1)
+		}
+		memoryWatchdog.Start()
+	}
+	if *listenAddress != "" {
+		go func() {
+			if err := srv.Start(*listenAddress); err != nil {
+				fmt.Fprintf(os.Stderr, "Error starting web server: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Start the local control socket
+	if *controlSocket != "" {
+		mode, err := strconv.ParseUint(*controlSocketMode, 8, 32)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing control socket mode %q: %v\n", *controlSocketMode, err)
+			os.Exit(1)
+		}
+		go func() {
+			if err := srv.StartSocket(*controlSocket, os.FileMode(mode)); err != nil {
+				fmt.Fprintf(os.Stderr, "Error starting control socket: %v\n", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	// Download server if version is specified and not already installed.
+	// A newer version installed by the updater and a version pinned by
+	// switching or rolling back are kept. The web server is already up so
+	// the progress can be followed.
+	installed := downloader.InstalledVersion(workDir)
+	switch {
+	case *mcVersion == "":
+	case installed == *mcVersion:
+		fmt.Printf("Minecraft server version %s is installed\n", installed)
+	case installed != "" && downloader.PinnedVersion(workDir) == installed:
+		fmt.Printf("Keeping pinned Minecraft server version %s\n", installed)
+	case *autoUpdate && installed != "" && downloader.CompareVersions(installed, *mcVersion) > 0:
+		fmt.Printf("Keeping updated Minecraft server version %s\n", installed)
+	default:
+		if err := installServer(srv, cache, channel, workDir, installed); err != nil {
 			fmt.Fprintf(os.Stderr, "Error downloading server: %v\n", err)
 			os.Exit(1)
 		}
@@ -82,29 +624,33 @@ func main() {
 		os.Exit(1)
 	}
 
-	// Create command runner
-	cmdRunner := runner.New(*command)
-
 	// Start the command
 	if err := cmdRunner.Start(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error starting command: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Create and start HTTP server
-	srv := server.New(server.ServerConfig{
-		Runner:  cmdRunner,
-		AuthKey: *authKey,
-	})
+	// Install new versions as they are published
+	if *autoUpdate {
+		upd.Start()
+	}
+
+	// Wait for the command to complete
+	err = cmdRunner.Wait()
+
+	// Give notifications a chance to report the exit
+	notified := make(chan struct{})
 	go func() {
-		if err := srv.Start(*listenAddress); err != nil {
-			fmt.Fprintf(os.Stderr, "Error starting web server: %v\n", err)
-			os.Exit(1)
-		}
+		notifiers.Wait()
+		close(notified)
 	}()
+	select {
+	case <-notified:
+	case <-time.After(notifyDrainTimeout):
+		fmt.Printf("Timed out sending notifications\n")
+	}
 
-	// Wait for the command to complete
-	if err := cmdRunner.Wait(); err != nil {
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error running command: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/logfile"
+)
+
+// maxEntryLength is the longest entry read back, longer ones are skipped
+const maxEntryLength = 16 << 20
+
+// Entry is a single audited console command
+type Entry struct {
+	Time       time.Time `json:"time"`
+	User       string    `json:"user"`
+	Method     string    `json:"method"` // How the user authenticated (key, oidc, mtls, ...)
+	RemoteAddr string    `json:"remote_addr"`
+	Command    string    `json:"command"`
+	Denied     bool      `json:"denied,omitempty"` // Command was rejected and never reached the server
+}
+
+// Filter selects entries when querying the audit log
+type Filter struct {
+	User    string    // Exact user match
+	Command string    // Case-insensitive substring of the command
+	Since   time.Time // Entries at or after this time
+	Until   time.Time // Entries before this time
+	Limit   int       // Return at most the newest Limit entries, 0 for all
+}
+
+// Logger writes audit entries as JSON lines to a rotated file
+type Logger struct {
+	file *logfile.File
+}
+
+// New opens the audit log at path
+func New(path string, options logfile.Options) (*Logger, error) {
+	file, err := logfile.Open(path, options)
+	if err != nil {
+		return nil, err
+	}
+	return &Logger{file: file}, nil
+}
+
+// Record appends an entry, filling in the time if it is unset
+func (l *Logger) Record(entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error encoding audit entry: %v", err)
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing audit entry: %v", err)
+	}
+	return nil
+}
+
+// Query returns the entries matching filter in chronological order
+func (l *Logger) Query(filter Filter) ([]Entry, error) {
+	var entries []Entry
+	for _, path := range l.file.Files() {
+		if err := readEntries(path, filter, &entries); err != nil {
+			return nil, err
+		}
+	}
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
+
+// Close closes the audit log file
+func (l *Logger) Close() error {
+	return l.file.Close()
+}
+
+func readEntries(path string, filter Filter, entries *[]Entry) error {
+	file, err := logfile.OpenReader(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // Rotated away between listing and reading
+		}
+		return fmt.Errorf("error opening audit log: %v", err)
+	}
+	defer file.Close()
+
+	return logfile.ReadLines(file, maxEntryLength, func(line []byte) {
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return // Skip a torn line rather than failing the whole query
+		}
+		if !filter.matches(entry) {
+			return
+		}
+		*entries = append(*entries, entry)
+		// Only the newest Limit entries are returned, drop older ones early
+		if filter.Limit > 0 && len(*entries) >= 2*filter.Limit {
+			*entries = append((*entries)[:0], (*entries)[len(*entries)-filter.Limit:]...)
+		}
+	})
+}
+
+func (f Filter) matches(entry Entry) bool {
+	if f.User != "" && entry.User != f.User {
+		return false
+	}
+	if f.Command != "" && !strings.Contains(strings.ToLower(entry.Command), strings.ToLower(f.Command)) {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
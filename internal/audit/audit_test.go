@@ -0,0 +1,59 @@
+package audit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/logfile"
+)
+
+func TestRecordAndQuery(t *testing.T) {
+	logger, err := New(filepath.Join(t.TempDir(), "audit.log"), logfile.Options{MaxSize: 256, MaxBackups: 10})
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer logger.Close()
+
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	entries := []Entry{
+		{Time: base, User: "alice@example.com", Method: "oidc", RemoteAddr: "10.0.0.1", Command: "op Steve"},
+		{Time: base.Add(time.Minute), User: "auth-key", Method: "key", RemoteAddr: "10.0.0.2", Command: "list"},
+		{Time: base.Add(2 * time.Minute), User: "alice@example.com", Method: "oidc", RemoteAddr: "10.0.0.1", Command: "time set day"},
+		{Time: base.Add(3 * time.Minute), User: "bob@example.com", Method: "oidc", RemoteAddr: "10.0.0.3", Command: "OP Alex", Denied: true},
+	}
+	for _, entry := range entries {
+		if err := logger.Record(entry); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"all entries in order", Filter{}, []string{"op Steve", "list", "time set day", "OP Alex"}},
+		{"by user", Filter{User: "alice@example.com"}, []string{"op Steve", "time set day"}},
+		{"by command ignoring case", Filter{Command: "op "}, []string{"op Steve", "OP Alex"}},
+		{"time range", Filter{Since: base.Add(time.Minute), Until: base.Add(3 * time.Minute)}, []string{"list", "time set day"}},
+		{"newest with limit", Filter{Limit: 1}, []string{"OP Alex"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := logger.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %d entries, got %d: %+v", len(tt.want), len(got), got)
+			}
+			for i, entry := range got {
+				if entry.Command != tt.want[i] {
+					t.Errorf("Entry %d: expected %q, got %q", i, tt.want[i], entry.Command)
+				}
+			}
+		})
+	}
+}
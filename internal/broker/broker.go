@@ -0,0 +1,207 @@
+package broker
+
+import (
+	"sync"
+)
+
+// DefaultQueueSize is the per-subscriber queue length used when none is given
+const DefaultQueueSize = 256
+
+// Sequenced is implemented by items the broker can number. WithSeq returns a
+// copy of the item carrying the given sequence number.
+type Sequenced[T any] interface {
+	Sequence() uint64
+	WithSeq(seq uint64) T
+}
+
+// Stats are counters describing the broker's distribution so far
+type Stats struct {
+	Published    uint64 `json:"published"`    // Items published, also the last sequence number
+	Dropped      uint64 `json:"dropped"`      // Items not delivered to slow subscribers
+	Disconnected uint64 `json:"disconnected"` // Subscribers disconnected for falling behind
+	Subscribers  int    `json:"subscribers"`  // Currently connected subscribers
+}
+
+// Broker fans items such as output lines out to subscribers. It keeps the
+// most recent items in a ring buffer for replay and never blocks the
+// publisher: a subscriber whose queue is full is disconnected instead.
+type Broker[T Sequenced[T]] struct {
+	mu    sync.Mutex
+	ring  []T
+	start int // Index of the oldest item in ring
+	count int // Number of items in ring
+
+	subscribers map[*Subscription[T]]struct{}
+	stats       Stats
+}
+
+// Subscription receives published items until it is closed or falls behind
+type Subscription[T Sequenced[T]] struct {
+	broker *Broker[T]
+	ch     chan T
+	slow   bool
+}
+
+// New creates a broker keeping the last bufferSize items for replay
+func New[T Sequenced[T]](bufferSize int) *Broker[T] {
+	if bufferSize <= 0 {
+		bufferSize = 1
+	}
+	return &Broker[T]{
+		ring:        make([]T, bufferSize),
+		subscribers: make(map[*Subscription[T]]struct{}),
+	}
+}
+
+// Publish assigns the next sequence number to an item, appends it to the
+// ring buffer and delivers it to subscribers
+func (b *Broker[T]) Publish(item T) T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stats.Published++
+	item = item.WithSeq(b.stats.Published)
+
+	// Overwrite the oldest item once the ring is full
+	end := (b.start + b.count) % len(b.ring)
+	b.ring[end] = item
+	if b.count < len(b.ring) {
+		b.count++
+	} else {
+		b.start = (b.start + 1) % len(b.ring)
+	}
+
+	for sub := range b.subscribers {
+		select {
+		case sub.ch <- item:
+		default:
+			// Queue is full, cut the subscriber loose rather than stall everyone
+			b.stats.Dropped++
+			b.stats.Disconnected++
+			sub.slow = true
+			b.removeLocked(sub)
+		}
+	}
+	return item
+}
+
+// Subscribe registers a new subscriber with a queue of queueSize items and
+// returns it together with the buffered items published before it joined
+func (b *Broker[T]) Subscribe(queueSize int) (*Subscription[T], []T) {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &Subscription[T]{broker: b, ch: make(chan T, queueSize)}
+	b.subscribers[sub] = struct{}{}
+	return sub, b.snapshotLocked()
+}
+
+// Gap describes items a resuming subscriber missed that are no longer buffered
+type Gap struct {
+	From  uint64 `json:"from"`            // First missed sequence number
+	To    uint64 `json:"to"`              // Last missed sequence number, less than From when nothing was missed
+	Reset bool   `json:"reset,omitempty"` // Sequence numbers restarted, the client's position is meaningless
+}
+
+// SubscribeSince registers a new subscriber that has already seen every item
+// up to and including seq. It returns the buffered items after seq and, when
+// some of the missed items have fallen out of the buffer, the gap. A seq
+// ahead of the broker (e.g. after a wrapper restart) replays the whole
+// buffer with a reset gap.
+func (b *Broker[T]) SubscribeSince(queueSize int, seq uint64) (*Subscription[T], []T, *Gap) {
+	sub, items := b.Subscribe(queueSize)
+	if seq > lastSeq(items) {
+		gap := &Gap{From: 1, Reset: true}
+		if len(items) > 0 {
+			gap.To = items[0].Sequence() - 1
+		}
+		return sub, items, gap
+	}
+
+	// Skip what the subscriber already has
+	start := 0
+	for start < len(items) && items[start].Sequence() <= seq {
+		start++
+	}
+	items = items[start:]
+
+	// A new client (seq 0) simply gets whatever is buffered
+	if seq > 0 && len(items) > 0 && items[0].Sequence() > seq+1 {
+		return sub, items, &Gap{From: seq + 1, To: items[0].Sequence() - 1}
+	}
+	return sub, items, nil
+}
+
+func lastSeq[T Sequenced[T]](items []T) uint64 {
+	if len(items) == 0 {
+		return 0
+	}
+	return items[len(items)-1].Sequence()
+}
+
+// Buffered returns a copy of the items currently in the ring buffer
+func (b *Broker[T]) Buffered() []T {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.snapshotLocked()
+}
+
+// Stats returns the distribution counters
+func (b *Broker[T]) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := b.stats
+	stats.Subscribers = len(b.subscribers)
+	return stats
+}
+
+// Close disconnects every subscriber
+func (b *Broker[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		b.removeLocked(sub)
+	}
+}
+
+func (b *Broker[T]) snapshotLocked() []T {
+	items := make([]T, b.count)
+	for i := 0; i < b.count; i++ {
+		items[i] = b.ring[(b.start+i)%len(b.ring)]
+	}
+	return items
+}
+
+func (b *Broker[T]) removeLocked(sub *Subscription[T]) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.ch)
+}
+
+// C returns the channel items are delivered on. It is closed when the
+// subscription is closed or disconnected for being too slow.
+func (s *Subscription[T]) C() <-chan T {
+	return s.ch
+}
+
+// Slow reports whether the subscription was disconnected for falling behind
+func (s *Subscription[T]) Slow() bool {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.slow
+}
+
+// Close unsubscribes from the broker
+func (s *Subscription[T]) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.removeLocked(s)
+}
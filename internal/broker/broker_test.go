@@ -0,0 +1,130 @@
+package broker
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+func publish(b *Broker[runner.Line], text string) runner.Line {
+	return b.Publish(runner.NewLine(runner.StreamStdout, text))
+}
+
+func TestBrokerFanOut(t *testing.T) {
+	b := New[runner.Line](10)
+	first, _ := b.Subscribe(10)
+	second, _ := b.Subscribe(10)
+
+	publish(b, "hello")
+	publish(b, "world")
+
+	for _, sub := range []*Subscription[runner.Line]{first, second} {
+		for i, want := range []string{"hello", "world"} {
+			got := <-sub.C()
+			if got.Text != want || got.Seq != uint64(i+1) {
+				t.Errorf("Expected %q with seq %d, got %+v", want, i+1, got)
+			}
+		}
+	}
+}
+
+func TestBrokerReplaysRingBuffer(t *testing.T) {
+	b := New[runner.Line](3)
+	for i := 0; i < 5; i++ {
+		publish(b, fmt.Sprintf("line %d", i))
+	}
+
+	_, backlog := b.Subscribe(1)
+	if len(backlog) != 3 {
+		t.Fatalf("Expected 3 buffered lines, got %d", len(backlog))
+	}
+	for i, line := range backlog {
+		if want := fmt.Sprintf("line %d", i+2); line.Text != want || line.Seq != uint64(i+3) {
+			t.Errorf("Expected %q with seq %d, got %+v", want, i+3, line)
+		}
+	}
+}
+
+func TestBrokerDisconnectsSlowSubscriber(t *testing.T) {
+	b := New[runner.Line](100)
+	slow, _ := b.Subscribe(2)
+	fast, _ := b.Subscribe(10)
+
+	for i := 0; i < 5; i++ {
+		publish(b, fmt.Sprintf("line %d", i))
+	}
+
+	// The slow subscriber gets what fit in its queue and is then cut off
+	var received []string
+	for line := range slow.C() {
+		received = append(received, line.Text)
+	}
+	if len(received) != 2 || !slow.Slow() {
+		t.Errorf("Expected slow subscriber to receive 2 lines and be marked slow, got %v", received)
+	}
+
+	if len(fast.C()) != 5 || fast.Slow() {
+		t.Errorf("Expected fast subscriber to receive every line, got %d", len(fast.C()))
+	}
+
+	stats := b.Stats()
+	if stats.Published != 5 || stats.Dropped != 1 || stats.Disconnected != 1 || stats.Subscribers != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestSubscriptionClose(t *testing.T) {
+	b := New[runner.Line](10)
+	sub, _ := b.Subscribe(10)
+	sub.Close()
+	sub.Close() // Closing twice is safe
+
+	publish(b, "after close")
+	if _, ok := <-sub.C(); ok {
+		t.Error("Expected closed subscription channel")
+	}
+	if sub.Slow() {
+		t.Error("A closed subscription is not slow")
+	}
+}
+
+func TestSubscribeSince(t *testing.T) {
+	b := New[runner.Line](5)
+	for i := 0; i < 8; i++ {
+		publish(b, fmt.Sprintf("line %d", i+1))
+	}
+	// Buffer now holds seq 4-8
+
+	tests := []struct {
+		name      string
+		since     uint64
+		wantFirst uint64
+		wantCount int
+		wantGap   *Gap
+	}{
+		{"new client gets whole buffer", 0, 4, 5, nil},
+		{"resume within buffer", 6, 7, 2, nil},
+		{"resume exactly at oldest", 3, 4, 5, nil},
+		{"up to date", 8, 0, 0, nil},
+		{"fell out of buffer", 1, 4, 5, &Gap{From: 2, To: 3}},
+		{"ahead of broker after restart", 50, 4, 5, &Gap{From: 1, To: 3, Reset: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, lines, gap := b.SubscribeSince(10, tt.since)
+			defer sub.Close()
+
+			if len(lines) != tt.wantCount {
+				t.Fatalf("Expected %d lines, got %d", tt.wantCount, len(lines))
+			}
+			if tt.wantCount > 0 && lines[0].Seq != tt.wantFirst {
+				t.Errorf("Expected first seq %d, got %d", tt.wantFirst, lines[0].Seq)
+			}
+			if (gap == nil) != (tt.wantGap == nil) || (gap != nil && *gap != *tt.wantGap) {
+				t.Errorf("Expected gap %+v, got %+v", tt.wantGap, gap)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package checks
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/raknet"
+)
+
+const testDockerfile = `FROM debian:bookworm
+
+ARG MC_VER=1.21.40.03
+
+ENV MINECRAFT_VER=${MC_VER}
+`
+
+const testChart = `apiVersion: v2
+name: minecraft-bedrock
+version: 0.1.3
+appVersion: "1.21.40.03"
+`
+
+func writeFiles(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	dockerfile := filepath.Join(dir, "Dockerfile")
+	chart := filepath.Join(dir, "Chart.yaml")
+	if err := os.WriteFile(dockerfile, []byte(testDockerfile), 0644); err != nil {
+		t.Fatalf("Failed to write Dockerfile: %v", err)
+	}
+	if err := os.WriteFile(chart, []byte(testChart), 0644); err != nil {
+		t.Fatalf("Failed to write chart: %v", err)
+	}
+	return dockerfile, chart
+}
+
+func newLinksServer(t *testing.T, version string) string {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"result":{"links":[{"downloadType":"serverBedrockLinux","downloadUrl":"https://example.com/bin-linux/bedrock-server-` + version + `.zip"}]}}`))
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+func TestCheckVersionsUpdatesPinnedVersions(t *testing.T) {
+	dockerfile, chart := writeFiles(t)
+	options := VersionOptions{LinksURL: newLinksServer(t, "1.21.50.07"), Dockerfile: dockerfile, Chart: chart}
+
+	updated, err := CheckVersions(options, io.Discard)
+	if err != nil {
+		t.Fatalf("CheckVersions failed: %v", err)
+	}
+	if !updated {
+		t.Error("Expected a new version to be found")
+	}
+
+	data, _ := os.ReadFile(dockerfile)
+	if want := strings.Replace(testDockerfile, "1.21.40.03", "1.21.50.07", 1); string(data) != want {
+		t.Errorf("Unexpected Dockerfile:\n%s", data)
+	}
+	data, _ = os.ReadFile(chart)
+	if want := strings.Replace(testChart, `"1.21.40.03"`, `"1.21.50.07"`, 1); string(data) != want {
+		t.Errorf("Unexpected chart:\n%s", data)
+	}
+
+	// A second run finds nothing to do
+	if updated, err := CheckVersions(options, io.Discard); err != nil || updated {
+		t.Errorf("Expected up to date, got updated=%v err=%v", updated, err)
+	}
+}
+
+func TestCheckVersionsDryRun(t *testing.T) {
+	dockerfile, chart := writeFiles(t)
+	options := VersionOptions{LinksURL: newLinksServer(t, "1.21.50.07"), Dockerfile: dockerfile, Chart: chart, DryRun: true}
+
+	updated, err := CheckVersions(options, io.Discard)
+	if err != nil || !updated {
+		t.Fatalf("Expected new version reported, got updated=%v err=%v", updated, err)
+	}
+	if data, _ := os.ReadFile(dockerfile); string(data) != testDockerfile {
+		t.Error("Dry run modified the Dockerfile")
+	}
+}
+
+func TestCheckVersionsFailsWithoutPinnedVersion(t *testing.T) {
+	dockerfile, chart := writeFiles(t)
+	os.WriteFile(dockerfile, []byte("FROM debian\n"), 0644)
+
+	options := VersionOptions{LinksURL: newLinksServer(t, "1.21.50.07"), Dockerfile: dockerfile, Chart: chart}
+	if _, err := CheckVersions(options, io.Discard); err == nil {
+		t.Error("Expected error for a Dockerfile without MC_VER")
+	}
+}
+
+// startFakeServer answers Bedrock pings with the given version
+func startFakeServer(t *testing.T, version string) int {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			_, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(raknet.PongPacket("MCPE;Dedicated Server;748;"+version+";0;10;1;level;Survival;1;19132;19133;"), addr)
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestCheckServer(t *testing.T) {
+	port := startFakeServer(t, "1.21.50")
+	options := ServerOptions{Host: "127.0.0.1", Port: port, Retries: 2, Interval: 10 * time.Millisecond, Timeout: time.Second}
+
+	options.Version = "1.21.50.07"
+	if _, err := CheckServer(options, io.Discard); err != nil {
+		t.Errorf("Expected matching version to pass: %v", err)
+	}
+
+	options.Version = "1.21.60.10"
+	if _, err := CheckServer(options, io.Discard); err == nil {
+		t.Error("Expected mismatched version to fail")
+	}
+}
+
+func TestCheckServerRetries(t *testing.T) {
+	// Nothing answers on this port
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	var out strings.Builder
+	options := ServerOptions{Host: "127.0.0.1", Port: port, Retries: 3, Interval: time.Millisecond, Timeout: 20 * time.Millisecond}
+	if _, err := CheckServer(options, &out); err == nil {
+		t.Fatal("Expected failure without a server")
+	}
+	if n := strings.Count(out.String(), "failed"); n != 3 {
+		t.Errorf("Expected 3 failed attempts, got %d:\n%s", n, out.String())
+	}
+}
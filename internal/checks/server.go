@@ -0,0 +1,79 @@
+package checks
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/raknet"
+)
+
+// ServerOptions configure the server check
+type ServerOptions struct {
+	Host     string
+	Port     int
+	Version  string // Expected version, empty to accept any
+	Retries  int
+	Interval time.Duration // Wait between attempts
+	Timeout  time.Duration // Wait for each reply
+}
+
+// RunServer runs the check-server subcommand and returns the exit code
+func RunServer(args []string) int {
+	fs := flag.NewFlagSet("check-server", flag.ContinueOnError)
+	var options ServerOptions
+	fs.StringVar(&options.Host, "host", "127.0.0.1", "server host")
+	fs.IntVar(&options.Port, "port", 19132, "server port")
+	fs.StringVar(&options.Version, "version", os.Getenv("MC_VER"), "expected server version (env MC_VER)")
+	fs.IntVar(&options.Retries, "retries", 5, "attempts before giving up")
+	fs.DurationVar(&options.Interval, "interval", 5*time.Second, "wait between attempts")
+	fs.DurationVar(&options.Timeout, "timeout", 2*time.Second, "wait for each reply")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if _, err := CheckServer(options, os.Stdout); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// CheckServer pings the server until it answers or the retries run out and
+// verifies it runs the expected version. Bedrock reports versions without
+// the build number, e.g. 1.21.50 for 1.21.50.07.
+func CheckServer(options ServerOptions, out io.Writer) (raknet.Pong, error) {
+	addr := net.JoinHostPort(options.Host, strconv.Itoa(options.Port))
+
+	var pong raknet.Pong
+	for attempt := 1; ; attempt++ {
+		fmt.Fprintf(out, " check attempt %d...", attempt)
+
+		ctx, cancel := context.WithTimeout(context.Background(), options.Timeout)
+		var err error
+		pong, err = raknet.Ping(ctx, addr)
+		cancel()
+		if err == nil {
+			fmt.Fprintf(out, "success\n")
+			break
+		}
+
+		fmt.Fprintf(out, "failed\n")
+		if attempt >= options.Retries {
+			return pong, fmt.Errorf("max retries reached, exiting...")
+		}
+		time.Sleep(options.Interval)
+	}
+
+	if options.Version != "" && (pong.Version == "" || !strings.HasPrefix(options.Version, pong.Version)) {
+		return pong, fmt.Errorf("check failed: expected version %s, found %s", options.Version, pong.Version)
+	}
+	fmt.Fprintf(out, "Found version: %s\n", pong.Version)
+	return pong, nil
+}
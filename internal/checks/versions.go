@@ -0,0 +1,114 @@
+// Package checks implements the release and integration checks run by CI
+package checks
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/jsandas/bedrock-server/internal/downloader"
+)
+
+var (
+	dockerfileVersion = regexp.MustCompile(`(?m)^(ARG MC_VER=)(\S+)`)
+	chartVersion      = regexp.MustCompile(`(?m)^(appVersion:\s*)"?([^"\s]+)"?`)
+)
+
+// VersionOptions configure the version check
+type VersionOptions struct {
+	LinksURL   string // Download links API, defaults to downloader.DefaultLinksURL
+	Dockerfile string
+	Chart      string
+	DryRun     bool // Only report, don't update the pinned versions
+}
+
+// RunVersions runs the check-versions subcommand and returns the exit code
+func RunVersions(args []string) int {
+	fs := flag.NewFlagSet("check-versions", flag.ContinueOnError)
+	var options VersionOptions
+	fs.StringVar(&options.LinksURL, "links-url", downloader.DefaultLinksURL, "download links API URL")
+	fs.StringVar(&options.Dockerfile, "dockerfile", "Dockerfile", "Dockerfile pinning MC_VER")
+	fs.StringVar(&options.Chart, "chart", "helm/minecraft-bedrock/Chart.yaml", "Helm chart pinning appVersion")
+	fs.BoolVar(&options.DryRun, "dry-run", false, "report a new version without updating the files")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if _, err := CheckVersions(options, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, " %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// CheckVersions compares the latest server release with the versions pinned
+// in the Dockerfile and Helm chart, updating them unless DryRun is set. It
+// reports whether a new version was found.
+func CheckVersions(options VersionOptions, out io.Writer) (bool, error) {
+	latest, _, err := downloader.LatestVersion(context.Background(), options.LinksURL, downloader.TypeBedrockLinux)
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve latest version: %w", err)
+	}
+	imageVer, err := readVersion(options.Dockerfile, dockerfileVersion)
+	if err != nil {
+		return false, err
+	}
+	chartVer, err := readVersion(options.Chart, chartVersion)
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprintf(out, " mc_ver=%s image_ver=%s chart_ver=%s\n", latest, imageVer, chartVer)
+
+	if latest == imageVer && latest == chartVer {
+		fmt.Fprintf(out, " Up to date\n")
+		return false, nil
+	}
+
+	fmt.Fprintf(out, " New version found: %s\n", latest)
+	if options.DryRun {
+		return true, nil
+	}
+	if err := writeVersion(options.Dockerfile, dockerfileVersion, latest, false); err != nil {
+		return true, err
+	}
+	if err := writeVersion(options.Chart, chartVersion, latest, true); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+func readVersion(path string, pattern *regexp.Regexp) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	m := pattern.FindSubmatch(data)
+	if m == nil {
+		return "", fmt.Errorf("no pinned version found in %s", path)
+	}
+	return string(m[2]), nil
+}
+
+func writeVersion(path string, pattern *regexp.Regexp, version string, quote bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	value := version
+	if quote {
+		value = `"` + version + `"`
+	}
+	data = pattern.ReplaceAll(data, []byte("${1}"+value))
+	if err := os.WriteFile(path, data, info.Mode()); err != nil {
+		return fmt.Errorf("failed to update %s: %w", path, err)
+	}
+	return nil
+}
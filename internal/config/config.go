@@ -79,6 +79,26 @@ func UpdateServerProperties(appDir string) error {
 	return nil
 }
 
+// ReadServerProperties returns the settings in appDir's server.properties
+func ReadServerProperties(appDir string) (map[string]string, error) {
+	lines, err := readPropertiesFile(filepath.Join(appDir, "server.properties"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading properties file: %v", err)
+	}
+
+	props := make(map[string]string)
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok {
+			props[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return props, nil
+}
+
 func readPropertiesFile(filePath string) ([]string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
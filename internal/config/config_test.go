@@ -117,6 +117,30 @@ gamemode=survival
 	}
 }
 
+func TestReadServerProperties(t *testing.T) {
+	tempDir := t.TempDir()
+	propsContent := `# Minecraft server properties
+server-name=Dedicated Server
+max-players = 10
+level-name=Bedrock level
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "server.properties"), []byte(propsContent), 0644); err != nil {
+		t.Fatalf("Failed to create test properties file: %v", err)
+	}
+
+	props, err := ReadServerProperties(tempDir)
+	if err != nil {
+		t.Fatalf("ReadServerProperties failed: %v", err)
+	}
+	if props["max-players"] != "10" || props["level-name"] != "Bedrock level" || len(props) != 3 {
+		t.Errorf("Unexpected properties %v", props)
+	}
+
+	if _, err := ReadServerProperties(t.TempDir()); err == nil {
+		t.Error("Expected an error without server.properties")
+	}
+}
+
 func contains(content, substr string) bool {
 	return strings.Contains(content, substr)
 }
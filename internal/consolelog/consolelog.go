@@ -0,0 +1,136 @@
+package consolelog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/logfile"
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+// FileName is the name of the active console log inside the log directory
+const FileName = "console.log"
+
+// maxRecordLength is the longest record searched, well above the default
+// runner.DefaultMaxLineLength plus the time and stream prefix. Longer
+// records are skipped.
+const maxRecordLength = 16 << 20
+
+// Record is a single timestamped console line
+type Record struct {
+	Time   time.Time     `json:"time"`
+	Stream runner.Stream `json:"stream"`
+	Text   string        `json:"text"`
+}
+
+// Query selects records when searching the console history
+type Query struct {
+	Since   time.Time      // Records at or after this time
+	Until   time.Time      // Records before this time
+	Pattern *regexp.Regexp // Optional pattern the text must match
+	Limit   int            // Return at most the newest Limit records, 0 for all
+}
+
+// Log persists console output to rotated, compressed files
+type Log struct {
+	file *logfile.File
+}
+
+// Open opens the console log in dir, creating the directory if needed
+func Open(dir string, options logfile.Options) (*Log, error) {
+	options.Compress = true
+	file, err := logfile.Open(filepath.Join(dir, FileName), options)
+	if err != nil {
+		return nil, err
+	}
+	return &Log{file: file}, nil
+}
+
+// Write appends a line as "<capture time> <stream> <text>"
+func (l *Log) Write(line runner.Line) error {
+	// Embedded newlines would break the one-record-per-line format
+	text := strings.ReplaceAll(line.Text, "\n", " ")
+	record := line.Time.UTC().Format(time.RFC3339Nano) + " " + string(line.Stream) + " " + text + "\n"
+	if _, err := l.file.Write([]byte(record)); err != nil {
+		return fmt.Errorf("error writing console log: %v", err)
+	}
+	return nil
+}
+
+// Search returns the records matching query in chronological order
+func (l *Log) Search(query Query) ([]Record, error) {
+	var records []Record
+	for _, path := range l.file.Files() {
+		if err := searchFile(path, query, &records); err != nil {
+			return nil, err
+		}
+	}
+
+	if query.Limit > 0 && len(records) > query.Limit {
+		records = records[len(records)-query.Limit:]
+	}
+	return records, nil
+}
+
+// keepNewest drops all but the newest limit records once there are twice as
+// many, reusing the slice so memory stays bounded when tailing a long history
+func keepNewest(records []Record, limit int) []Record {
+	if limit <= 0 || len(records) <= 2*limit {
+		return records
+	}
+	n := copy(records, records[len(records)-limit:])
+	return records[:n]
+}
+
+// Close closes the active log file
+func (l *Log) Close() error {
+	return l.file.Close()
+}
+
+func searchFile(path string, query Query, records *[]Record) error {
+	reader, err := logfile.OpenReader(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil // Rotated away between listing and reading
+		}
+		return fmt.Errorf("error opening console log: %v", err)
+	}
+	defer reader.Close()
+
+	return logfile.ReadLines(reader, maxRecordLength, func(line []byte) {
+		record, ok := parseRecord(string(line))
+		if !ok {
+			return
+		}
+		if !query.Since.IsZero() && record.Time.Before(query.Since) {
+			return
+		}
+		if !query.Until.IsZero() && !record.Time.Before(query.Until) {
+			return
+		}
+		if query.Pattern != nil && !query.Pattern.MatchString(record.Text) {
+			return
+		}
+		*records = keepNewest(append(*records, record), query.Limit)
+	})
+}
+
+func parseRecord(line string) (Record, bool) {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 {
+		return Record{}, false
+	}
+	t, err := time.Parse(time.RFC3339Nano, fields[0])
+	if err != nil {
+		return Record{}, false
+	}
+	record := Record{Time: t, Stream: runner.Stream(fields[1])}
+	if len(fields) == 3 {
+		record.Text = fields[2]
+	}
+	return record, true
+}
@@ -0,0 +1,130 @@
+package consolelog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/logfile"
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+func stdout(t time.Time, text string) runner.Line {
+	return runner.Line{Time: t, Stream: runner.StreamStdout, Text: text}
+}
+
+func TestSearchAcrossCompressedFiles(t *testing.T) {
+	dir := t.TempDir()
+	log, err := Open(dir, logfile.Options{MaxSize: 512, MaxBackups: 20})
+	if err != nil {
+		t.Fatalf("Failed to open console log: %v", err)
+	}
+	defer log.Close()
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 50; i++ {
+		text := fmt.Sprintf("[INFO] tick %d", i)
+		if i%10 == 0 {
+			text = fmt.Sprintf("[INFO] Player connected: Steve%d, xuid: %d", i, i)
+		}
+		if err := log.Write(stdout(base.Add(time.Duration(i)*time.Minute), text)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	// Rotation should have produced gzipped backups
+	backups, _ := filepath.Glob(filepath.Join(dir, FileName+".*.gz"))
+	if len(backups) == 0 {
+		t.Fatal("Expected compressed backups to be created")
+	}
+
+	records, err := log.Search(Query{Pattern: regexp.MustCompile(`Player connected`)})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(records) != 5 {
+		t.Fatalf("Expected 5 connection records, got %d", len(records))
+	}
+	if !records[0].Time.Equal(base) || records[0].Stream != runner.StreamStdout || !strings.Contains(records[4].Text, "Steve40") {
+		t.Errorf("Unexpected records: %+v", records)
+	}
+
+	records, err = log.Search(Query{Since: base.Add(10 * time.Minute), Until: base.Add(20 * time.Minute)})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(records) != 10 || records[0].Text != "[INFO] Player connected: Steve10, xuid: 10" {
+		t.Errorf("Expected 10 records starting at minute 10, got %d", len(records))
+	}
+
+	records, err = log.Search(Query{Limit: 3})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(records) != 3 || records[2].Text != "[INFO] tick 49" {
+		t.Errorf("Expected the newest 3 records, got %+v", records)
+	}
+}
+
+func TestHistorySurvivesReopen(t *testing.T) {
+	dir := t.TempDir()
+	log, _ := Open(dir, logfile.Options{})
+	log.Write(runner.Line{Time: time.Now(), Stream: runner.StreamStderr, Text: "before restart"})
+	log.Close()
+
+	log, err := Open(dir, logfile.Options{})
+	if err != nil {
+		t.Fatalf("Failed to reopen console log: %v", err)
+	}
+	defer log.Close()
+
+	records, _ := log.Search(Query{})
+	if len(records) != 1 || records[0].Text != "before restart" || records[0].Stream != runner.StreamStderr {
+		t.Errorf("Expected history to survive reopen, got %+v", records)
+	}
+	if _, err := os.Stat(filepath.Join(dir, FileName)); err != nil {
+		t.Errorf("Expected %s in the log directory: %v", FileName, err)
+	}
+}
+
+func TestKeepNewestBoundsMemoryWithinAFile(t *testing.T) {
+	var records []Record
+	for i := 0; i < 1000; i++ {
+		records = keepNewest(append(records, Record{Text: fmt.Sprint(i)}), 5)
+		if len(records) > 10 {
+			t.Fatalf("Expected at most 10 records held, got %d", len(records))
+		}
+	}
+	if got := records[len(records)-1].Text; got != "999" {
+		t.Errorf("Expected the newest record kept last, got %q", got)
+	}
+	if records = keepNewest(records, 0); len(records) == 0 {
+		t.Error("Expected no trimming without a limit")
+	}
+}
+
+func TestSearchFullLengthLines(t *testing.T) {
+	log, err := Open(t.TempDir(), logfile.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open console log: %v", err)
+	}
+	defer log.Close()
+
+	// A line as long as the runner allows, plus the record prefix
+	long := strings.Repeat("x", runner.DefaultMaxLineLength)
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	log.Write(stdout(base, long))
+	log.Write(stdout(base.Add(time.Minute), "after"))
+
+	records, err := log.Search(Query{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(records) != 2 || records[0].Text != long || records[1].Text != "after" {
+		t.Errorf("Expected both records, got %d", len(records))
+	}
+}
@@ -0,0 +1,364 @@
+// Package discord posts server events to a Discord channel and bridges chat
+// between the game and the channel
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/events"
+	"github.com/jsandas/bedrock-server/internal/scheduler"
+)
+
+// Defaults for unset options
+const (
+	DefaultAPIURL       = "https://discord.com/api/v10"
+	DefaultPollInterval = 5 * time.Second
+	requestTimeout      = 10 * time.Second
+	maxRetryAfter       = 30 * time.Second // Longest rate limit waited out
+	maxContentLength    = 2000             // Longest message Discord accepts
+	postQueueSize       = 100              // Notifications waiting to be posted
+)
+
+// Options configure the Discord integration
+type Options struct {
+	APIURL     string // Base URL of the Discord REST API, e.g. a local fake in tests
+	WebhookURL string // Channel webhook notifications are posted to
+	BotToken   string // Bot token for reading and posting channel messages
+	ChannelID  string // Channel the bot bridges chat with
+
+	Bridge       bool          // Relay chat both ways, needs BotToken and ChannelID
+	PollInterval time.Duration // How often the channel is checked for new messages
+	Relay        string        // How Discord messages are shown in game: scheduler.KindTellraw or scheduler.KindSay
+
+	Send  func(user, command string) // Sends a console command relaying a Discord user's message
+	Ready func() bool                // Reports whether the server can receive commands, optional
+
+	Client *http.Client
+}
+
+// Message is the part of a Discord message the bridge uses
+type Message struct {
+	ID        string `json:"id"`
+	Content   string `json:"content"`
+	WebhookID string `json:"webhook_id,omitempty"`
+	Author    struct {
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name,omitempty"`
+		Bot        bool   `json:"bot,omitempty"`
+	} `json:"author"`
+}
+
+// errStopped is returned by requests interrupted by Stop
+var errStopped = errors.New("discord bot stopped")
+
+// Bot posts notifications and relays chat
+type Bot struct {
+	options Options
+	lastID  string // Newest channel message already relayed
+	seeded  bool   // lastID was read from the channel, so old messages aren't relayed
+
+	stop     chan struct{}
+	done     chan struct{} // Closed when polling stopped, nil if it never started
+	stopOnce sync.Once
+}
+
+// New validates the options and creates a bot
+func New(options Options) (*Bot, error) {
+	if options.APIURL == "" {
+		options.APIURL = DefaultAPIURL
+	}
+	options.APIURL = strings.TrimSuffix(options.APIURL, "/")
+	if options.PollInterval <= 0 {
+		options.PollInterval = DefaultPollInterval
+	}
+	if options.Relay == "" {
+		options.Relay = scheduler.KindTellraw
+	}
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: requestTimeout}
+	}
+
+	hasBot := options.BotToken != "" && options.ChannelID != ""
+	if options.WebhookURL == "" && !hasBot {
+		return nil, errors.New("a webhook URL or a bot token and channel id are required")
+	}
+	if options.Bridge && !hasBot {
+		return nil, errors.New("the chat bridge needs a bot token and channel id")
+	}
+	switch options.Relay {
+	case scheduler.KindTellraw, scheduler.KindSay:
+	default:
+		return nil, fmt.Errorf("invalid relay %q: expected tellraw or say", options.Relay)
+	}
+	return &Bot{options: options, stop: make(chan struct{})}, nil
+}
+
+// Run posts events from c until it is closed, then waits for the queued
+// posts. Posting happens in the background so a slow or rate limited
+// Discord doesn't hold up c, notifications are dropped once the queue is
+// full.
+func (b *Bot) Run(c <-chan events.Event) {
+	queue := make(chan string, postQueueSize)
+	posted := make(chan struct{})
+	go func() {
+		defer close(posted)
+		for text := range queue {
+			if err := b.Post(text); err != nil {
+				fmt.Printf("Error posting to Discord: %v\n", err)
+			}
+		}
+	}()
+
+	dropped := 0
+	for event := range c {
+		text := b.Describe(event)
+		if text == "" {
+			continue
+		}
+		select {
+		case queue <- text:
+			if dropped > 0 {
+				fmt.Printf("Dropped %d Discord notifications while Discord was falling behind\n", dropped)
+				dropped = 0
+			}
+		default:
+			if dropped == 0 {
+				fmt.Printf("Discord is falling behind, dropping notifications\n")
+			}
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		fmt.Printf("Dropped %d Discord notifications while Discord was falling behind\n", dropped)
+	}
+
+	close(queue)
+	<-posted
+}
+
+// Describe renders an event as a channel message, empty for events that
+// aren't posted
+func (b *Bot) Describe(event events.Event) string {
+	switch event.Type {
+	case events.ServerStarted:
+		return "Server started"
+	case events.ServerStopped:
+		return "Server stopped"
+	case events.ServerCrashed:
+		return "Server crashed: " + event.Message
+	case events.PlayerJoined:
+		return "**" + escape(event.Player) + "** joined the game"
+	case events.PlayerLeft:
+		return "**" + escape(event.Player) + "** left the game"
+	case events.PlayerChat:
+		if b.options.Bridge {
+			return "**" + escape(event.Player) + "**: " + escape(event.Message)
+		}
+	case events.BackupFinished, events.BackupFailed, events.UpdateInstalled:
+		return event.Message
+	}
+	return ""
+}
+
+// Post sends a message to the channel through the webhook, or as the bot
+// when there is no webhook
+func (b *Bot) Post(text string) error {
+	if len(text) > maxContentLength {
+		text = text[:maxContentLength]
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"content": text,
+		// Player names must not ping anyone
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	})
+
+	url := b.options.WebhookURL
+	if url == "" {
+		url = b.options.APIURL + "/channels/" + b.options.ChannelID + "/messages"
+	}
+	resp, err := b.request(http.MethodPost, url, body, b.options.WebhookURL == "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Start polls the channel for messages to relay in game until Stop is
+// called. When the channel can't be read, e.g. during a Discord outage, it
+// keeps retrying rather than failing.
+func (b *Bot) Start() {
+	if !b.options.Bridge {
+		return
+	}
+	if err := b.seed(); err != nil {
+		fmt.Printf("Error reading Discord messages, retrying: %v\n", err)
+	}
+	b.done = make(chan struct{})
+	go b.poll()
+}
+
+// Stop stops relaying channel messages and interrupts rate limit waits
+func (b *Bot) Stop() {
+	b.stopOnce.Do(func() { close(b.stop) })
+	if b.done != nil {
+		<-b.done
+	}
+}
+
+// seed records the newest channel message so only messages sent from now
+// on are relayed
+func (b *Bot) seed() error {
+	latest, err := b.messages("limit=1")
+	if err != nil {
+		return err
+	}
+	if len(latest) > 0 {
+		b.lastID = latest[0].ID
+	}
+	b.seeded = true
+	return nil
+}
+
+func (b *Bot) poll() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			var err error
+			if b.seeded {
+				err = b.Relay()
+			} else {
+				err = b.seed()
+			}
+			if err != nil && err != errStopped {
+				fmt.Printf("Error reading Discord messages: %v\n", err)
+			}
+		}
+	}
+}
+
+// Relay sends channel messages newer than the last relayed one to the game
+func (b *Bot) Relay() error {
+	if b.options.Ready != nil && !b.options.Ready() {
+		return nil
+	}
+
+	query := "limit=100"
+	if b.lastID != "" {
+		query += "&after=" + b.lastID
+	}
+	messages, err := b.messages(query)
+	if err != nil {
+		return err
+	}
+
+	// Discord returns the newest first
+	sort.Slice(messages, func(i, j int) bool { return snowflakeLess(messages[i].ID, messages[j].ID) })
+	for _, m := range messages {
+		b.lastID = m.ID
+		// Skip our own posts and other integrations so chat doesn't loop
+		if m.Author.Bot || m.WebhookID != "" || strings.TrimSpace(m.Content) == "" {
+			continue
+		}
+		name := m.Author.GlobalName
+		if name == "" {
+			name = m.Author.Username
+		}
+		a := scheduler.Announcement{Kind: b.options.Relay, Message: "[Discord] " + name + ": " + m.Content}
+		b.options.Send(name, a.Command())
+	}
+	return nil
+}
+
+func (b *Bot) messages(query string) ([]Message, error) {
+	url := b.options.APIURL + "/channels/" + b.options.ChannelID + "/messages?" + query
+	resp, err := b.request(http.MethodGet, url, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var messages []Message
+	if err := json.NewDecoder(resp.Body).Decode(&messages); err != nil {
+		return nil, fmt.Errorf("error decoding messages: %v", err)
+	}
+	return messages, nil
+}
+
+// request makes a Discord API request, waiting out one rate limit of up to
+// maxRetryAfter unless the bot is stopped
+func (b *Bot) request(method, url string, body []byte, auth bool) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("error creating request: %v", err)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if auth {
+			req.Header.Set("Authorization", "Bot "+b.options.BotToken)
+		}
+
+		resp, err := b.options.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return resp, nil
+		}
+
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusTooManyRequests && attempt == 0 {
+			var limit struct {
+				RetryAfter float64 `json:"retry_after"`
+			}
+			json.Unmarshal(data, &limit)
+			wait := min(time.Duration(limit.RetryAfter*float64(time.Second)), maxRetryAfter)
+			timer := time.NewTimer(wait)
+			select {
+			case <-b.stop:
+				timer.Stop()
+				return nil, errStopped
+			case <-timer.C:
+			}
+			continue
+		}
+		return nil, fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+}
+
+// escape stops player text from being rendered as Discord markdown
+func escape(text string) string {
+	var sb strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune("\\*_~`|", r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// snowflakeLess orders Discord ids, which are numbers too large for JSON
+func snowflakeLess(a, b string) bool {
+	x, _ := strconv.ParseUint(a, 10, 64)
+	y, _ := strconv.ParseUint(b, 10, 64)
+	return x < y
+}
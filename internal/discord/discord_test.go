@@ -0,0 +1,285 @@
+package discord
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/events"
+	"github.com/jsandas/bedrock-server/internal/scheduler"
+)
+
+// fakeDiscord stands in for the Discord API with one channel
+type fakeDiscord struct {
+	mu       sync.Mutex
+	posted   []string      // Contents posted to the channel or webhook
+	messages []interface{} // Channel messages returned newest first, like Discord
+	queries  []string
+	auth     []string
+}
+
+func (f *fakeDiscord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.auth = append(f.auth, r.Header.Get("Authorization"))
+
+	switch {
+	case r.Method == http.MethodPost && (r.URL.Path == "/webhook" || r.URL.Path == "/api/channels/42/messages"):
+		var body struct {
+			Content string `json:"content"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		f.posted = append(f.posted, body.Content)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/channels/42/messages":
+		f.queries = append(f.queries, r.URL.RawQuery)
+		messages := f.messages
+		if r.URL.Query().Get("limit") == "1" && len(messages) > 1 {
+			messages = messages[:1]
+		}
+		json.NewEncoder(w).Encode(messages)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func message(id, user, content string, bot bool) map[string]interface{} {
+	return map[string]interface{}{
+		"id":      id,
+		"content": content,
+		"author":  map[string]interface{}{"username": user, "bot": bot},
+	}
+}
+
+func TestPostEventsThroughWebhook(t *testing.T) {
+	fake := &fakeDiscord{}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	bot, err := New(Options{WebhookURL: ts.URL + "/webhook"})
+	if err != nil {
+		t.Fatalf("Failed to create bot: %v", err)
+	}
+	c := make(chan events.Event, 4)
+	c <- events.Event{Type: events.ServerStarted}
+	c <- events.Event{Type: events.PlayerJoined, Player: "Steve_99"}
+	c <- events.Event{Type: events.PlayerChat, Player: "Steve_99", Message: "hi"} // Not bridged
+	c <- events.Event{Type: events.ServerCrashed, Message: "server process exited unexpectedly"}
+	close(c)
+	bot.Run(c)
+
+	want := []string{"Server started", `**Steve\_99** joined the game`, "Server crashed: server process exited unexpectedly"}
+	if !reflect.DeepEqual(fake.posted, want) {
+		t.Errorf("Expected posts %q, got %q", want, fake.posted)
+	}
+	if fake.auth[0] != "" {
+		t.Errorf("Expected no bot token sent to the webhook, got %q", fake.auth[0])
+	}
+}
+
+func TestRunDropsWhenDiscordFallsBehind(t *testing.T) {
+	release := make(chan struct{})
+	var posts int
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release // Discord is stuck
+		mu.Lock()
+		posts++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	bot, err := New(Options{WebhookURL: ts.URL + "/webhook"})
+	if err != nil {
+		t.Fatalf("Failed to create bot: %v", err)
+	}
+	c := make(chan events.Event)
+	ran := make(chan struct{})
+	go func() {
+		bot.Run(c)
+		close(ran)
+	}()
+
+	// Far more events than the queue holds are still consumed
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < 3*postQueueSize; i++ {
+			c <- events.Event{Type: events.PlayerJoined, Player: "Steve"}
+		}
+		close(c)
+		close(sent)
+	}()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run stopped consuming events while Discord was stuck")
+	}
+
+	close(release)
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't finish the queued posts")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if posts == 0 || posts > postQueueSize+1 {
+		t.Errorf("Expected at most %d posts with the rest dropped, got %d", postQueueSize+1, posts)
+	}
+}
+
+func TestChatBridge(t *testing.T) {
+	fake := &fakeDiscord{messages: []interface{}{message("100", "old", "before the bridge started", false)}}
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	var sent []string
+	bot, err := New(Options{
+		APIURL:    ts.URL + "/api",
+		BotToken:  "token",
+		ChannelID: "42",
+		Bridge:    true,
+		Send:      func(user, command string) { sent = append(sent, user+": "+command) },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bot: %v", err)
+	}
+	bot.Start()
+	bot.Stop() // Relay is driven by the test
+
+	// Game chat is posted as the bot
+	bot.Run(closedChan(events.Event{Type: events.PlayerChat, Player: "Alex", Message: "hello *discord*"}))
+	if len(fake.posted) != 1 || fake.posted[0] != `**Alex**: hello \*discord\*` {
+		t.Errorf("Unexpected chat post %q", fake.posted)
+	}
+	if fake.auth[len(fake.auth)-1] != "Bot token" {
+		t.Errorf("Expected bot authorization, got %q", fake.auth[len(fake.auth)-1])
+	}
+
+	// Discord chat is relayed in game, oldest first, skipping bots
+	fake.messages = []interface{}{
+		message("103", "bridge", "**Alex**: hello", true),
+		message("102", "sam", "second", false),
+		message("101", "sam", "first\nline", false),
+	}
+	if err := bot.Relay(); err != nil {
+		t.Fatalf("Relay failed: %v", err)
+	}
+	want := []string{
+		"sam: " + scheduler.Announcement{Kind: scheduler.KindTellraw, Message: "[Discord] sam: first line"}.Command(),
+		"sam: " + scheduler.Announcement{Kind: scheduler.KindTellraw, Message: "[Discord] sam: second"}.Command(),
+	}
+	if !reflect.DeepEqual(sent, want) {
+		t.Errorf("Expected commands %q, got %q", want, sent)
+	}
+	if q := fake.queries[len(fake.queries)-1]; !strings.Contains(q, "after=100") {
+		t.Errorf("Expected messages after the starting message, got query %q", q)
+	}
+	if bot.lastID != "103" {
+		t.Errorf("Expected the last message id to advance to 103, got %q", bot.lastID)
+	}
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	invalid := []Options{
+		{},
+		{WebhookURL: "http://example.com", Bridge: true},
+		{BotToken: "token", ChannelID: "42", Relay: "whisper"},
+	}
+	for i, options := range invalid {
+		if _, err := New(options); err == nil {
+			t.Errorf("Case %d: expected error for %+v", i, options)
+		}
+	}
+}
+
+func TestBridgeStartsDuringOutage(t *testing.T) {
+	var mu sync.Mutex
+	down := true
+	fake := &fakeDiscord{messages: []interface{}{message("100", "old", "before the bridge started", false)}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		unavailable := down
+		mu.Unlock()
+		if unavailable {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	bot, err := New(Options{
+		APIURL:       ts.URL + "/api",
+		BotToken:     "token",
+		ChannelID:    "42",
+		Bridge:       true,
+		PollInterval: 10 * time.Millisecond,
+		Send:         func(user, command string) {},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create bot: %v", err)
+	}
+	bot.Start()
+	defer bot.Stop()
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+
+	// Polling reads the starting message once Discord is back
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		fake.mu.Lock()
+		queries := len(fake.queries)
+		fake.mu.Unlock()
+		if queries > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the bridge to retry")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRateLimitInterruptedByStop(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"retry_after": 3600}`))
+	}))
+	defer ts.Close()
+
+	bot, err := New(Options{WebhookURL: ts.URL + "/webhook"})
+	if err != nil {
+		t.Fatalf("Failed to create bot: %v", err)
+	}
+	posted := make(chan error, 1)
+	go func() { posted <- bot.Post("hello") }()
+
+	time.Sleep(50 * time.Millisecond)
+	bot.Stop()
+	select {
+	case err := <-posted:
+		if err != errStopped {
+			t.Errorf("Expected the post to be stopped, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the rate limit wait to be interrupted")
+	}
+}
+
+func closedChan(e ...events.Event) <-chan events.Event {
+	c := make(chan events.Event, len(e))
+	for _, event := range e {
+		c <- event
+	}
+	close(c)
+	return c
+}
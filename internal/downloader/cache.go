@@ -0,0 +1,224 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// PreviousVersionFile records the version installed before the current one
+const PreviousVersionFile = ".bedrock-version-previous"
+
+// PinnedVersionFile records a version chosen by switching or rolling back,
+// which neither MINECRAFT_VER nor automatic updates replace until unpinned
+const PinnedVersionFile = ".bedrock-version-pinned"
+
+var cachedZipPattern = regexp.MustCompile(`^bedrock-server-([0-9][0-9.]*)\.zip$`)
+
+// CachedVersion is a server zip kept in the cache
+type CachedVersion struct {
+	Version    string    `json:"version"`
+	Size       int64     `json:"size"`
+	Downloaded time.Time `json:"downloaded"`
+}
+
+// Versions describes the installed and cached server versions
+type Versions struct {
+	Channel   string          `json:"channel"`
+	Installed string          `json:"installed"`
+	Previous  string          `json:"previous,omitempty"`
+	Pinned    string          `json:"pinned,omitempty"`
+	Cached    []CachedVersion `json:"cached"`
+}
+
+// Cache keeps downloaded server zips by version so a version can be
+// installed again without the network
+type Cache struct {
+	dir  string
+	keep int // Zips kept when pruning, 0 keeps all
+}
+
+// NewCache creates a cache in dir keeping the newest keep versions
+func NewCache(dir string, keep int) *Cache {
+	return &Cache{dir: dir, keep: keep}
+}
+
+// Path returns where the zip of a version is kept
+func (c *Cache) Path(version string) string {
+	return filepath.Join(c.dir, "bedrock-server-"+version+".zip")
+}
+
+// Has reports whether a version is cached
+func (c *Cache) Has(version string) bool {
+	_, err := os.Stat(c.Path(version))
+	return err == nil
+}
+
+// Fetch returns the cached zip of a version, downloading it first if needed
+func (c *Cache) Fetch(ctx context.Context, version string, options FetchOptions) (string, error) {
+	return c.fetch(ctx, version, options, nil)
+}
+
+// Install installs a version into appDir like InstallServer. When it isn't
+// cached yet the zip is extracted as it downloads, falling back to
+// extracting the complete zip when it can't be read front to back.
+func (c *Cache) Install(ctx context.Context, version string, options FetchOptions, appDir string, preserve bool) error {
+	if c.Has(version) {
+		return InstallServer(c.Path(version), version, appDir, preserve)
+	}
+
+	// Extract next to appDir so the files can be moved into place
+	if err := os.MkdirAll(appDir, 0755); err != nil {
+		return fmt.Errorf("failed to create app directory: %w", err)
+	}
+	stageDir, err := os.MkdirTemp(appDir, ".install-*")
+	if err != nil {
+		return fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+	defer os.RemoveAll(stageDir)
+
+	stage := &staging{dir: stageDir}
+	path, err := c.fetch(ctx, version, options, stage)
+	if err != nil {
+		return err
+	}
+	if stage.err != nil {
+		fmt.Printf("Extracting the complete download, it couldn't be extracted as it arrived: %v\n", stage.err)
+		return InstallServer(path, version, appDir, preserve)
+	}
+	return installStaged(path, stageDir, version, appDir, preserve)
+}
+
+func (c *Cache) fetch(ctx context.Context, version string, options FetchOptions, stage *staging) (string, error) {
+	path := c.Path(version)
+	if c.Has(version) {
+		return path, nil
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create version cache: %w", err)
+	}
+
+	// Download next to the final name so an interrupted download is never cached
+	tmpFile, err := os.CreateTemp(c.dir, ".download-*.zip")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	err = fetch(ctx, tmpFile, version, options, stage)
+	tmpFile.Close()
+	if err != nil {
+		return "", err
+	}
+	if _, err := ZipFiles(tmpFile.Name()); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpFile.Name(), path); err != nil {
+		return "", fmt.Errorf("failed to cache download: %w", err)
+	}
+	return path, nil
+}
+
+// List returns the cached versions, newest version first
+func (c *Cache) List() ([]CachedVersion, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []CachedVersion{}, nil
+		}
+		return nil, fmt.Errorf("failed to read version cache: %w", err)
+	}
+
+	versions := []CachedVersion{}
+	for _, entry := range entries {
+		m := cachedZipPattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, CachedVersion{Version: m[1], Size: info.Size(), Downloaded: info.ModTime()})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return CompareVersions(versions[i].Version, versions[j].Version) > 0
+	})
+	return versions, nil
+}
+
+// Prune removes the oldest versions beyond the cache size, never removing
+// the versions given, e.g. the installed ones
+func (c *Cache) Prune(keep ...string) {
+	if c.keep <= 0 {
+		return
+	}
+	versions, err := c.List()
+	if err != nil {
+		return
+	}
+	// The protected versions count towards the size, the newest others fill the rest
+	kept := 0
+	for _, v := range versions {
+		if contains(keep, v.Version) {
+			kept++
+		}
+	}
+	for _, v := range versions {
+		if contains(keep, v.Version) {
+			continue
+		}
+		if kept < c.keep {
+			kept++
+			continue
+		}
+		os.Remove(c.Path(v.Version))
+	}
+}
+
+// PreviousVersion returns the version installed before the current one
+func PreviousVersion(appDir string) string {
+	data, err := os.ReadFile(filepath.Join(appDir, PreviousVersionFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// PinnedVersion returns the pinned version, empty when there is none
+func PinnedVersion(appDir string) string {
+	data, err := os.ReadFile(filepath.Join(appDir, PinnedVersionFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// PinVersion pins a version
+func PinVersion(appDir, version string) error {
+	if err := os.WriteFile(filepath.Join(appDir, PinnedVersionFile), []byte(version+"\n"), 0644); err != nil {
+		return fmt.Errorf("error pinning version %s: %v", version, err)
+	}
+	return nil
+}
+
+// UnpinVersion removes the pin, if any
+func UnpinVersion(appDir string) error {
+	if err := os.Remove(filepath.Join(appDir, PinnedVersionFile)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error unpinning version: %v", err)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestCacheFetchAndPrune(t *testing.T) {
+	zipData := createTestZip(t, map[string][]byte{"bedrock_server": []byte("binary")})
+	downloads := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write(zipData.Bytes())
+	}))
+	defer ts.Close()
+
+	cache := NewCache(t.TempDir(), 2)
+	for _, version := range []string{"1.21.0.1", "1.21.10.2", "1.21.2.3"} {
+		if _, err := cache.Fetch(context.Background(), version, FetchOptions{Sources: ts.URL}); err != nil {
+			t.Fatalf("Fetch %s failed: %v", version, err)
+		}
+	}
+	// Cached versions are not downloaded again
+	if _, err := cache.Fetch(context.Background(), "1.21.0.1", FetchOptions{Sources: ts.URL}); err != nil {
+		t.Fatalf("Fetch from cache failed: %v", err)
+	}
+	if downloads != 3 {
+		t.Errorf("Expected 3 downloads, got %d", downloads)
+	}
+
+	list, err := cache.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(list) != 3 || list[0].Version != "1.21.10.2" || list[2].Version != "1.21.0.1" {
+		t.Fatalf("Expected versions newest first, got %+v", list)
+	}
+
+	// The oldest version is kept while it is installed
+	cache.Prune("1.21.0.1")
+	if !cache.Has("1.21.0.1") || !cache.Has("1.21.10.2") || cache.Has("1.21.2.3") {
+		list, _ = cache.List()
+		t.Errorf("Expected 1.21.2.3 pruned, got %+v", list)
+	}
+}
+
+func TestCacheRejectsInvalidDownload(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not a zip"))
+	}))
+	defer ts.Close()
+
+	cache := NewCache(t.TempDir(), 0)
+	if _, err := cache.Fetch(context.Background(), "1.21.0.1", FetchOptions{Sources: ts.URL}); err == nil {
+		t.Fatal("Expected an invalid zip to be rejected")
+	}
+	if cache.Has("1.21.0.1") {
+		t.Error("Expected the invalid download not to be cached")
+	}
+	entries, _ := os.ReadDir(cache.dir)
+	if len(entries) != 0 {
+		t.Errorf("Expected no leftover files, got %v", entries)
+	}
+}
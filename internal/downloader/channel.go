@@ -0,0 +1,75 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Release channels
+const (
+	ChannelRelease = "release"
+	ChannelPreview = "preview"
+)
+
+// DefaultPreviewBaseURL is where the preview server zips are downloaded from
+const DefaultPreviewBaseURL = "https://www.minecraft.net/bedrockdedicatedserver/bin-linux-preview"
+
+// ChannelFile records the channel of the server installed in the app directory
+const ChannelFile = ".bedrock-channel"
+
+// ParseChannel validates a channel name, empty meaning ChannelRelease
+func ParseChannel(channel string) (string, error) {
+	switch channel {
+	case "", ChannelRelease:
+		return ChannelRelease, nil
+	case ChannelPreview:
+		return ChannelPreview, nil
+	default:
+		return "", fmt.Errorf("invalid channel %q: expected %s or %s", channel, ChannelRelease, ChannelPreview)
+	}
+}
+
+// ChannelType returns the links API download type of a channel
+func ChannelType(channel string) string {
+	if channel == ChannelPreview {
+		return TypeBedrockLinuxPreview
+	}
+	return TypeBedrockLinux
+}
+
+// ChannelBaseURL returns where the server zips of a channel are downloaded from
+func ChannelBaseURL(channel string) string {
+	if channel == ChannelPreview {
+		return DefaultPreviewBaseURL
+	}
+	return DefaultBaseURL
+}
+
+// InstalledChannel returns the channel recorded in appDir. Installs from
+// before channels were recorded are releases.
+func InstalledChannel(appDir string) string {
+	data, err := os.ReadFile(filepath.Join(appDir, ChannelFile))
+	if err != nil {
+		return ChannelRelease
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// ClaimChannel records the channel of appDir, refusing to switch an existing
+// install to another channel so a preview never converts release worlds
+func ClaimChannel(appDir, channel string) error {
+	if InstalledVersion(appDir) != "" {
+		if installed := InstalledChannel(appDir); installed != channel {
+			return fmt.Errorf("%s holds a %s server, use a separate app directory for the %s channel", appDir, installed, channel)
+		}
+	}
+	if err := os.MkdirAll(appDir, 0755); err != nil {
+		return fmt.Errorf("failed to create app directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(appDir, ChannelFile), []byte(channel+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record channel: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseChannel(t *testing.T) {
+	for input, want := range map[string]string{"": ChannelRelease, "release": ChannelRelease, "preview": ChannelPreview} {
+		if got, err := ParseChannel(input); err != nil || got != want {
+			t.Errorf("ParseChannel(%q) = %q, %v, expected %q", input, got, err, want)
+		}
+	}
+	if _, err := ParseChannel("beta"); err == nil {
+		t.Error("Expected an unknown channel rejected")
+	}
+	if ChannelBaseURL(ChannelPreview) != DefaultPreviewBaseURL || ChannelBaseURL(ChannelRelease) != DefaultBaseURL {
+		t.Error("Unexpected channel base URLs")
+	}
+}
+
+func TestClaimChannelKeepsInstallsApart(t *testing.T) {
+	appDir := t.TempDir()
+	if err := ClaimChannel(appDir, ChannelPreview); err != nil {
+		t.Fatalf("Claiming an empty directory failed: %v", err)
+	}
+	if got := InstalledChannel(appDir); got != ChannelPreview {
+		t.Errorf("Expected the preview channel recorded, got %q", got)
+	}
+
+	// A release install without a channel file predates channels
+	release := t.TempDir()
+	os.WriteFile(filepath.Join(release, VersionFile), []byte("1.21.50.07\n"), 0644)
+	if err := ClaimChannel(release, ChannelPreview); err == nil {
+		t.Error("Expected a release install refused for the preview channel")
+	}
+	if err := ClaimChannel(release, ChannelRelease); err != nil {
+		t.Errorf("Expected the release channel kept: %v", err)
+	}
+}
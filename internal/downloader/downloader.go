@@ -2,82 +2,182 @@ package downloader
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+// DefaultBaseURL is where the release server zips are downloaded from
+const DefaultBaseURL = "https://www.minecraft.net/bedrockdedicatedserver/bin-linux"
+
+// VersionFile records the installed server version in the app directory
+const VersionFile = ".bedrock-version"
+
+// PreservedFiles are configuration files an upgrade keeps when they already exist
+var PreservedFiles = []string{"server.properties", "allowlist.json", "permissions.json"}
+
 // DownloadMinecraftServer downloads and extracts the Minecraft Bedrock server
 // minecraftVer is the version of the server to download (e.g. "1.20.0.01")
 // appDir is the directory where the server should be extracted
-// baseURL is an optional URL to download from (used for testing)
-func DownloadMinecraftServer(minecraftVer string, appDir string, baseURL string) error {
+// sources are the comma separated mirrors to try, see splitSources
+func DownloadMinecraftServer(minecraftVer string, appDir string, sources string) error {
+	zipPath, err := FetchServer(context.Background(), minecraftVer, FetchOptions{Sources: sources})
+	if err != nil {
+		return err
+	}
+	defer os.Remove(zipPath) // Clean up temp file
+
+	return InstallServer(zipPath, minecraftVer, appDir, false)
+}
+
+// FetchServer downloads the server zip of a version to a temporary file and
+// returns its path, the caller removes it
+func FetchServer(ctx context.Context, minecraftVer string, options FetchOptions) (string, error) {
 	// Create temporary file for the zip
 	tmpFile, err := os.CreateTemp("", "bedrock-server-*.zip")
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return "", fmt.Errorf("failed to create temp file: %w", err)
 	}
-	defer os.Remove(tmpFile.Name()) // Clean up temp file
+	defer tmpFile.Close()
 
-	// Download the server
-	defaultBaseURL := "https://www.minecraft.net/bedrockdedicatedserver/bin-linux"
-	if baseURL == "" {
-		baseURL = defaultBaseURL
+	if err := fetch(ctx, tmpFile, minecraftVer, options, nil); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
 	}
-	url := fmt.Sprintf("%s/bedrock-server-%s.zip", baseURL, minecraftVer)
-	req, err := http.NewRequest("GET", url, nil)
+	return tmpFile.Name(), nil
+}
+
+// InstallServer extracts a server zip into appDir and records its version.
+// A preserving install keeps existing PreservedFiles, e.g. when upgrading.
+func InstallServer(zipPath, minecraftVer, appDir string, preserve bool) error {
+	// Create the app directory if it doesn't exist
+	err := os.MkdirAll(appDir, 0755)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return fmt.Errorf("failed to create app directory: %w", err)
 	}
-	req.Header.Set("User-Agent", "Mozilla/5.0")
 
-	resp, err := http.DefaultClient.Do(req)
+	// Extract the zip file
+	zipReader, err := zip.OpenReader(zipPath)
 	if err != nil {
-		return fmt.Errorf("failed to download server: %w", err)
+		return fmt.Errorf("failed to open zip file: %w", err)
 	}
-	defer resp.Body.Close()
+	defer zipReader.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download server, status code: %d", resp.StatusCode)
+	for _, file := range zipReader.File {
+		if preserve && isPreserved(file.Name) {
+			if _, err := os.Stat(filepath.Join(appDir, file.Name)); err == nil {
+				continue
+			}
+		}
+		err := extractFile(file, appDir)
+		if err != nil {
+			return fmt.Errorf("failed to extract file %s: %w", file.Name, err)
+		}
 	}
 
-	// Copy the response body to the temp file
-	_, err = io.Copy(tmpFile, resp.Body)
+	return recordVersion(minecraftVer, appDir)
+}
+
+// installStaged moves a zip extracted by staging into appDir like
+// InstallServer, setting the file modes from the zip's central directory
+func installStaged(zipPath, stageDir, minecraftVer, appDir string, preserve bool) error {
+	zipReader, err := zip.OpenReader(zipPath)
 	if err != nil {
-		return fmt.Errorf("failed to save download: %w", err)
+		return fmt.Errorf("failed to open zip file: %w", err)
 	}
+	defer zipReader.Close()
 
-	// Ensure the temp file is closed before unzipping
-	tmpFile.Close()
+	for _, file := range zipReader.File {
+		if preserve && isPreserved(file.Name) {
+			if _, err := os.Stat(filepath.Join(appDir, file.Name)); err == nil {
+				continue
+			}
+		}
+		if err := moveStaged(file, stageDir, appDir); err != nil {
+			return fmt.Errorf("failed to install file %s: %w", file.Name, err)
+		}
+	}
+	return recordVersion(minecraftVer, appDir)
+}
 
-	// Create the app directory if it doesn't exist
-	err = os.MkdirAll(appDir, 0755)
+func moveStaged(file *zip.File, stageDir, appDir string) error {
+	src, err := extractPath(stageDir, file.Name)
 	if err != nil {
-		return fmt.Errorf("failed to create app directory: %w", err)
+		return err
+	}
+	destPath, err := extractPath(appDir, file.Name)
+	if err != nil {
+		return err
 	}
+	if file.FileInfo().IsDir() {
+		return os.MkdirAll(destPath, file.Mode())
+	}
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Chmod(src, file.Mode()); err != nil {
+		return err
+	}
+	return os.Rename(src, destPath)
+}
 
-	// Extract the zip file
-	zipReader, err := zip.OpenReader(tmpFile.Name())
+// recordVersion records the version installed in appDir
+func recordVersion(minecraftVer, appDir string) error {
+	// Remember the version replaced so it can be rolled back to
+	if installed := InstalledVersion(appDir); installed != "" && installed != minecraftVer {
+		if err := os.WriteFile(filepath.Join(appDir, PreviousVersionFile), []byte(installed+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to record previous version: %w", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(appDir, VersionFile), []byte(minecraftVer+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to record installed version: %w", err)
+	}
+	return nil
+}
+
+// ZipFiles lists the files in a server zip
+func ZipFiles(zipPath string) ([]string, error) {
+	zipReader, err := zip.OpenReader(zipPath)
 	if err != nil {
-		return fmt.Errorf("failed to open zip file: %w", err)
+		return nil, fmt.Errorf("failed to open zip file: %w", err)
 	}
 	defer zipReader.Close()
 
+	var files []string
 	for _, file := range zipReader.File {
-		err := extractFile(file, appDir)
-		if err != nil {
-			return fmt.Errorf("failed to extract file %s: %w", file.Name, err)
+		if !file.FileInfo().IsDir() {
+			files = append(files, file.Name)
 		}
 	}
+	return files, nil
+}
 
-	return nil
+// InstalledVersion returns the version recorded in appDir, empty when unknown
+func InstalledVersion(appDir string) string {
+	data, err := os.ReadFile(filepath.Join(appDir, VersionFile))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func isPreserved(name string) bool {
+	for _, preserved := range PreservedFiles {
+		if name == preserved {
+			return true
+		}
+	}
+	return false
 }
 
 func extractFile(file *zip.File, destDir string) error {
-	// Create the destination path
-	destPath := filepath.Join(destDir, file.Name)
+	destPath, err := extractPath(destDir, file.Name)
+	if err != nil {
+		return err
+	}
 
 	// Handle directories
 	if file.FileInfo().IsDir() {
@@ -107,3 +207,17 @@ func extractFile(file *zip.File, destDir string) error {
 	_, err = io.Copy(dest, src)
 	return err
 }
+
+// extractPath returns where a zip entry is extracted to, refusing entries
+// that escape destDir such as "../../etc/passwd" or absolute paths
+func extractPath(destDir, name string) (string, error) {
+	destPath := filepath.Join(destDir, name)
+	if rel, err := filepath.Rel(destDir, destPath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("illegal file path %q", name)
+	}
+	return destPath, nil
+}
+
+func isDirName(name string) bool {
+	return strings.HasSuffix(name, "/")
+}
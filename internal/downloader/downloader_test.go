@@ -117,7 +117,69 @@ func createTestZip(t *testing.T, files map[string][]byte) *bytes.Buffer {
 }
 
 func TestExtractFile(t *testing.T) {
-	// This would test the extractFile function
-	// Would need to create a zip.File mock and verify extraction
-	t.Skip("Implementation needed")
+	zipData := createTestZip(t, map[string][]byte{
+		"behavior_packs/vanilla/manifest.json": []byte("{}"),
+		"../escaped.txt":                       []byte("outside"),
+		"/tmp/../../absolute.txt":              []byte("outside"),
+	})
+	zipReader, err := zip.NewReader(bytes.NewReader(zipData.Bytes()), int64(zipData.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read zip: %v", err)
+	}
+
+	parent := t.TempDir()
+	destDir := filepath.Join(parent, "app")
+	for _, file := range zipReader.File {
+		err := extractFile(file, destDir)
+		switch file.Name {
+		case "behavior_packs/vanilla/manifest.json":
+			if err != nil {
+				t.Errorf("Failed to extract %s: %v", file.Name, err)
+			}
+		default:
+			if err == nil {
+				t.Errorf("Expected %s to be rejected", file.Name)
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(destDir, "behavior_packs", "vanilla", "manifest.json")); err != nil {
+		t.Errorf("Expected the nested file extracted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(parent, "escaped.txt")); err == nil {
+		t.Error("Expected nothing written outside the destination")
+	}
+}
+
+func TestInstallServerPreserving(t *testing.T) {
+	appDir := t.TempDir()
+	zipPath := filepath.Join(t.TempDir(), "server.zip")
+	zipData := createTestZip(t, map[string][]byte{
+		"bedrock_server":    []byte("new"),
+		"server.properties": []byte("server-name=Dedicated Server\n"),
+		"allowlist.json":    []byte("[]\n"),
+	})
+	if err := os.WriteFile(zipPath, zipData.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(appDir, "server.properties"), []byte("server-name=Ours\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := InstallServer(zipPath, "1.21.1.1", appDir, true); err != nil {
+		t.Fatalf("InstallServer failed: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(appDir, "server.properties")); string(content) != "server-name=Ours\n" {
+		t.Errorf("Expected existing server.properties kept, got %q", content)
+	}
+	// Preserved files that don't exist yet are installed
+	if _, err := os.Stat(filepath.Join(appDir, "allowlist.json")); err != nil {
+		t.Errorf("Expected allowlist.json installed: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(appDir, "bedrock_server")); string(content) != "new" {
+		t.Errorf("Expected bedrock_server replaced, got %q", content)
+	}
+	if v := InstalledVersion(appDir); v != "1.21.1.1" {
+		t.Errorf("Expected installed version 1.21.1.1, got %q", v)
+	}
 }
@@ -0,0 +1,121 @@
+package downloader
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DefaultLinksURL is the Minecraft services API listing the current downloads
+const DefaultLinksURL = "https://net-secondary.web.minecraft-services.net/api/v1.0/download/links"
+
+// linksTimeout limits a request to the links API, a hung connection would
+// otherwise block the caller until ctx is cancelled
+const linksTimeout = 30 * time.Second
+
+// Download types listed by the links API
+const (
+	TypeBedrockLinux        = "serverBedrockLinux"
+	TypeBedrockLinuxPreview = "serverBedrockPreviewLinux"
+)
+
+// Link is a download listed by the links API
+type Link struct {
+	DownloadType string `json:"downloadType"`
+	DownloadURL  string `json:"downloadUrl"`
+}
+
+var versionPattern = regexp.MustCompile(`bedrock-server-([0-9]+\.[0-9]+\.[0-9]+\.[0-9]+)\.zip`)
+
+// FetchLinks returns the downloads listed by the links API
+// linksURL is an optional URL of the API (used for testing)
+func FetchLinks(ctx context.Context, linksURL string) ([]Link, error) {
+	if linksURL == "" {
+		linksURL = DefaultLinksURL
+	}
+	ctx, cancel := context.WithTimeout(ctx, linksTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", linksURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch download links: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch download links, status code: %d", resp.StatusCode)
+	}
+
+	// The links are grouped under a top level key, e.g. {"result":{"links":[...]}}
+	var body map[string]struct {
+		Links []Link `json:"links"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode download links: %w", err)
+	}
+
+	var links []Link
+	for _, group := range body {
+		links = append(links, group.Links...)
+	}
+	return links, nil
+}
+
+// LatestVersion returns the version and URL of the newest server of the
+// given download type, e.g. TypeBedrockLinux
+func LatestVersion(ctx context.Context, linksURL, downloadType string) (string, string, error) {
+	links, err := FetchLinks(ctx, linksURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, link := range links {
+		if link.DownloadType != downloadType {
+			continue
+		}
+		version := VersionFromURL(link.DownloadURL)
+		if version == "" {
+			return "", "", fmt.Errorf("no version found in download url %s", link.DownloadURL)
+		}
+		return version, link.DownloadURL, nil
+	}
+	return "", "", fmt.Errorf("no %s download listed", downloadType)
+}
+
+// VersionFromURL extracts the version from a bedrock-server-<version>.zip URL
+func VersionFromURL(url string) string {
+	if m := versionPattern.FindStringSubmatch(url); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// CompareVersions compares dotted numeric versions, returning -1, 0 or 1
+func CompareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			fmt.Sscanf(as[i], "%d", &x)
+		}
+		if i < len(bs) {
+			fmt.Sscanf(bs[i], "%d", &y)
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,108 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// linksResponse mirrors the shape of the download links API
+const linksResponse = `{"result":{"links":[
+	{"downloadType":"serverBedrockWindows","downloadUrl":"https://www.minecraft.net/bedrockdedicatedserver/bin-win/bedrock-server-1.21.50.07.zip"},
+	{"downloadType":"serverBedrockLinux","downloadUrl":"https://www.minecraft.net/bedrockdedicatedserver/bin-linux/bedrock-server-1.21.50.07.zip"},
+	{"downloadType":"serverBedrockPreviewLinux","downloadUrl":"https://www.minecraft.net/bedrockdedicatedserver/bin-linux-preview/bedrock-server-1.21.60.21.zip"}
+]}}`
+
+func newLinksServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestLatestVersion(t *testing.T) {
+	ts := newLinksServer(t, linksResponse)
+
+	version, url, err := LatestVersion(context.Background(), ts.URL, TypeBedrockLinux)
+	if err != nil {
+		t.Fatalf("LatestVersion failed: %v", err)
+	}
+	if version != "1.21.50.07" {
+		t.Errorf("Expected version 1.21.50.07, got %s", version)
+	}
+	if url != "https://www.minecraft.net/bedrockdedicatedserver/bin-linux/bedrock-server-1.21.50.07.zip" {
+		t.Errorf("Unexpected url %s", url)
+	}
+
+	if version, _, _ := LatestVersion(context.Background(), ts.URL, ChannelType(ChannelPreview)); version != "1.21.60.21" {
+		t.Errorf("Expected preview version 1.21.60.21, got %s", version)
+	}
+
+	if _, _, err := LatestVersion(context.Background(), ts.URL, "serverBedrockMac"); err == nil {
+		t.Error("Expected error for an unlisted download type")
+	}
+}
+
+func TestLatestVersionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"invalid json", "not json"},
+		{"no version in url", `{"result":{"links":[{"downloadType":"serverBedrockLinux","downloadUrl":"https://example.com/latest.zip"}]}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newLinksServer(t, tt.body)
+			if _, _, err := LatestVersion(context.Background(), ts.URL, TypeBedrockLinux); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.21.50.07", "1.21.50.07", 0},
+		{"1.21.50.07", "1.21.51.01", -1},
+		{"1.21.100.1", "1.21.50.7", 1},
+		{"1.21.50", "1.21.50.0", 0},
+	}
+	for _, tt := range tests {
+		if got := CompareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareVersions(%s, %s) = %d, expected %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLatestVersionCancelled(t *testing.T) {
+	// The API accepts the connection and never answers
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	result := make(chan error)
+	go func() {
+		_, _, err := LatestVersion(ctx, ts.URL, TypeBedrockLinux)
+		result <- err
+	}()
+	select {
+	case err := <-result:
+		if err == nil {
+			t.Error("Expected an error once cancelled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("LatestVersion ignored the cancelled context")
+	}
+}
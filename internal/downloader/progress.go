@@ -0,0 +1,105 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Download states
+const (
+	StateDownloading = "downloading"
+	StateDone        = "done"
+	StateFailed      = "failed"
+)
+
+// progressInterval is how often progress is reported during a download
+const progressInterval = 2 * time.Second
+
+// FetchOptions configure a download
+type FetchOptions struct {
+	Sources  string         // Comma separated mirrors, see splitSources
+	Channel  string         // Release channel downloaded from without Sources, defaults to ChannelRelease
+	Timeout  time.Duration  // Limit for the whole download across all sources, 0 for none
+	Progress func(Progress) // Called as the download proceeds, optional
+}
+
+// Progress describes a download
+type Progress struct {
+	Version string    `json:"version"`
+	Source  string    `json:"source"`
+	State   string    `json:"state"`
+	Bytes   int64     `json:"bytes"`
+	Total   int64     `json:"total"`   // Size of the download, -1 when unknown
+	Percent float64   `json:"percent"` // 0 when the size is unknown
+	Rate    float64   `json:"rate"`    // Bytes per second
+	Started time.Time `json:"started"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// String formats the progress for the console, e.g.
+// "1.21.0.1: 12.5 MB of 50.0 MB (25%) at 2.1 MB/s"
+func (p Progress) String() string {
+	s := fmt.Sprintf("%s: %s", p.Version, formatBytes(p.Bytes))
+	if p.Total > 0 {
+		s += fmt.Sprintf(" of %s (%.0f%%)", formatBytes(p.Total), p.Percent)
+	}
+	return s + fmt.Sprintf(" at %s/s", formatBytes(int64(p.Rate)))
+}
+
+func formatBytes(n int64) string {
+	return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+}
+
+// progressWriter counts the bytes written and reports progress at most
+// every progressInterval. Writes fail once the context is done, so a hung
+// or slow copy is abandoned on cancellation.
+type progressWriter struct {
+	ctx      context.Context
+	progress Progress
+	report   func(Progress)
+	reported time.Time
+	now      func() time.Time
+}
+
+func newProgressWriter(ctx context.Context, version, source string, total int64, report func(Progress)) *progressWriter {
+	now := time.Now()
+	return &progressWriter{
+		ctx:      ctx,
+		progress: Progress{Version: version, Source: source, State: StateDownloading, Total: total, Started: now},
+		report:   report,
+		reported: now,
+		now:      time.Now,
+	}
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	w.progress.Bytes += int64(len(p))
+	if now := w.now(); now.Sub(w.reported) >= progressInterval {
+		w.reported = now
+		w.send(StateDownloading, nil)
+	}
+	return len(p), nil
+}
+
+// send reports the progress in the given state
+func (w *progressWriter) send(state string, err error) {
+	if w.report == nil {
+		return
+	}
+	p := w.progress
+	p.State = state
+	if err != nil {
+		p.Error = err.Error()
+	}
+	if p.Total > 0 {
+		p.Percent = float64(p.Bytes) * 100 / float64(p.Total)
+	}
+	if elapsed := w.now().Sub(p.Started).Seconds(); elapsed > 0 {
+		p.Rate = float64(p.Bytes) / elapsed
+	}
+	w.report(p)
+}
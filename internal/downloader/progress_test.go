@@ -0,0 +1,87 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressWriterReports(t *testing.T) {
+	var reports []Progress
+	w := newProgressWriter(context.Background(), "1.21.0.1", "mirror", 4<<20, func(p Progress) { reports = append(reports, p) })
+	now := w.progress.Started
+	w.now = func() time.Time { return now }
+
+	w.Write(make([]byte, 1<<20))
+	if len(reports) != 0 {
+		t.Fatalf("Expected no report before the interval, got %v", reports)
+	}
+	now = now.Add(progressInterval)
+	w.Write(make([]byte, 1<<20))
+	w.send(StateDone, nil)
+
+	if len(reports) != 2 {
+		t.Fatalf("Expected 2 reports, got %v", reports)
+	}
+	p := reports[0]
+	if p.State != StateDownloading || p.Bytes != 2<<20 || p.Percent != 50 || p.Rate != float64(1<<20) {
+		t.Errorf("Unexpected progress %+v", p)
+	}
+	if got := p.String(); got != "1.21.0.1: 2.0 MB of 4.0 MB (50%) at 1.0 MB/s" {
+		t.Errorf("Unexpected progress text %q", got)
+	}
+	if reports[1].State != StateDone {
+		t.Errorf("Expected the download reported done, got %+v", reports[1])
+	}
+}
+
+func TestFetchProgressAndTimeout(t *testing.T) {
+	zipData := createTestZip(t, map[string][]byte{"bedrock_server": []byte("binary")})
+	hang := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "1.21.0.2") {
+			<-hang // Never finishes
+			return
+		}
+		w.Write(zipData.Bytes())
+	}))
+	defer ts.Close()
+	defer close(hang) // Before closing the server, which waits for the handler
+
+	var last Progress
+	path, err := FetchServer(context.Background(), "1.21.0.1", FetchOptions{
+		Sources:  ts.URL,
+		Progress: func(p Progress) { last = p },
+	})
+	if err != nil {
+		t.Fatalf("FetchServer failed: %v", err)
+	}
+	os.Remove(path)
+	if last.State != StateDone || last.Bytes != int64(zipData.Len()) || last.Percent != 100 {
+		t.Errorf("Expected the finished download reported, got %+v", last)
+	}
+
+	// The timeout covers every source, a hung download isn't followed by the next
+	start := time.Now()
+	_, err = FetchServer(context.Background(), "1.21.0.2", FetchOptions{
+		Sources: ts.URL + "," + ts.URL,
+		Timeout: 100 * time.Millisecond,
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the download to time out, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected the timeout to abort the download, took %v", time.Since(start))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := FetchServer(ctx, "1.21.0.1", FetchOptions{Sources: ts.URL}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancelled download to fail, got %v", err)
+	}
+}
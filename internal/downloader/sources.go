@@ -0,0 +1,191 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// client makes the download requests, see SetProxy
+var client = http.DefaultClient
+
+// SetProxy sends downloads through an HTTP proxy, except to the hosts in
+// noProxy, a comma separated list of host names or domain suffixes such as
+// .example.com. Without a proxy the HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+// environment variables apply.
+func SetProxy(proxyURL, noProxy string) error {
+	if proxyURL == "" {
+		client = http.DefaultClient
+		return nil
+	}
+	proxy, err := url.Parse(proxyURL)
+	if err != nil || proxy.Host == "" {
+		return fmt.Errorf("invalid proxy url %q", proxyURL)
+	}
+
+	var bypass []string
+	for _, host := range strings.Split(noProxy, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			bypass = append(bypass, host)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if bypassProxy(req.URL.Hostname(), bypass) {
+			return nil, nil
+		}
+		return proxy, nil
+	}
+	client = &http.Client{Transport: transport}
+	return nil
+}
+
+func bypassProxy(host string, bypass []string) bool {
+	host = strings.ToLower(host)
+	for _, b := range bypass {
+		if b == "*" || host == strings.TrimPrefix(b, ".") || strings.HasSuffix(host, "."+strings.TrimPrefix(b, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitSources splits a comma separated list of download sources, defaulting
+// to the base URL of the channel. A source is an http(s) or file:// base URL or directory
+// holding bedrock-server-<version>.zip files, or the URL or path of one zip.
+func splitSources(sources, channel string) []string {
+	var list []string
+	for _, source := range strings.Split(sources, ",") {
+		if source = strings.TrimSpace(source); source != "" {
+			list = append(list, source)
+		}
+	}
+	if len(list) == 0 {
+		list = []string{ChannelBaseURL(channel)}
+	}
+	return list
+}
+
+// fetch downloads the server zip of a version into dest, trying each source
+// in turn until one succeeds. A stage, if any, extracts it as it downloads.
+func fetch(ctx context.Context, dest *os.File, minecraftVer string, options FetchOptions, stage *staging) error {
+	if options.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, options.Timeout)
+		defer cancel()
+	}
+
+	list := splitSources(options.Sources, options.Channel)
+	var errs []error
+	for _, source := range list {
+		// Start over after a partial download from the previous source
+		if err := dest.Truncate(0); err != nil {
+			return fmt.Errorf("failed to reset download: %w", err)
+		}
+		if _, err := dest.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("failed to reset download: %w", err)
+		}
+
+		var w io.Writer = dest
+		if stage != nil {
+			var err error
+			if w, err = stage.start(dest); err != nil {
+				return err
+			}
+		}
+		err := fetchFrom(ctx, w, minecraftVer, source, options.Progress)
+		if stage != nil {
+			stage.finish(err)
+		}
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("download of server %s aborted: %w", minecraftVer, ctx.Err())
+		}
+		if len(list) > 1 {
+			fmt.Printf("Download from %s failed: %v\n", source, err)
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return fmt.Errorf("failed to download server from %d sources: %w", len(errs), errors.Join(errs...))
+}
+
+// fetchFrom downloads the server zip of a version from one source
+func fetchFrom(ctx context.Context, dest io.Writer, minecraftVer string, source string, report func(Progress)) error {
+	location := source
+	if !strings.HasSuffix(strings.ToLower(source), ".zip") {
+		location = strings.TrimSuffix(source, "/") + "/bedrock-server-" + minecraftVer + ".zip"
+	} else if v := VersionFromURL(source); v != "" && v != minecraftVer {
+		return fmt.Errorf("%s is version %s, not %s", source, v, minecraftVer)
+	}
+
+	var body io.ReadCloser
+	var size int64
+	var err error
+	u, perr := url.Parse(location)
+	switch {
+	case perr != nil || u.Scheme == "" || len(u.Scheme) == 1: // A drive letter is not a scheme
+		body, size, err = openFile(location)
+	case u.Scheme == "file":
+		body, size, err = openFile(filepath.FromSlash(u.Path))
+	case u.Scheme == "http" || u.Scheme == "https":
+		body, size, err = download(ctx, location)
+	default:
+		return fmt.Errorf("unsupported download source %q", source)
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// Count the bytes as they are read
+	progress := newProgressWriter(ctx, minecraftVer, source, size, report)
+	if _, err := io.Copy(dest, io.TeeReader(body, progress)); err != nil {
+		progress.send(StateFailed, err)
+		return fmt.Errorf("failed to save download: %w", err)
+	}
+	progress.send(StateDone, nil)
+	return nil
+}
+
+// download requests a zip, returning its body and size, -1 when unknown
+func download(ctx context.Context, url string) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to download server: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("failed to download server, status code: %d", resp.StatusCode)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func openFile(path string) (io.ReadCloser, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open server zip: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, fmt.Errorf("failed to open server zip: %w", err)
+	}
+	return f, info.Size(), nil
+}
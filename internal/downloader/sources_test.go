@@ -0,0 +1,97 @@
+package downloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFetchFallsBackAcrossSources(t *testing.T) {
+	zipData := createTestZip(t, map[string][]byte{"bedrock_server": []byte("mirrored")})
+	mirror := t.TempDir()
+	if err := os.WriteFile(filepath.Join(mirror, "bedrock-server-1.21.0.1.zip"), zipData.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer broken.Close()
+
+	tests := []struct {
+		name    string
+		sources string
+	}{
+		{"file url", broken.URL + ",file://" + filepath.ToSlash(mirror)},
+		{"directory", broken.URL + ", " + mirror + "/"},
+		{"zip path", filepath.Join(mirror, "bedrock-server-1.21.0.1.zip")},
+		{"unversioned zip", copyTo(t, zipData.Bytes(), "seed.zip")},
+	}
+	for _, tt := range tests {
+		appDir := t.TempDir()
+		if err := DownloadMinecraftServer("1.21.0.1", appDir, tt.sources); err != nil {
+			t.Errorf("%s: download failed: %v", tt.name, err)
+			continue
+		}
+		if content, _ := os.ReadFile(filepath.Join(appDir, "bedrock_server")); string(content) != "mirrored" {
+			t.Errorf("%s: expected the mirrored server, got %q", tt.name, content)
+		}
+	}
+}
+
+func TestFetchReportsEverySource(t *testing.T) {
+	zip := filepath.Join(t.TempDir(), "bedrock-server-1.20.0.1.zip")
+	os.WriteFile(zip, []byte("zip"), 0644)
+
+	err := DownloadMinecraftServer("1.21.0.1", t.TempDir(), zip+",ftp://mirror.example.com")
+	if err == nil {
+		t.Fatal("Expected the download to fail")
+	}
+	for _, want := range []string{"2 sources", "is version 1.20.0.1", "unsupported download source"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected %q in %q", want, err)
+		}
+	}
+}
+
+func TestSetProxy(t *testing.T) {
+	zipData := createTestZip(t, map[string][]byte{"bedrock_server": []byte("proxied")})
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+		w.Write(zipData.Bytes())
+	}))
+	defer proxy.Close()
+
+	if err := SetProxy(proxy.URL, "direct.example.com,.internal"); err != nil {
+		t.Fatalf("SetProxy failed: %v", err)
+	}
+	defer SetProxy("", "")
+
+	if err := DownloadMinecraftServer("1.21.0.1", t.TempDir(), "http://mirror.example.com/bedrock"); err != nil {
+		t.Fatalf("Download through the proxy failed: %v", err)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://mirror.example.com/bedrock/bedrock-server-1.21.0.1.zip" {
+		t.Errorf("Expected the download proxied, got %v", proxied)
+	}
+
+	for host, want := range map[string]bool{"direct.example.com": true, "mirror.internal": true, "example.com": false} {
+		if got := bypassProxy(host, []string{"direct.example.com", ".internal"}); got != want {
+			t.Errorf("bypassProxy(%q) = %v, expected %v", host, got, want)
+		}
+	}
+	if err := SetProxy("not a url", ""); err == nil {
+		t.Error("Expected an invalid proxy rejected")
+	}
+}
+
+func copyTo(t *testing.T, data []byte, name string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
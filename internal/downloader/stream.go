@@ -0,0 +1,213 @@
+package downloader
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Zip record signatures
+const (
+	localHeaderSignature    = 0x04034b50
+	dataDescriptorSignature = 0x08074b50
+)
+
+// Zip entry flags
+const (
+	flagEncrypted      = 0x1
+	flagDataDescriptor = 0x8
+)
+
+const zip64ExtraID = 0x0001
+
+// staging extracts a zip into a directory as it downloads, so installing
+// doesn't wait for a second pass over the complete zip. The entries are read
+// from their local headers in order; the file modes are only kept in the
+// central directory at the end, see installStaged.
+type staging struct {
+	dir  string
+	pw   *io.PipeWriter
+	done chan error
+	err  error // Why the last download couldn't be extracted as it arrived
+}
+
+// start empties the directory and returns a writer passing the download on
+// to dest while extracting it
+func (s *staging) start(dest io.Writer) (io.Writer, error) {
+	if err := os.RemoveAll(s.dir); err != nil {
+		return nil, fmt.Errorf("failed to reset extraction: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to reset extraction: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	s.pw, s.done = pw, make(chan error, 1)
+	go func() {
+		err := extractStream(pr, s.dir)
+		// Keep reading so a zip that can't be extracted still downloads
+		io.Copy(io.Discard, pr)
+		s.done <- err
+	}()
+	return io.MultiWriter(dest, pw), nil
+}
+
+// finish ends the extraction once the download ended with err
+func (s *staging) finish(err error) {
+	s.pw.CloseWithError(err)
+	s.err = <-s.done
+}
+
+// extractStream extracts the entries of a zip read front to back into
+// destDir, skipping the central directory once it is reached
+func extractStream(r io.Reader, destDir string) error {
+	br := bufio.NewReader(r)
+	for {
+		var signature uint32
+		if err := binary.Read(br, binary.LittleEndian, &signature); err != nil {
+			return fmt.Errorf("failed to read zip entry: %w", unexpectedEOF(err))
+		}
+		if signature != localHeaderSignature {
+			return nil // Central directory
+		}
+		if err := extractEntry(br, destDir); err != nil {
+			return err
+		}
+	}
+}
+
+// extractEntry extracts the entry after a local header signature
+func extractEntry(br *bufio.Reader, destDir string) error {
+	var header struct {
+		Version, Flags, Method, ModTime, ModDate uint16
+		CRC32, CompressedSize, Size              uint32
+		NameLength, ExtraLength                  uint16
+	}
+	if err := binary.Read(br, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("failed to read zip entry: %w", unexpectedEOF(err))
+	}
+	name := make([]byte, header.NameLength)
+	extra := make([]byte, header.ExtraLength)
+	if _, err := io.ReadFull(br, name); err != nil {
+		return fmt.Errorf("failed to read zip entry: %w", unexpectedEOF(err))
+	}
+	if _, err := io.ReadFull(br, extra); err != nil {
+		return fmt.Errorf("failed to read zip entry: %w", unexpectedEOF(err))
+	}
+
+	if header.Flags&flagEncrypted != 0 {
+		return fmt.Errorf("file %s is encrypted", name)
+	}
+	size := int64(header.CompressedSize)
+	zip64 := zip64Extra(extra)
+	if zip64 != nil {
+		size = int64(binary.LittleEndian.Uint64(zip64[8:16]))
+	}
+
+	var data io.Reader
+	switch header.Method {
+	case 0: // Store
+		if header.Flags&flagDataDescriptor != 0 {
+			return fmt.Errorf("stored file %s has no size before its data", name)
+		}
+		data = io.LimitReader(br, size)
+	case 8: // Deflate, which ends itself
+		decompressor := flate.NewReader(br)
+		defer decompressor.Close()
+		data = decompressor
+	default:
+		return fmt.Errorf("file %s uses unsupported compression method %d", name, header.Method)
+	}
+
+	destPath, err := extractPath(destDir, string(name))
+	if err != nil {
+		return err
+	}
+	crc := crc32.NewIEEE()
+	if isDirName(string(name)) {
+		if err := os.MkdirAll(destPath, 0755); err != nil {
+			return err
+		}
+		if _, err := io.Copy(crc, data); err != nil {
+			return fmt.Errorf("failed to extract file %s: %w", name, unexpectedEOF(err))
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+			return err
+		}
+		dest, err := os.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(io.MultiWriter(dest, crc), data)
+		if closeErr := dest.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to extract file %s: %w", name, unexpectedEOF(err))
+		}
+	}
+
+	want := header.CRC32
+	if header.Flags&flagDataDescriptor != 0 {
+		if want, err = readDataDescriptor(br, zip64 != nil); err != nil {
+			return fmt.Errorf("failed to read zip entry %s: %w", name, unexpectedEOF(err))
+		}
+	}
+	if crc.Sum32() != want {
+		return fmt.Errorf("file %s is corrupt: checksum mismatch", name)
+	}
+	return nil
+}
+
+// readDataDescriptor reads the checksum and sizes following an entry's data,
+// returning the checksum
+func readDataDescriptor(br *bufio.Reader, zip64 bool) (uint32, error) {
+	var value uint32
+	if err := binary.Read(br, binary.LittleEndian, &value); err != nil {
+		return 0, err
+	}
+	// The signature is optional
+	if value == dataDescriptorSignature {
+		if err := binary.Read(br, binary.LittleEndian, &value); err != nil {
+			return 0, err
+		}
+	}
+	sizes := 8
+	if zip64 {
+		sizes = 16
+	}
+	if _, err := br.Discard(sizes); err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+// zip64Extra returns the zip64 sizes in an extra field, nil without them
+func zip64Extra(extra []byte) []byte {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		length := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+length {
+			return nil
+		}
+		if id == zip64ExtraID && length >= 16 {
+			return extra[4 : 4+length]
+		}
+		extra = extra[4+length:]
+	}
+	return nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,156 @@
+package downloader
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createDeflatedZip creates a zip compressed like the release zips, with a
+// directory entry and bedrock_server executable
+func createDeflatedZip(t *testing.T, files map[string][]byte) []byte {
+	buffer := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buffer)
+	if _, err := zipWriter.CreateHeader(&zip.FileHeader{Name: "worlds/"}); err != nil {
+		t.Fatalf("Failed to create directory in zip: %v", err)
+	}
+	for name, content := range files {
+		header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+		header.SetMode(0644)
+		if name == "bedrock_server" {
+			header.SetMode(0755)
+		}
+		f, err := zipWriter.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("Failed to create file in zip: %v", err)
+		}
+		if _, err := f.Write(content); err != nil {
+			t.Fatalf("Failed to write content to zip: %v", err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatalf("Failed to close zip writer: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestExtractStream(t *testing.T) {
+	files := map[string][]byte{
+		"bedrock_server":                       bytes.Repeat([]byte("binary"), 10000),
+		"behavior_packs/vanilla/manifest.json": []byte("{}"),
+	}
+	destDir := t.TempDir()
+	if err := extractStream(bytes.NewReader(createDeflatedZip(t, files)), destDir); err != nil {
+		t.Fatalf("extractStream failed: %v", err)
+	}
+	for name, want := range files {
+		if content, _ := os.ReadFile(filepath.Join(destDir, name)); !bytes.Equal(content, want) {
+			t.Errorf("File %s content mismatch, got %d bytes", name, len(content))
+		}
+	}
+	if info, err := os.Stat(filepath.Join(destDir, "worlds")); err != nil || !info.IsDir() {
+		t.Errorf("Expected the worlds directory, got %v", err)
+	}
+}
+
+func TestExtractStreamRejects(t *testing.T) {
+	valid := createDeflatedZip(t, map[string][]byte{"bedrock_server": []byte("binary")})
+	corrupt := bytes.Clone(valid)
+	corrupt[bytes.Index(corrupt, []byte("PK\x07\x08"))+4]++ // Checksum in the data descriptor
+
+	tests := map[string][]byte{
+		"escaping path": createDeflatedZip(t, map[string][]byte{"../escaped.txt": []byte("outside")}),
+		"stored":        createTestZip(t, map[string][]byte{"bedrock_server": []byte("binary")}).Bytes(),
+		"corrupt":       corrupt,
+		"truncated":     valid[:40], // In the middle of the first file
+	}
+	for name, data := range tests {
+		parent := t.TempDir()
+		if err := extractStream(bytes.NewReader(data), filepath.Join(parent, "app")); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if _, err := os.Stat(filepath.Join(parent, "escaped.txt")); err == nil {
+			t.Errorf("%s: expected nothing written outside the destination", name)
+		}
+	}
+}
+
+func TestCacheInstallExtractsWhileDownloading(t *testing.T) {
+	zipData := createDeflatedZip(t, map[string][]byte{
+		"bedrock_server":    []byte("binary"),
+		"server.properties": []byte("server-name=Dedicated Server\n"),
+	})
+	centralDirectory := bytes.Index(zipData, []byte("PK\x01\x02"))
+	appDir := filepath.Join(t.TempDir(), "app")
+
+	// The entries are extracted before the central directory is sent
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(zipData[:centralDirectory])
+		w.(http.Flusher).Flush()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			staged, _ := filepath.Glob(filepath.Join(appDir, ".install-*", "server.properties"))
+			if len(staged) > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Error("Expected the files extracted while downloading")
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.Write(zipData[centralDirectory:])
+	}))
+	defer ts.Close()
+
+	if err := os.MkdirAll(appDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(appDir, "server.properties"), []byte("server-name=Ours\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewCache(t.TempDir(), 0)
+	if err := cache.Install(context.Background(), "1.21.0.1", FetchOptions{Sources: ts.URL}, appDir, true); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+
+	if info, err := os.Stat(filepath.Join(appDir, "bedrock_server")); err != nil || info.Mode()&0111 == 0 {
+		t.Errorf("Expected an executable bedrock_server, got %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(appDir, "server.properties")); string(content) != "server-name=Ours\n" {
+		t.Errorf("Expected existing server.properties kept, got %q", content)
+	}
+	if v := InstalledVersion(appDir); v != "1.21.0.1" {
+		t.Errorf("Expected installed version 1.21.0.1, got %q", v)
+	}
+	if !cache.Has("1.21.0.1") {
+		t.Error("Expected the download cached")
+	}
+	if staged, _ := filepath.Glob(filepath.Join(appDir, ".install-*")); len(staged) != 0 {
+		t.Errorf("Expected the extraction directory removed, got %v", staged)
+	}
+}
+
+func TestCacheInstallFallsBackToCompleteZip(t *testing.T) {
+	// Stored files with their size after the data can't be read front to back
+	zipData := createTestZip(t, map[string][]byte{"bedrock_server": []byte("binary")})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(zipData.Bytes())
+	}))
+	defer ts.Close()
+
+	appDir := t.TempDir()
+	cache := NewCache(t.TempDir(), 0)
+	if err := cache.Install(context.Background(), "1.21.0.1", FetchOptions{Sources: ts.URL}, appDir, false); err != nil {
+		t.Fatalf("Install failed: %v", err)
+	}
+	if content, _ := os.ReadFile(filepath.Join(appDir, "bedrock_server")); string(content) != "binary" {
+		t.Errorf("Expected bedrock_server installed, got %q", content)
+	}
+}
@@ -0,0 +1,92 @@
+package events
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+// Type identifies what happened
+type Type string
+
+const (
+	ServerStarting Type = "server_starting" // Raised by the wrapper when it starts the process
+	ServerStarted  Type = "server_started"
+	ServerStopping Type = "server_stopping"
+	ServerStopped  Type = "server_stopped"
+	ServerCrashed  Type = "server_crashed"
+	PlayerJoined   Type = "player_joined"
+	PlayerLeft     Type = "player_left"
+	PlayerChat     Type = "player_chat"
+
+	// Raised by the wrapper around maintenance tasks
+	BackupFinished  Type = "backup_finished"
+	BackupFailed    Type = "backup_failed"
+	UpdateInstalled Type = "update_installed"
+)
+
+// Event is something notable parsed from server output or raised by the wrapper
+type Event struct {
+	Seq     uint64    `json:"seq"` // Assigned when the event is published
+	Time    time.Time `json:"time"`
+	Type    Type      `json:"type"`
+	Player  string    `json:"player,omitempty"`
+	XUID    string    `json:"xuid,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Sequence returns the event's sequence number
+func (e Event) Sequence() uint64 {
+	return e.Seq
+}
+
+// WithSeq returns a copy of the event with the given sequence number
+func (e Event) WithSeq(seq uint64) Event {
+	e.Seq = seq
+	return e
+}
+
+var (
+	playerConnected    = regexp.MustCompile(`Player connected: (.+?), xuid: (\d*)`)
+	playerDisconnected = regexp.MustCompile(`Player disconnected: (.+?), xuid: (\d*)`)
+	// Chat is only logged by servers with a chat logging add-on, as "<Steve> hello"
+	playerChat = regexp.MustCompile(`^<([^<>]+)> (.+)$`)
+)
+
+// Parse extracts an event from a line of Bedrock server output
+func Parse(line runner.Line) (Event, bool) {
+	if line.Stream == runner.StreamWrapper {
+		return Event{}, false
+	}
+
+	// Strip the "[2024-01-01 12:00:00:123 INFO] " prefix
+	text := line.Text
+	if strings.HasPrefix(text, "[") {
+		if end := strings.IndexByte(text, ']'); end >= 0 {
+			text = strings.TrimSpace(text[end+1:])
+		}
+	}
+
+	event := Event{Time: line.Time}
+	switch {
+	case text == "Server started.":
+		event.Type = ServerStarted
+	case text == "Stopping server...":
+		event.Type = ServerStopping
+	case text == "Quit correctly":
+		event.Type = ServerStopped
+	default:
+		if m := playerConnected.FindStringSubmatch(text); m != nil {
+			event.Type, event.Player, event.XUID = PlayerJoined, m[1], m[2]
+		} else if m := playerDisconnected.FindStringSubmatch(text); m != nil {
+			event.Type, event.Player, event.XUID = PlayerLeft, m[1], m[2]
+		} else if m := playerChat.FindStringSubmatch(text); m != nil {
+			event.Type, event.Player, event.Message = PlayerChat, m[1], m[2]
+		} else {
+			return Event{}, false
+		}
+	}
+	return event, true
+}
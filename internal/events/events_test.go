@@ -0,0 +1,40 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   runner.Line
+		want   Event
+		wantOK bool
+	}{
+		{"started", runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:00:000 INFO] Server started."), Event{Type: ServerStarted}, true},
+		{"stopping", runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:00:000 INFO] Stopping server..."), Event{Type: ServerStopping}, true},
+		{"stopped", runner.NewLine(runner.StreamStdout, "Quit correctly"), Event{Type: ServerStopped}, true},
+		{"joined", runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:00:000 INFO] Player connected: Alex Smith, xuid: 2535412345"), Event{Type: PlayerJoined, Player: "Alex Smith", XUID: "2535412345"}, true},
+		{"left", runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:00:000 INFO] Player disconnected: Steve, xuid: 2535400000, pfid: abc"), Event{Type: PlayerLeft, Player: "Steve", XUID: "2535400000"}, true},
+		{"chat", runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:00:000 INFO] <Steve> anyone seen my horse?"), Event{Type: PlayerChat, Player: "Steve", Message: "anyone seen my horse?"}, true},
+		{"wrapper ignored", runner.NewLine(runner.StreamWrapper, "Server started."), Event{}, false},
+		{"other output", runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:00:000 INFO] Level Name: world"), Event{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, ok := Parse(tt.line)
+			if ok != tt.wantOK {
+				t.Fatalf("Expected ok %v, got %v", tt.wantOK, ok)
+			}
+			if event.Type != tt.want.Type || event.Player != tt.want.Player || event.XUID != tt.want.XUID || event.Message != tt.want.Message {
+				t.Errorf("Expected %+v, got %+v", tt.want, event)
+			}
+			if ok && !event.Time.Equal(tt.line.Time) {
+				t.Errorf("Expected event time from line")
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package logfile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Options controls when and how a log file is rotated
+type Options struct {
+	MaxSize    int64 // Rotate once the file grows past this many bytes, 0 disables rotation
+	MaxBackups int   // Number of rotated files to keep
+	Compress   bool  // Gzip rotated files
+}
+
+// File is an append-only log file that rotates itself by size.
+// Rotated files are named <path>.1 (newest) through <path>.<MaxBackups>,
+// with a .gz suffix when compressed.
+type File struct {
+	path    string
+	options Options
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+
+	// Compression runs in the background so writers aren't held up, a
+	// rotation waits for the previous one before shifting the backups
+	compressing sync.WaitGroup
+}
+
+// Open opens or creates the log file at path for appending
+func Open(path string, options Options) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("error creating log directory: %w", err)
+	}
+
+	f := &File{path: path, options: options}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	// Finish a compression interrupted by a restart
+	if options.Compress && options.MaxBackups > 0 {
+		if _, err := os.Stat(f.pendingName()); err == nil {
+			f.compress()
+		}
+	}
+	return f, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return fmt.Errorf("error opening log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error reading log file info: %w", err)
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Write appends p to the file, rotating first if it would exceed MaxSize
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.options.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.options.MaxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups along and starts a new file, f.mu must be held.
+// Compressed backups are renamed to <path>.1 first and gzipped in the
+// background.
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("error closing log file: %w", err)
+	}
+
+	if f.options.MaxBackups > 0 {
+		f.compressing.Wait()
+
+		// Drop the oldest backup and shift the rest up by one
+		os.Remove(f.backupName(f.options.MaxBackups))
+		for i := f.options.MaxBackups - 1; i >= 1; i-- {
+			os.Rename(f.backupName(i), f.backupName(i+1))
+		}
+		if f.options.Compress {
+			if err := os.Rename(f.path, f.pendingName()); err != nil {
+				return fmt.Errorf("error rotating log file: %w", err)
+			}
+			f.compress()
+		} else if err := os.Rename(f.path, f.backupName(1)); err != nil {
+			return fmt.Errorf("error rotating log file: %w", err)
+		}
+	} else if err := os.Remove(f.path); err != nil {
+		return fmt.Errorf("error truncating log file: %w", err)
+	}
+
+	return f.open()
+}
+
+// compress gzips the newest backup in the background
+func (f *File) compress() {
+	f.compressing.Add(1)
+	go func() {
+		defer f.compressing.Done()
+		if err := compressFile(f.pendingName(), f.backupName(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error compressing log file %s: %v\n", f.pendingName(), err)
+		}
+	}()
+}
+
+// pendingName is the newest backup before it is compressed
+func (f *File) pendingName() string {
+	return fmt.Sprintf("%s.1", f.path)
+}
+
+func (f *File) backupName(n int) string {
+	if f.options.Compress {
+		return fmt.Sprintf("%s.%d.gz", f.path, n)
+	}
+	return fmt.Sprintf("%s.%d", f.path, n)
+}
+
+// compressFile gzips src into dest and removes src. The gzip is written
+// under a temporary name so readers never see a partial file.
+func compressFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dest + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+// OpenReader opens a log file for reading, decompressing .gz backups. A
+// backup that was compressed since it was listed is read from its .gz.
+func OpenReader(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) && !strings.HasSuffix(path, ".gz") {
+		path += ".gz"
+		file, err = os.Open(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &gzipReadCloser{Reader: gz, file: file}, nil
+}
+
+// ReadLines calls fn with each line of r without its newline. Lines longer
+// than maxLength bytes are skipped rather than failing the read, so one
+// oversized record doesn't make the rest of a log unreadable. The line is
+// only valid until fn returns.
+func ReadLines(r io.Reader, maxLength int, fn func(line []byte)) error {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(bytes.TrimSuffix(chunk, []byte("\n"))) > maxLength {
+				tooLong, line = true, line[:0]
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue // The line goes on
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if !tooLong && len(line) > 0 {
+			fn(bytes.TrimSuffix(line, []byte("\n")))
+		}
+		line, tooLong = line[:0], false
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+func (g *gzipReadCloser) Close() error {
+	g.Reader.Close()
+	return g.file.Close()
+}
+
+// Files returns the existing log files ordered from oldest to newest
+func (f *File) Files() []string {
+	var files []string
+	for i := f.options.MaxBackups; i >= 1; i-- {
+		// The newest backup may still be waiting to be compressed,
+		// OpenReader falls back to the .gz if it finishes meanwhile
+		if i == 1 && f.options.Compress {
+			if _, err := os.Stat(f.pendingName()); err == nil {
+				files = append(files, f.pendingName())
+				continue
+			}
+		}
+		if _, err := os.Stat(f.backupName(i)); err == nil {
+			files = append(files, f.backupName(i))
+		}
+	}
+	return append(files, f.path)
+}
+
+// Close waits for background compression and closes the underlying file
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.compressing.Wait()
+	return f.file.Close()
+}
@@ -0,0 +1,148 @@
+package logfile
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	f, err := Open(path, Options{MaxSize: 20, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	defer f.Close()
+
+	// Each line is 10 bytes, so every two lines fill a file
+	for _, line := range []string{"line-0001", "line-0002", "line-0003", "line-0004", "line-0005", "line-0006", "line-0007"} {
+		if _, err := f.Write([]byte(line + "\n")); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	files := f.Files()
+	if len(files) != 3 {
+		t.Fatalf("Expected current file and 2 backups, got %v", files)
+	}
+
+	var contents []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		contents = append(contents, string(data))
+	}
+
+	// The oldest two lines were dropped with the oldest backup
+	got := strings.Join(contents, "")
+	want := "line-0003\nline-0004\nline-0005\nline-0006\nline-0007\n"
+	if got != want {
+		t.Errorf("Unexpected contents across files:\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestOpenAppendsToExistingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "test.log")
+	for _, line := range []string{"first\n", "second\n"} {
+		f, err := Open(path, Options{})
+		if err != nil {
+			t.Fatalf("Failed to open log file: %v", err)
+		}
+		f.Write([]byte(line))
+		f.Close()
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "first\nsecond\n" {
+		t.Errorf("Expected appended contents, got %q", data)
+	}
+}
+
+func TestCompressedRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	f, err := Open(path, Options{MaxSize: 20, MaxBackups: 3, Compress: true})
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+
+	for _, line := range []string{"line-0001", "line-0002", "line-0003", "line-0004", "line-0005"} {
+		if _, err := f.Write([]byte(line + "\n")); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	// Backups are readable whether or not compression has finished
+	var got strings.Builder
+	for _, file := range f.Files() {
+		reader, err := OpenReader(file)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", file, err)
+		}
+		io.Copy(&got, reader)
+		reader.Close()
+	}
+	if want := "line-0001\nline-0002\nline-0003\nline-0004\nline-0005\n"; got.String() != want {
+		t.Errorf("Unexpected contents across files:\n got %q\nwant %q", got.String(), want)
+	}
+
+	f.Close()
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("Expected the pending backup compressed by Close, got %v", err)
+	}
+	for _, name := range []string{path + ".1.gz", path + ".2.gz"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("Expected %s: %v", name, err)
+		}
+	}
+}
+
+func TestOpenFinishesInterruptedCompression(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	if err := os.WriteFile(path+".1", []byte("rotated\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := Open(path, Options{MaxSize: 20, MaxBackups: 2, Compress: true})
+	if err != nil {
+		t.Fatalf("Failed to open log file: %v", err)
+	}
+	f.Close()
+
+	reader, err := OpenReader(path + ".1.gz")
+	if err != nil {
+		t.Fatalf("Expected the leftover backup compressed: %v", err)
+	}
+	defer reader.Close()
+	if data, _ := io.ReadAll(reader); string(data) != "rotated\n" {
+		t.Errorf("Expected the backup contents, got %q", data)
+	}
+}
+
+func TestReadLinesSkipsLongLines(t *testing.T) {
+	long := strings.Repeat("x", 200*1024) // Longer than the read buffer too
+	input := "first\n" + long + "\n" + strings.Repeat("y", 10) + "\n\nlast"
+
+	var lines []string
+	err := ReadLines(strings.NewReader(input), 10, func(line []byte) {
+		lines = append(lines, string(line))
+	})
+	if err != nil {
+		t.Fatalf("ReadLines failed: %v", err)
+	}
+	want := []string{"first", strings.Repeat("y", 10), "", "last"}
+	if strings.Join(lines, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %q, got %q", want, lines)
+	}
+
+	lines = nil
+	ReadLines(strings.NewReader(input), len(long), func(line []byte) {
+		lines = append(lines, string(line))
+	})
+	if len(lines) != 5 || lines[1] != long {
+		t.Errorf("Expected the long line kept within the limit, got %d lines", len(lines))
+	}
+}
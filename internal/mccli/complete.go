@@ -0,0 +1,112 @@
+package mccli
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// commands are the Bedrock dedicated server console commands
+var commands = []string{
+	"allowlist", "camerashake", "changesetting", "clear", "clearspawnpoint", "clone", "damage",
+	"daylock", "deop", "difficulty", "effect", "enchant", "execute", "fill", "fog", "function",
+	"gamemode", "gamerule", "give", "help", "inputpermission", "kick", "kill", "list", "locate",
+	"loot", "me", "mobevent", "msg", "music", "op", "particle", "permission", "place", "playanimation",
+	"playsound", "reload", "replaceitem", "ride", "save", "say", "schedule", "scoreboard",
+	"script", "sendshowstoreoffer", "setblock", "setmaxplayers", "setworldspawn", "spawnpoint",
+	"spreadplayers", "stop", "stopsound", "structure", "summon", "tag", "teleport", "tell",
+	"tellraw", "testfor", "testforblock", "testforblocks", "tickingarea", "time", "title",
+	"titleraw", "toggledownfall", "tp", "transferserver", "w", "weather", "whitelist", "wsserver", "xp",
+}
+
+// subcommands are the fixed second arguments of commands
+var subcommands = map[string][]string{
+	"allowlist":     {"add", "list", "off", "on", "reload", "remove"},
+	"whitelist":     {"add", "list", "off", "on", "reload", "remove"},
+	"changesetting": {"allow-cheats", "difficulty"},
+	"daylock":       {"false", "true"},
+	"difficulty":    {"easy", "hard", "normal", "peaceful"},
+	"gamemode":      {"adventure", "creative", "default", "spectator", "survival"},
+	"permission":    {"list", "reload"},
+	"save":          {"hold", "query", "resume"},
+	"scoreboard":    {"objectives", "players"},
+	"tickingarea":   {"add", "list", "preload", "remove", "remove_all"},
+	"time":          {"add", "query", "set"},
+	"weather":       {"clear", "query", "rain", "thunder"},
+}
+
+// playerCommands take a player name as their first argument
+var playerCommands = map[string]bool{
+	"clear": true, "deop": true, "enchant": true, "give": true, "kick": true, "kill": true,
+	"msg": true, "op": true, "spawnpoint": true, "teleport": true, "tell": true, "tellraw": true,
+	"title": true, "titleraw": true, "tp": true, "w": true, "xp": true,
+}
+
+// Completer completes Bedrock commands, their fixed arguments and the names
+// of players seen joining
+type Completer struct {
+	mu      sync.Mutex
+	players map[string]bool
+}
+
+// NewCompleter creates a completer without any known players
+func NewCompleter() *Completer {
+	return &Completer{players: make(map[string]bool)}
+}
+
+// PlayerJoined adds a player name to the completions
+func (c *Completer) PlayerJoined(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.players[name] = true
+}
+
+// PlayerLeft removes a player name from the completions
+func (c *Completer) PlayerLeft(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.players, name)
+}
+
+// Complete returns the lines completing the last word of line
+func (c *Completer) Complete(line string) []string {
+	// Only the word being typed is completed, the words before it pick the options
+	current := line[strings.LastIndex(line, " ")+1:]
+	head := line[:len(line)-len(current)]
+	words := strings.Fields(head)
+
+	var options []string
+	switch len(words) {
+	case 0:
+		options = commands
+	case 1:
+		options = append(options, subcommands[words[0]]...)
+		if playerCommands[words[0]] {
+			options = append(options, c.playerNames()...)
+		}
+	}
+
+	var candidates []string
+	for _, option := range options {
+		if strings.HasPrefix(option, current) {
+			candidates = append(candidates, head+option)
+		}
+	}
+	return candidates
+}
+
+func (c *Completer) playerNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.players))
+	for name := range c.players {
+		// Names with spaces can't be typed as one argument without quotes
+		if strings.Contains(name, " ") {
+			name = `"` + name + `"`
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,343 @@
+package mccli
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// ErrInterrupt is returned by ReadLine when the user presses ctrl+c
+var ErrInterrupt = errors.New("interrupted")
+
+// maxHistory is the number of entered lines remembered
+const maxHistory = 500
+
+// Key codes read from a raw terminal
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// Editor reads lines from a raw terminal with cursor movement, history and
+// tab completion. Output printed while a line is being edited is written
+// above the prompt and the line redrawn below it.
+type Editor struct {
+	in     *bufio.Reader
+	out    io.Writer
+	prompt string
+	raw    bool // False when input isn't a terminal, lines are read as-is
+
+	// Complete returns the candidate lines for the text before the cursor
+	Complete func(line string) []string
+
+	mu      sync.Mutex
+	buf     []rune
+	pos     int // Cursor position in buf
+	history []string
+	histPos int    // Index in history being edited, len(history) for a new line
+	saved   string // The new line stashed while browsing history
+}
+
+// NewEditor creates an editor. raw reports whether in is a terminal in raw
+// mode, otherwise input is read line by line without editing.
+func NewEditor(in io.Reader, out io.Writer, prompt string, raw bool) *Editor {
+	return &Editor{
+		in:     bufio.NewReader(in),
+		out:    out,
+		prompt: prompt,
+		raw:    raw,
+	}
+}
+
+// SetHistory replaces the history, oldest entry first
+func (e *Editor) SetHistory(history []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(history) > maxHistory {
+		history = history[len(history)-maxHistory:]
+	}
+	e.history = append([]string(nil), history...)
+}
+
+// History returns the entered lines, oldest first
+func (e *Editor) History() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.history...)
+}
+
+// Print writes a line of output without disturbing the line being edited
+func (e *Editor) Print(text string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.raw {
+		fmt.Fprintln(e.out, text)
+		return
+	}
+	fmt.Fprintf(e.out, "\r\x1b[K%s\r\n", text)
+	e.refresh()
+}
+
+// ReadLine returns the next line entered. It returns io.EOF on ctrl+d at an
+// empty prompt or end of input and ErrInterrupt on ctrl+c.
+func (e *Editor) ReadLine() (string, error) {
+	if !e.raw {
+		line, err := e.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+
+	e.mu.Lock()
+	e.buf, e.pos = nil, 0
+	e.histPos, e.saved = len(e.history), ""
+	e.refresh()
+	e.mu.Unlock()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		e.mu.Lock()
+		line, done, err := e.handleKey(r)
+		e.mu.Unlock()
+		if done || err != nil {
+			return line, err
+		}
+	}
+}
+
+// handleKey applies a key press, reporting the entered line when done
+func (e *Editor) handleKey(r rune) (string, bool, error) {
+	switch r {
+	case keyEnter, keyLineFeed:
+		line := string(e.buf)
+		fmt.Fprint(e.out, "\r\n")
+		e.addHistory(line)
+		return line, true, nil
+	case keyCtrlC:
+		fmt.Fprint(e.out, "^C\r\n")
+		return "", true, ErrInterrupt
+	case keyCtrlD:
+		if len(e.buf) == 0 {
+			fmt.Fprint(e.out, "\r\n")
+			return "", true, io.EOF
+		}
+		e.deleteAt(e.pos)
+	case keyBackspace, keyDelete:
+		if e.pos > 0 {
+			e.pos--
+			e.deleteAt(e.pos)
+		}
+	case keyCtrlA:
+		e.pos = 0
+	case keyCtrlE:
+		e.pos = len(e.buf)
+	case keyCtrlB:
+		e.move(-1)
+	case keyCtrlF:
+		e.move(1)
+	case keyCtrlK:
+		e.buf = e.buf[:e.pos]
+	case keyCtrlU:
+		e.buf = append([]rune(nil), e.buf[e.pos:]...)
+		e.pos = 0
+	case keyCtrlW:
+		e.deleteWord()
+	case keyCtrlL:
+		fmt.Fprint(e.out, "\x1b[H\x1b[2J")
+	case keyCtrlP:
+		e.browseHistory(-1)
+	case keyCtrlN:
+		e.browseHistory(1)
+	case keyTab:
+		e.complete()
+	case keyEscape:
+		e.handleEscape()
+	default:
+		if !unicode.IsPrint(r) {
+			return "", false, nil
+		}
+		e.insert([]rune{r})
+	}
+
+	e.refresh()
+	return "", false, nil
+}
+
+// handleEscape handles the arrow, home, end and delete key sequences
+func (e *Editor) handleEscape() {
+	next, _, err := e.in.ReadRune()
+	if err != nil || (next != '[' && next != 'O') {
+		return
+	}
+	code, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+
+	switch code {
+	case 'A':
+		e.browseHistory(-1)
+	case 'B':
+		e.browseHistory(1)
+	case 'C':
+		e.move(1)
+	case 'D':
+		e.move(-1)
+	case 'H':
+		e.pos = 0
+	case 'F':
+		e.pos = len(e.buf)
+	case '1', '3', '4', '7', '8':
+		// Extended keys end with a tilde: 1~/7~ home, 4~/8~ end, 3~ delete
+		if tilde, _, err := e.in.ReadRune(); err != nil || tilde != '~' {
+			return
+		}
+		switch code {
+		case '1', '7':
+			e.pos = 0
+		case '4', '8':
+			e.pos = len(e.buf)
+		case '3':
+			e.deleteAt(e.pos)
+		}
+	}
+}
+
+func (e *Editor) move(delta int) {
+	e.pos += delta
+	if e.pos < 0 {
+		e.pos = 0
+	}
+	if e.pos > len(e.buf) {
+		e.pos = len(e.buf)
+	}
+}
+
+func (e *Editor) insert(runes []rune) {
+	buf := make([]rune, 0, len(e.buf)+len(runes))
+	buf = append(buf, e.buf[:e.pos]...)
+	buf = append(buf, runes...)
+	e.buf = append(buf, e.buf[e.pos:]...)
+	e.pos += len(runes)
+}
+
+func (e *Editor) deleteAt(pos int) {
+	if pos < len(e.buf) {
+		e.buf = append(e.buf[:pos], e.buf[pos+1:]...)
+	}
+}
+
+// deleteWord removes the word before the cursor
+func (e *Editor) deleteWord() {
+	start := e.pos
+	for start > 0 && e.buf[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && e.buf[start-1] != ' ' {
+		start--
+	}
+	e.buf = append(e.buf[:start], e.buf[e.pos:]...)
+	e.pos = start
+}
+
+func (e *Editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(e.history) > 0 && e.history[len(e.history)-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if len(e.history) > maxHistory {
+		e.history = e.history[1:]
+	}
+}
+
+// browseHistory moves through history, keeping the new line being typed
+func (e *Editor) browseHistory(delta int) {
+	pos := e.histPos + delta
+	if pos < 0 || pos > len(e.history) {
+		return
+	}
+	if e.histPos == len(e.history) {
+		e.saved = string(e.buf)
+	}
+	e.histPos = pos
+
+	line := e.saved
+	if pos < len(e.history) {
+		line = e.history[pos]
+	}
+	e.buf = []rune(line)
+	e.pos = len(e.buf)
+}
+
+// complete expands the text before the cursor to the longest common prefix
+// of the candidates, listing them when there is nothing more to add
+func (e *Editor) complete() {
+	if e.Complete == nil {
+		return
+	}
+	prefix := string(e.buf[:e.pos])
+	candidates := e.Complete(prefix)
+	if len(candidates) == 0 {
+		return
+	}
+
+	common := candidates[0]
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(candidates) == 1 {
+		common += " "
+	}
+
+	if len(common) > len(prefix) {
+		e.insert([]rune(common[len(prefix):]))
+		return
+	}
+
+	// Nothing to add, show the choices for the last word
+	words := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		words[i] = candidate[strings.LastIndex(candidate, " ")+1:]
+	}
+	fmt.Fprintf(e.out, "\r\n%s\r\n", strings.Join(words, "  "))
+}
+
+// refresh redraws the prompt and line and places the cursor
+func (e *Editor) refresh() {
+	fmt.Fprintf(e.out, "\r\x1b[K%s%s", e.prompt, string(e.buf))
+	if back := len(e.buf) - e.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
@@ -0,0 +1,331 @@
+// Package mccli is a console client for the wrapper's WebSocket API
+package mccli
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jsandas/bedrock-server/internal/events"
+	"github.com/jsandas/bedrock-server/internal/runner"
+	"github.com/jsandas/bedrock-server/internal/server"
+)
+
+const (
+	historyFile  = ".mccli_history"
+	ackTimeout   = 10 * time.Second // How long exec waits for the command to be acknowledged
+	dialTimeout  = 10 * time.Second
+	promptString = "> "
+)
+
+// Options configure the connection to the wrapper
+type Options struct {
+	URL      string // Base URL of the wrapper, e.g. http://127.0.0.1:8080
+	AuthKey  string
+	Insecure bool // Skip TLS certificate verification, e.g. for self-signed certificates
+}
+
+// Run runs the mccli subcommand with the given arguments and returns the exit code
+func Run(args []string) int {
+	fs := flag.NewFlagSet("mccli", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: mccli [flags]              interactive console\n")
+		fmt.Fprintf(fs.Output(), "       mccli [flags] exec COMMAND  run one command and print its output\n\n")
+		fs.PrintDefaults()
+	}
+
+	var options Options
+	fs.StringVar(&options.URL, "url", defaultURL(), "wrapper web server URL or unix:///path/to/control.sock (env MCCLI_URL)")
+	fs.StringVar(&options.AuthKey, "auth-key", os.Getenv("AUTH_KEY"), "pre-shared key for authentication (env AUTH_KEY)")
+	fs.BoolVar(&options.Insecure, "insecure", os.Getenv("TLS_SELF_SIGNED") == "true", "skip TLS certificate verification")
+	tail := fs.Int("tail", 20, "number of recent output lines to show when the console opens")
+	wait := fs.Duration("wait", 2*time.Second, "how long exec waits for more output after the last line")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	switch {
+	case fs.NArg() == 0:
+		return Interactive(options, *tail, os.Stdin, os.Stdout)
+	case fs.Arg(0) == "exec" && fs.NArg() > 1:
+		return Exec(options, strings.Join(fs.Args()[1:], " "), *wait, os.Stdout, os.Stderr)
+	default:
+		fs.Usage()
+		return 2
+	}
+}
+
+// defaultURL points at the wrapper running alongside in the same container
+func defaultURL() string {
+	if u := os.Getenv("MCCLI_URL"); u != "" {
+		return u
+	}
+	// The control socket needs no auth key, prefer it when the wrapper has one
+	if socket := os.Getenv("CONTROL_SOCKET"); socket != "" {
+		return "unix://" + socket
+	}
+
+	scheme := "http"
+	if os.Getenv("TLS_CERT_FILE") != "" || os.Getenv("TLS_SELF_SIGNED") == "true" {
+		scheme = "https"
+	}
+	port := "8080"
+	if _, p, err := net.SplitHostPort(os.Getenv("LISTEN_ADDRESS")); err == nil && p != "" {
+		port = p
+	}
+	return scheme + "://127.0.0.1:" + port
+}
+
+// Dial opens the console WebSocket, replaying the last tail output lines
+func Dial(options Options, tail int) (*websocket.Conn, error) {
+	u, err := url.Parse(options.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %q: %v", options.URL, err)
+	}
+	dialer := websocket.Dialer{
+		HandshakeTimeout: dialTimeout,
+		TLSClientConfig:  &tls.Config{InsecureSkipVerify: options.Insecure},
+	}
+
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	case "unix":
+		// The control socket path replaces the host, e.g. unix:///run/bedrock.sock
+		socketPath := u.Path
+		dialer.NetDialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		}
+		u = &url.URL{Scheme: "ws", Host: "localhost"}
+	default:
+		return nil, fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/ws"
+	u.RawQuery = url.Values{"format": {"json"}, "tail": {strconv.Itoa(tail)}}.Encode()
+
+	header := http.Header{}
+	if options.AuthKey != "" {
+		header.Set("X-Auth-Key", options.AuthKey)
+	}
+
+	conn, resp, err := dialer.Dial(u.String(), header)
+	if err != nil {
+		if resp != nil {
+			body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return nil, fmt.Errorf("error connecting to %s: %s %s", options.URL, resp.Status, strings.TrimSpace(string(body)))
+		}
+		return nil, fmt.Errorf("error connecting to %s: %v", options.URL, err)
+	}
+	return conn, nil
+}
+
+// Exec runs one command and prints the output that follows it until none
+// arrives for wait. It returns a non-zero exit code when the command is rejected.
+func Exec(options Options, command string, wait time.Duration, stdout, stderr io.Writer) int {
+	conn, err := Dial(options, 0)
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	const id = "exec"
+	if err := conn.WriteJSON(server.Message{V: server.ProtocolVersion, Type: server.MessageCommand, ID: id, Command: command}); err != nil {
+		fmt.Fprintf(stderr, "Error sending command: %v\n", err)
+		return 1
+	}
+
+	acked := false
+	conn.SetReadDeadline(time.Now().Add(ackTimeout))
+	for {
+		var msg server.Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			var netErr net.Error
+			if acked && errors.As(err, &netErr) && netErr.Timeout() {
+				return 0 // Output went quiet
+			}
+			fmt.Fprintf(stderr, "Error reading from server: %v\n", err)
+			return 1
+		}
+
+		switch msg.Type {
+		case server.MessageAck:
+			if msg.ID == id {
+				acked = true
+				conn.SetReadDeadline(time.Now().Add(wait))
+			}
+		case server.MessageError:
+			fmt.Fprintf(stderr, "Error: %s\n", msg.Error)
+			return 1
+		case server.MessageOutput:
+			if msg.Line.Stream == runner.StreamStderr {
+				fmt.Fprintln(stderr, msg.Line.Text)
+			} else {
+				fmt.Fprintln(stdout, msg.Line.Text)
+			}
+			if acked {
+				conn.SetReadDeadline(time.Now().Add(wait))
+			}
+		}
+	}
+}
+
+// Interactive runs a console session until the user exits or the
+// connection closes
+func Interactive(options Options, tail int, stdin *os.File, stdout io.Writer) int {
+	conn, err := Dial(options, tail)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	defer conn.Close()
+
+	// Fall back to plain line input when not attached to a terminal
+	restore, err := makeRaw(int(stdin.Fd()))
+	raw := err == nil
+	if raw {
+		defer restore()
+	}
+
+	completer := NewCompleter()
+	editor := NewEditor(stdin, stdout, promptString, raw)
+	editor.Complete = completer.Complete
+	editor.SetHistory(loadHistory())
+	defer func() { saveHistory(editor.History()) }()
+
+	editor.Print("Connected to " + options.URL + ", press ctrl+c or ctrl+d to exit")
+
+	// Print everything from the server while the user types
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			var msg server.Message
+			if err := conn.ReadJSON(&msg); err != nil {
+				closed <- err
+				return
+			}
+			if text := describe(msg, completer); text != "" {
+				editor.Print(text)
+			}
+		}
+	}()
+
+	lines := make(chan string)
+	inputErr := make(chan error, 1)
+	go func() {
+		for {
+			line, err := editor.ReadLine()
+			if err != nil {
+				inputErr <- err
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	id := 0
+	for {
+		select {
+		case line := <-lines:
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			id++
+			msg := server.Message{V: server.ProtocolVersion, Type: server.MessageCommand, ID: strconv.Itoa(id), Command: line}
+			if err := conn.WriteJSON(msg); err != nil {
+				editor.Print(fmt.Sprintf("Error sending command: %v", err))
+				return 1
+			}
+		case err := <-inputErr:
+			if err == io.EOF || err == ErrInterrupt {
+				return 0
+			}
+			editor.Print(fmt.Sprintf("Error reading input: %v", err))
+			return 1
+		case err := <-closed:
+			editor.Print(fmt.Sprintf("Connection closed: %v", err))
+			return 1
+		}
+	}
+}
+
+// describe renders a server message for the console, tracking players for
+// tab completion
+func describe(msg server.Message, completer *Completer) string {
+	switch msg.Type {
+	case server.MessageOutput:
+		if msg.Line.Stream == runner.StreamStderr {
+			return "[ERR] " + msg.Line.Text
+		}
+		return msg.Line.Text
+	case server.MessageError:
+		return "Error: " + msg.Error
+	case server.MessageGap:
+		return "--- output missed ---"
+	case server.MessageStatus:
+		return "--- server " + msg.Status.State + " ---"
+	case server.MessageEvent:
+		switch msg.Event.Type {
+		case events.PlayerJoined:
+			completer.PlayerJoined(msg.Event.Player)
+		case events.PlayerLeft:
+			completer.PlayerLeft(msg.Event.Player)
+		}
+	}
+	return ""
+}
+
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFile)
+}
+
+// loadHistory reads the saved history, a missing file is an empty history
+func loadHistory() []string {
+	path := historyPath()
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var history []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			history = append(history, line)
+		}
+	}
+	return history
+}
+
+// saveHistory writes the history back, it is only a convenience so errors are ignored
+func saveHistory(history []string) {
+	path := historyPath()
+	if path == "" || len(history) == 0 {
+		return
+	}
+	os.WriteFile(path, []byte(strings.Join(history, "\n")+"\n"), 0600)
+}
@@ -0,0 +1,202 @@
+package mccli
+
+import (
+	"bytes"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/runner"
+	"github.com/jsandas/bedrock-server/internal/server"
+)
+
+func newTestWrapper(t *testing.T) (*server.Server, string) {
+	t.Helper()
+	r := runner.New("cat")
+	if err := r.Start(); err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+	srv := server.New(server.ServerConfig{Runner: r, AuthKey: "secret"})
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return srv, ts.URL
+}
+
+func TestExecPrintsCommandOutput(t *testing.T) {
+	srv, url := newTestWrapper(t)
+	srv.Log("old output that should not be replayed")
+
+	var stdout, stderr bytes.Buffer
+	code := Exec(Options{URL: url, AuthKey: "secret"}, "list", 200*time.Millisecond, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	// cat echoes the command back as its output
+	if stdout.String() != "list\n" {
+		t.Errorf("Expected echoed command, got %q", stdout.String())
+	}
+}
+
+func TestExecRejectedCommand(t *testing.T) {
+	_, url := newTestWrapper(t)
+
+	var stdout, stderr bytes.Buffer
+	if code := Exec(Options{URL: url, AuthKey: "wrong"}, "list", time.Second, &stdout, &stderr); code != 1 {
+		t.Errorf("Expected exit code 1 for a bad key, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "401") {
+		t.Errorf("Expected unauthorized error, got %q", stderr.String())
+	}
+
+	stderr.Reset()
+	if code := Exec(Options{URL: url, AuthKey: "secret"}, "  ", time.Second, &stdout, &stderr); code != 1 {
+		t.Errorf("Expected exit code 1 for an empty command, got %d", code)
+	}
+	if !strings.Contains(stderr.String(), "empty command") {
+		t.Errorf("Expected empty command error, got %q", stderr.String())
+	}
+}
+
+// typeKeys feeds keys to a raw editor and returns the entered line
+func typeKeys(t *testing.T, editor *Editor, keys string) string {
+	t.Helper()
+	editor.in.Reset(strings.NewReader(keys))
+	line, err := editor.ReadLine()
+	if err != nil {
+		t.Fatalf("ReadLine failed: %v", err)
+	}
+	return line
+}
+
+func TestEditorEditing(t *testing.T) {
+	tests := []struct {
+		name string
+		keys string
+		want string
+	}{
+		{"plain", "list\r", "list"},
+		{"backspace", "lisx\x7ft\r", "list"},
+		{"insert after left arrow", "sy hi\x1b[D\x1b[D\x1b[D\x1b[Da\r", "say hi"},
+		{"home and end keys", "ay\x01s\x05 hi\r", "say hi"},
+		{"delete key", "saay\x1b[D\x1b[D\x1b[3~\r", "say"},
+		{"delete word", "say hello\x17bye\r", "say bye"},
+		{"kill line", "say hello\x01\x0btime\r", "time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := NewEditor(nil, io.Discard, "> ", true)
+			if got := typeKeys(t, editor, tt.keys); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEditorHistory(t *testing.T) {
+	editor := NewEditor(nil, io.Discard, "> ", true)
+	editor.SetHistory([]string{"list"})
+	typeKeys(t, editor, "say hi\r")
+	typeKeys(t, editor, "say hi\r") // Repeats are stored once
+
+	if got := typeKeys(t, editor, "\x1b[A\r"); got != "say hi" {
+		t.Errorf("Expected previous line, got %q", got)
+	}
+	if got := typeKeys(t, editor, "\x1b[A\x1b[A\r"); got != "list" {
+		t.Errorf("Expected second to last line, got %q", got)
+	}
+	if got := typeKeys(t, editor, "time\x1b[A\x1b[B\r"); got != "time" {
+		t.Errorf("Expected the new line restored, got %q", got)
+	}
+	if want := []string{"list", "say hi", "list", "time"}; !reflect.DeepEqual(editor.History(), want) {
+		t.Errorf("Expected history %v, got %v", want, editor.History())
+	}
+}
+
+func TestEditorExitKeys(t *testing.T) {
+	editor := NewEditor(nil, io.Discard, "> ", true)
+
+	editor.in.Reset(strings.NewReader("\x04"))
+	if _, err := editor.ReadLine(); err != io.EOF {
+		t.Errorf("Expected EOF on ctrl+d, got %v", err)
+	}
+	editor.in.Reset(strings.NewReader("say\x03"))
+	if _, err := editor.ReadLine(); err != ErrInterrupt {
+		t.Errorf("Expected interrupt on ctrl+c, got %v", err)
+	}
+}
+
+func TestEditorTabCompletion(t *testing.T) {
+	completer := NewCompleter()
+	completer.PlayerJoined("Steve")
+	editor := NewEditor(nil, io.Discard, "> ", true)
+	editor.Complete = completer.Complete
+
+	tests := []struct {
+		keys string
+		want string
+	}{
+		{"gamer\t\r", "gamerule "},
+		{"weather cl\t\r", "weather clear "},
+		{"kick St\t\r", "kick Steve "},
+		{"tell\t\r", "tell"}, // tell, tellraw: nothing common to add
+	}
+	for _, tt := range tests {
+		if got := typeKeys(t, editor, tt.keys); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.keys, tt.want, got)
+		}
+	}
+}
+
+func TestCompleter(t *testing.T) {
+	completer := NewCompleter()
+	completer.PlayerJoined("Alex Smith")
+	completer.PlayerJoined("Steve")
+	completer.PlayerLeft("Steve")
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"ti", []string{"tickingarea", "time", "title", "titleraw"}},
+		{"save ", []string{"save hold", "save query", "save resume"}},
+		{"op ", []string{`op "Alex Smith"`}},
+		{"say ", nil},
+		{"time set ", nil},
+	}
+	for _, tt := range tests {
+		if got := completer.Complete(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Complete(%q) = %v, expected %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestExecOverControlSocket(t *testing.T) {
+	r := runner.New("cat")
+	if err := r.Start(); err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+	srv := server.New(server.ServerConfig{Runner: r, AuthKey: "secret"})
+	path := filepath.Join(t.TempDir(), "control.sock")
+	go srv.StartSocket(path, 0600)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// No auth key is needed over the socket
+	var stdout, stderr bytes.Buffer
+	if code := Exec(Options{URL: "unix://" + path}, "list", 200*time.Millisecond, &stdout, &stderr); code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, stderr.String())
+	}
+	if stdout.String() != "list\n" {
+		t.Errorf("Expected echoed command, got %q", stdout.String())
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package mccli
+
+import "errors"
+
+// makeRaw is only implemented on Linux, elsewhere the console falls back to
+// line-buffered input without editing
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode not supported on this platform")
+}
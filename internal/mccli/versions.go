@@ -0,0 +1,135 @@
+package mccli
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/downloader"
+)
+
+// switchTimeout covers stopping the server, installing and starting the new version
+const switchTimeout = 15 * time.Minute
+
+// RunVersions runs the versions subcommand and returns the exit code
+func RunVersions(args []string) int {
+	fs := flag.NewFlagSet("versions", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: versions [flags] [list]          list installed and cached versions\n")
+		fmt.Fprintf(fs.Output(), "       versions [flags] switch VERSION  install and pin a version\n")
+		fmt.Fprintf(fs.Output(), "       versions [flags] rollback        install and pin the previous version\n")
+		fmt.Fprintf(fs.Output(), "       versions [flags] unpin           let MINECRAFT_VER and automatic updates replace the version\n\n")
+		fs.PrintDefaults()
+	}
+
+	var options Options
+	fs.StringVar(&options.URL, "url", defaultURL(), "wrapper web server URL or unix:///path/to/control.sock (env MCCLI_URL)")
+	fs.StringVar(&options.AuthKey, "auth-key", os.Getenv("AUTH_KEY"), "pre-shared key for authentication (env AUTH_KEY)")
+	fs.BoolVar(&options.Insecure, "insecure", os.Getenv("TLS_SELF_SIGNED") == "true", "skip TLS certificate verification")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var versions downloader.Versions
+	var err error
+	switch {
+	case fs.NArg() == 0 || (fs.Arg(0) == "list" && fs.NArg() == 1):
+		err = request(options, http.MethodGet, "/api/versions", nil, &versions)
+	case fs.Arg(0) == "switch" && fs.NArg() == 2:
+		fmt.Printf("Switching to %s...\n", fs.Arg(1))
+		err = request(options, http.MethodPost, "/api/versions/switch", map[string]string{"version": fs.Arg(1)}, &versions)
+	case fs.Arg(0) == "rollback" && fs.NArg() == 1:
+		fmt.Println("Rolling back...")
+		err = request(options, http.MethodPost, "/api/versions/rollback", nil, &versions)
+	case fs.Arg(0) == "unpin" && fs.NArg() == 1:
+		err = request(options, http.MethodPost, "/api/versions/unpin", nil, &versions)
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	printVersions(os.Stdout, versions)
+	return 0
+}
+
+func printVersions(out io.Writer, versions downloader.Versions) {
+	fmt.Fprintf(out, "Installed: %s\n", versions.Installed)
+	if versions.Pinned != "" {
+		fmt.Fprintf(out, "Pinned:    %s\n", versions.Pinned)
+	}
+	if versions.Previous != "" {
+		fmt.Fprintf(out, "Previous:  %s\n", versions.Previous)
+	}
+	if len(versions.Cached) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "Cached:\n")
+	for _, v := range versions.Cached {
+		fmt.Fprintf(out, "  %-16s %6.1f MB  %s\n", v.Version, float64(v.Size)/(1<<20), v.Downloaded.Format(time.RFC3339))
+	}
+}
+
+// request calls the wrapper's REST API, decoding the JSON reply into result
+func request(options Options, method, path string, body interface{}, result interface{}) error {
+	u, err := url.Parse(options.URL)
+	if err != nil {
+		return fmt.Errorf("invalid url %q: %v", options.URL, err)
+	}
+	transport := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: options.Insecure}}
+	switch u.Scheme {
+	case "http", "https":
+	case "unix":
+		// The control socket path replaces the host, e.g. unix:///run/bedrock.sock
+		socketPath := u.Path
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		}
+		u = &url.URL{Scheme: "http", Host: "localhost"}
+	default:
+		return fmt.Errorf("unsupported url scheme %q", u.Scheme)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if options.AuthKey != "" {
+		req.Header.Set("X-Auth-Key", options.AuthKey)
+	}
+
+	client := &http.Client{Transport: transport, Timeout: switchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error connecting to %s: %v", options.URL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
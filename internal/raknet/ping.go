@@ -0,0 +1,150 @@
+// Package raknet implements the RakNet unconnected ping Bedrock servers
+// answer with their status
+package raknet
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Packet ids of the unconnected ping exchange
+const (
+	idUnconnectedPing = 0x01
+	idUnconnectedPong = 0x1c
+)
+
+// magic identifies offline RakNet messages
+var magic = []byte{0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe, 0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78}
+
+// Pong is the status a Bedrock server advertises in reply to a ping
+type Pong struct {
+	Edition    string        `json:"edition"` // MCPE or MCEE
+	MOTD       string        `json:"motd"`
+	Protocol   int           `json:"protocol"`
+	Version    string        `json:"version"`
+	Players    int           `json:"players"`
+	MaxPlayers int           `json:"maxPlayers"`
+	ServerID   string        `json:"serverId"`
+	LevelName  string        `json:"levelName"`
+	GameMode   string        `json:"gameMode"`
+	PortV4     int           `json:"portV4"`
+	PortV6     int           `json:"portV6"`
+	Latency    time.Duration `json:"latency"`
+}
+
+// Ping sends an unconnected ping to addr (host:port) and parses the reply.
+// The context bounds how long to wait for it.
+func Ping(ctx context.Context, addr string) (Pong, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return Pong{}, fmt.Errorf("error dialing %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// Unblock the read if the context is cancelled without a deadline
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	start := time.Now()
+	if _, err := conn.Write(pingPacket(start)); err != nil {
+		return Pong{}, fmt.Errorf("error sending ping: %w", err)
+	}
+
+	buf := make([]byte, 2048)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return Pong{}, fmt.Errorf("no reply from %s: %w", addr, ctx.Err())
+			}
+			return Pong{}, fmt.Errorf("error reading reply: %w", err)
+		}
+		pong, err := ParsePong(buf[:n])
+		if err != nil {
+			continue // Not a reply to our ping
+		}
+		pong.Latency = time.Since(start)
+		return pong, nil
+	}
+}
+
+func pingPacket(now time.Time) []byte {
+	var guid [8]byte
+	rand.Read(guid[:])
+
+	packet := make([]byte, 0, 33)
+	packet = append(packet, idUnconnectedPing)
+	packet = binary.BigEndian.AppendUint64(packet, uint64(now.UnixMilli()))
+	packet = append(packet, magic...)
+	return append(packet, guid[:]...)
+}
+
+// ParsePong parses an unconnected pong packet. Its payload is a semicolon
+// separated list: edition;motd;protocol;version;players;max;server id;level
+// name;game mode;game mode number;IPv4 port;IPv6 port
+func ParsePong(packet []byte) (Pong, error) {
+	// id, time, server guid, magic, payload length
+	const header = 1 + 8 + 8 + 16 + 2
+	if len(packet) < header || packet[0] != idUnconnectedPong {
+		return Pong{}, errors.New("not an unconnected pong")
+	}
+	if !bytes.Equal(packet[17:33], magic) {
+		return Pong{}, errors.New("invalid magic")
+	}
+	length := int(binary.BigEndian.Uint16(packet[33:35]))
+	if len(packet) < header+length {
+		return Pong{}, errors.New("truncated pong")
+	}
+
+	fields := strings.Split(string(packet[header:header+length]), ";")
+	if len(fields) < 6 {
+		return Pong{}, fmt.Errorf("unexpected pong payload %q", packet[header:header+length])
+	}
+	field := func(i int) string {
+		if i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+	number := func(i int) int {
+		n, _ := strconv.Atoi(field(i))
+		return n
+	}
+
+	return Pong{
+		Edition:    field(0),
+		MOTD:       field(1),
+		Protocol:   number(2),
+		Version:    field(3),
+		Players:    number(4),
+		MaxPlayers: number(5),
+		ServerID:   field(6),
+		LevelName:  field(7),
+		GameMode:   field(8),
+		PortV4:     number(10),
+		PortV6:     number(11),
+	}, nil
+}
+
+// PongPacket builds the pong a server sends for the given payload. It is used
+// by tests standing in for a Bedrock server.
+func PongPacket(payload string) []byte {
+	packet := []byte{idUnconnectedPong}
+	packet = binary.BigEndian.AppendUint64(packet, uint64(time.Now().UnixMilli()))
+	packet = binary.BigEndian.AppendUint64(packet, 0x1234)
+	packet = append(packet, magic...)
+	packet = binary.BigEndian.AppendUint16(packet, uint16(len(payload)))
+	return append(packet, payload...)
+}
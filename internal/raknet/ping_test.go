@@ -0,0 +1,89 @@
+package raknet
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+const testPayload = "MCPE;Dedicated Server;748;1.21.50;2;10;12345678901234567;Bedrock level;Survival;1;19132;19133;"
+
+// startFakeServer answers unconnected pings like a Bedrock server
+func startFakeServer(t *testing.T, payload string) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n == 33 && buf[0] == idUnconnectedPing {
+				conn.WriteTo(PongPacket(payload), addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestPing(t *testing.T) {
+	addr := startFakeServer(t, testPayload)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	pong, err := Ping(ctx, addr)
+	if err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+
+	want := Pong{
+		Edition: "MCPE", MOTD: "Dedicated Server", Protocol: 748, Version: "1.21.50",
+		Players: 2, MaxPlayers: 10, ServerID: "12345678901234567", LevelName: "Bedrock level",
+		GameMode: "Survival", PortV4: 19132, PortV6: 19133,
+	}
+	pong.Latency = 0
+	if pong != want {
+		t.Errorf("Expected %+v, got %+v", want, pong)
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	// Nothing answers on this socket
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := Ping(ctx, conn.LocalAddr().String()); err == nil {
+		t.Error("Expected timeout error")
+	}
+}
+
+func TestParsePongRejectsInvalidPackets(t *testing.T) {
+	valid := PongPacket(testPayload)
+	badMagic := append([]byte(nil), valid...)
+	badMagic[18] = 0
+
+	tests := map[string][]byte{
+		"empty":     {},
+		"wrong id":  append([]byte{0x1d}, valid[1:]...),
+		"bad magic": badMagic,
+		"truncated": valid[:40],
+		"no fields": PongPacket("MCPE;motd"),
+	}
+	for name, packet := range tests {
+		if _, err := ParsePong(packet); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
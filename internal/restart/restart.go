@@ -0,0 +1,232 @@
+// Package restart restarts the server on a schedule, warning players in
+// game before it goes down
+package restart
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/scheduler"
+)
+
+// Policies for a restart that is due while players are online
+const (
+	PolicyRestart = "restart" // Restart anyway after the countdown
+	PolicySkip    = "skip"    // Skip this restart
+	PolicyWait    = "wait"    // Wait until the server is empty
+)
+
+// DefaultWarnings are the times before a restart players are warned at
+var DefaultWarnings = []time.Duration{15 * time.Minute, 5 * time.Minute, time.Minute, 10 * time.Second}
+
+// pollInterval is how often PolicyWait checks whether the server emptied
+const pollInterval = 30 * time.Second
+
+// Options configure a Restarter
+type Options struct {
+	Schedule          string          // Daily time "04:00" or a cron expression
+	Warnings          []time.Duration // Defaults to DefaultWarnings
+	WhenPlayersOnline string          // PolicyRestart, PolicySkip or PolicyWait, defaults to PolicyRestart
+	MaxWait           time.Duration   // How long PolicyWait waits before skipping, 0 waits indefinitely
+
+	Send    func(command string)                     // Sends a console command to the server
+	Players func() int                               // Number of players online
+	Ready   func() bool                              // Reports whether the server is running, optional
+	Restart func() error                             // Stops and starts the server
+	Log     func(format string, args ...interface{}) // Reports progress in the console stream
+}
+
+// Restarter restarts the server when its schedule fires
+type Restarter struct {
+	options  Options
+	schedule scheduler.Cron
+	now      func() time.Time
+	sleep    func(d time.Duration) bool // Returns false when stopped
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New validates the options and creates a restarter
+func New(options Options) (*Restarter, error) {
+	schedule, err := ParseSchedule(options.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	switch options.WhenPlayersOnline {
+	case "":
+		options.WhenPlayersOnline = PolicyRestart
+	case PolicyRestart, PolicySkip, PolicyWait:
+	default:
+		return nil, fmt.Errorf("invalid policy %q: expected restart, skip or wait", options.WhenPlayersOnline)
+	}
+	if options.Warnings == nil {
+		options.Warnings = DefaultWarnings
+	}
+
+	r := &Restarter{
+		options:  options,
+		schedule: schedule,
+		now:      time.Now,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	r.sleep = r.sleepUntilStopped
+	return r, nil
+}
+
+// ParseSchedule parses a daily "HH:MM" time or a cron expression
+func ParseSchedule(schedule string) (scheduler.Cron, error) {
+	if hour, minute, ok := strings.Cut(strings.TrimSpace(schedule), ":"); ok {
+		h, herr := strconv.Atoi(hour)
+		m, merr := strconv.Atoi(minute)
+		if herr != nil || merr != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+			return scheduler.Cron{}, fmt.Errorf("invalid restart time %q: expected HH:MM", schedule)
+		}
+		return scheduler.ParseCron(fmt.Sprintf("%d %d * * *", m, h))
+	}
+	return scheduler.ParseCron(schedule)
+}
+
+// Start runs the restarter in the background until Stop is called
+func (r *Restarter) Start() {
+	go r.run()
+}
+
+// Stop stops the background restarter
+func (r *Restarter) Stop() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *Restarter) run() {
+	defer close(r.done)
+
+	var last time.Time
+	for {
+		after := r.now()
+		if after.Before(last) {
+			after = last
+		}
+		at := r.schedule.Next(after)
+		if at.IsZero() {
+			r.options.Log("Restart schedule %q never fires", r.options.Schedule)
+			return
+		}
+		last = at
+		fmt.Printf("Next scheduled restart at %s\n", at.Format(time.RFC1123))
+		if !r.RunAt(at) {
+			return
+		}
+	}
+}
+
+// RunAt counts down to a restart at the given time and restarts the server,
+// returning false if the restarter was stopped
+func (r *Restarter) RunAt(at time.Time) bool {
+	policy := r.options.WhenPlayersOnline
+
+	// Only warn when the restart goes ahead regardless of players, the other
+	// policies restart an empty server
+	if policy == PolicyRestart {
+		for _, warning := range r.options.Warnings {
+			warnAt := at.Add(-warning)
+			if r.now().After(warnAt) {
+				continue // Too late for this warning
+			}
+			if !r.sleepUntil(warnAt) {
+				return false
+			}
+			if r.ready() && r.options.Players() > 0 {
+				r.warn(warning)
+			}
+		}
+	}
+	if !r.sleepUntil(at) {
+		return false
+	}
+
+	if !r.ready() {
+		r.options.Log("Skipping scheduled restart, the server is not running")
+		return true
+	}
+	if players := r.options.Players(); players > 0 {
+		switch policy {
+		case PolicySkip:
+			r.options.Log("Skipping scheduled restart, %d players online", players)
+			return true
+		case PolicyWait:
+			r.options.Log("Scheduled restart waiting for %d players to leave", players)
+			deadline := at.Add(r.options.MaxWait)
+			for r.options.Players() > 0 {
+				if r.options.MaxWait > 0 && !r.now().Before(deadline) {
+					r.options.Log("Skipping scheduled restart, players still online after %v", r.options.MaxWait)
+					return true
+				}
+				if !r.sleep(pollInterval) {
+					return false
+				}
+			}
+		}
+	}
+
+	r.options.Log("Scheduled restart: restarting server")
+	if err := r.options.Restart(); err != nil {
+		r.options.Log("Scheduled restart failed: %v", err)
+		return true
+	}
+	r.options.Log("Scheduled restart complete")
+	return true
+}
+
+// warn tells players how long until the restart
+func (r *Restarter) warn(remaining time.Duration) {
+	Warn(r.options.Send, remaining, "")
+}
+
+// Warn tells players in game how long until a restart, optionally why
+func Warn(send func(command string), remaining time.Duration, reason string) {
+	text := "Server restarting in " + describe(remaining)
+	if reason != "" {
+		text += " " + reason
+	}
+	send("say " + text)
+	send("title @a actionbar " + text)
+}
+
+func (r *Restarter) ready() bool {
+	return r.options.Ready == nil || r.options.Ready()
+}
+
+// sleepUntil sleeps until t, returning immediately if it has passed
+func (r *Restarter) sleepUntil(t time.Time) bool {
+	if d := t.Sub(r.now()); d > 0 {
+		return r.sleep(d)
+	}
+	return true
+}
+
+func (r *Restarter) sleepUntilStopped(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-r.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// describe formats a warning time, e.g. "5 minutes" or "10 seconds"
+func describe(d time.Duration) string {
+	n, unit := int(d/time.Second), "second"
+	if d >= time.Minute && d%time.Minute == 0 {
+		n, unit = int(d/time.Minute), "minute"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return fmt.Sprintf("%d %s", n, unit)
+}
@@ -0,0 +1,177 @@
+package restart
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer records what a restarter does on a fake clock
+type fakeServer struct {
+	now      time.Time
+	players  int
+	leaveAt  time.Time // Players leave at this time when set
+	sent     []string
+	logs     []string
+	restarts []time.Time
+	fail     error
+}
+
+func newTestRestarter(t *testing.T, f *fakeServer, policy string) *Restarter {
+	t.Helper()
+	r, err := New(Options{
+		Schedule:          "04:00",
+		WhenPlayersOnline: policy,
+		MaxWait:           time.Hour,
+		Send:              func(command string) { f.sent = append(f.sent, command) },
+		Players: func() int {
+			if !f.leaveAt.IsZero() && !f.now.Before(f.leaveAt) {
+				return 0
+			}
+			return f.players
+		},
+		Restart: func() error {
+			f.restarts = append(f.restarts, f.now)
+			return f.fail
+		},
+		Log: func(format string, args ...interface{}) {
+			f.logs = append(f.logs, strings.TrimSpace(fmt.Sprintf(format, args...)))
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create restarter: %v", err)
+	}
+	r.now = func() time.Time { return f.now }
+	r.sleep = func(d time.Duration) bool {
+		f.now = f.now.Add(d)
+		return true
+	}
+	return r
+}
+
+var at = time.Date(2024, 3, 15, 4, 0, 0, 0, time.UTC)
+
+func TestRestartCountdown(t *testing.T) {
+	f := &fakeServer{now: at.Add(-time.Hour), players: 2}
+	r := newTestRestarter(t, f, PolicyRestart)
+
+	if !r.RunAt(at) {
+		t.Fatal("Expected the restarter to keep running")
+	}
+	want := []string{
+		"say Server restarting in 15 minutes",
+		"title @a actionbar Server restarting in 15 minutes",
+		"say Server restarting in 5 minutes",
+		"title @a actionbar Server restarting in 5 minutes",
+		"say Server restarting in 1 minute",
+		"title @a actionbar Server restarting in 1 minute",
+		"say Server restarting in 10 seconds",
+		"title @a actionbar Server restarting in 10 seconds",
+	}
+	if !reflect.DeepEqual(f.sent, want) {
+		t.Errorf("Expected warnings %q, got %q", want, f.sent)
+	}
+	if len(f.restarts) != 1 || !f.restarts[0].Equal(at) {
+		t.Errorf("Expected one restart at %v, got %v", at, f.restarts)
+	}
+	if got := f.logs[len(f.logs)-1]; got != "Scheduled restart complete" {
+		t.Errorf("Expected completion logged, got %q", got)
+	}
+}
+
+func TestRestartWarningsAlreadyPassed(t *testing.T) {
+	// Started two minutes before the restart, only later warnings are sent
+	f := &fakeServer{now: at.Add(-2 * time.Minute), players: 1}
+	r := newTestRestarter(t, f, PolicyRestart)
+	r.RunAt(at)
+
+	if len(f.sent) != 4 || !strings.HasSuffix(f.sent[0], "1 minute") {
+		t.Errorf("Expected the 1 minute and 10 second warnings, got %q", f.sent)
+	}
+}
+
+func TestRestartEmptyServerIsNotWarned(t *testing.T) {
+	f := &fakeServer{now: at.Add(-time.Hour)}
+	r := newTestRestarter(t, f, PolicyRestart)
+	r.RunAt(at)
+
+	if len(f.sent) != 0 {
+		t.Errorf("Expected no warnings, got %q", f.sent)
+	}
+	if len(f.restarts) != 1 {
+		t.Errorf("Expected a restart, got %d", len(f.restarts))
+	}
+}
+
+func TestRestartSkipWhenPlayersOnline(t *testing.T) {
+	f := &fakeServer{now: at.Add(-time.Hour), players: 1}
+	r := newTestRestarter(t, f, PolicySkip)
+	r.RunAt(at)
+
+	if len(f.restarts) != 0 || len(f.sent) != 0 {
+		t.Errorf("Expected the restart skipped silently, got restarts %v and commands %q", f.restarts, f.sent)
+	}
+	if len(f.logs) != 1 || !strings.Contains(f.logs[0], "Skipping scheduled restart, 1 players online") {
+		t.Errorf("Expected the skip logged, got %q", f.logs)
+	}
+}
+
+func TestRestartWaitUntilEmpty(t *testing.T) {
+	f := &fakeServer{now: at.Add(-time.Hour), players: 3, leaveAt: at.Add(10 * time.Minute)}
+	r := newTestRestarter(t, f, PolicyWait)
+	r.RunAt(at)
+
+	if len(f.restarts) != 1 {
+		t.Fatalf("Expected a restart, got %d", len(f.restarts))
+	}
+	if f.restarts[0].Before(f.leaveAt) || f.restarts[0].After(f.leaveAt.Add(pollInterval)) {
+		t.Errorf("Expected the restart once players left at %v, got %v", f.leaveAt, f.restarts[0])
+	}
+}
+
+func TestRestartWaitGivesUp(t *testing.T) {
+	f := &fakeServer{now: at.Add(-time.Hour), players: 3}
+	r := newTestRestarter(t, f, PolicyWait)
+	r.RunAt(at)
+
+	if len(f.restarts) != 0 {
+		t.Errorf("Expected no restart, got %d", len(f.restarts))
+	}
+	if got := f.logs[len(f.logs)-1]; !strings.Contains(got, "players still online after 1h0m0s") {
+		t.Errorf("Expected giving up logged, got %q", got)
+	}
+}
+
+func TestRestartFailureIsLogged(t *testing.T) {
+	f := &fakeServer{now: at, fail: errors.New("boom")}
+	r := newTestRestarter(t, f, PolicyRestart)
+	r.RunAt(at)
+
+	if got := f.logs[len(f.logs)-1]; got != "Scheduled restart failed: boom" {
+		t.Errorf("Expected failure logged, got %q", got)
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	daily, err := ParseSchedule("04:30")
+	if err != nil {
+		t.Fatalf("Failed to parse daily time: %v", err)
+	}
+	if next := daily.Next(at); !next.Equal(at.Add(30 * time.Minute)) {
+		t.Errorf("Expected next restart at 04:30, got %v", next)
+	}
+	if _, err := ParseSchedule("0 4 * * sun"); err != nil {
+		t.Errorf("Expected cron expression accepted, got %v", err)
+	}
+	for _, invalid := range []string{"25:00", "4:60", "noon", ""} {
+		if _, err := ParseSchedule(invalid); err == nil {
+			t.Errorf("Expected %q rejected", invalid)
+		}
+	}
+	if _, err := New(Options{Schedule: "04:00", WhenPlayersOnline: "ask"}); err == nil {
+		t.Error("Expected an invalid policy rejected")
+	}
+}
@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Stream identifies where an output line came from
+type Stream string
+
+const (
+	StreamStdout  Stream = "stdout"
+	StreamStderr  Stream = "stderr"
+	StreamWrapper Stream = "wrapper" // Messages generated by the wrapper itself
+)
+
+// Log levels parsed from Bedrock output
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// Line is a single line of output with its metadata
+type Line struct {
+	Seq    uint64    `json:"seq"` // Assigned when the line is published, 0 until then
+	Time   time.Time `json:"time"`
+	Stream Stream    `json:"stream"`
+	Level  string    `json:"level,omitempty"`
+	Text   string    `json:"text"`
+}
+
+// NewLine creates a line captured now, parsing the level from its text
+func NewLine(stream Stream, text string) Line {
+	level := ParseLevel(text)
+	if level == "" && stream == StreamStderr {
+		level = LevelError
+	}
+	return Line{Time: time.Now(), Stream: stream, Level: level, Text: text}
+}
+
+// ParseLevel extracts the log level from a Bedrock log line such as
+// "[2024-01-01 12:00:00:123 INFO] Server started." or "NO LOG FILE! - [] ..."
+// returning an empty string when there is none
+func ParseLevel(text string) string {
+	if !strings.HasPrefix(text, "[") {
+		return ""
+	}
+	end := strings.IndexByte(text, ']')
+	if end < 0 {
+		return ""
+	}
+
+	fields := strings.Fields(text[1:end])
+	if len(fields) == 0 {
+		return ""
+	}
+	switch strings.ToUpper(fields[len(fields)-1]) {
+	case "DEBUG", "VERBOSE":
+		return LevelDebug
+	case "INFO":
+		return LevelInfo
+	case "WARN", "WARNING":
+		return LevelWarn
+	case "ERROR", "FATAL":
+		return LevelError
+	}
+	return ""
+}
+
+// Sequence returns the line's sequence number
+func (l Line) Sequence() uint64 {
+	return l.Seq
+}
+
+// WithSeq returns a copy of the line with the given sequence number
+func (l Line) WithSeq(seq uint64) Line {
+	l.Seq = seq
+	return l
+}
+
+// readLines calls emit with each line read from r without its line ending.
+// Lines longer than maxLength bytes are split rather than stopping the read
+// like bufio.Scanner does, since the command blocks once its output isn't
+// drained.
+func readLines(r io.Reader, maxLength int, emit func(text string)) error {
+	reader := bufio.NewReaderSize(r, maxLength)
+	for {
+		line, _, err := reader.ReadLine()
+		if err != nil {
+			// A pseudo-terminal reports EIO once the command closed it
+			if err == io.EOF || errors.Is(err, syscall.EIO) {
+				return nil
+			}
+			return err
+		}
+		emit(string(line))
+	}
+}
+
+// terminalEscapes matches the colour and cursor control sequences written to
+// a terminal
+var terminalEscapes = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// cleanTerminalText removes control sequences and carriage returns from a
+// line written to a pseudo-terminal
+func cleanTerminalText(text string) string {
+	return strings.TrimRight(terminalEscapes.ReplaceAllString(text, ""), "\r")
+}
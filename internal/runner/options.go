@@ -0,0 +1,76 @@
+package runner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// I/O scheduling classes for Options.IOClass
+const (
+	IOClassRealtime   = "realtime"
+	IOClassBestEffort = "best-effort"
+	IOClassIdle       = "idle"
+)
+
+// DefaultMaxLineLength is the longest output line read in one piece when
+// Options.MaxLineLength is unset, longer lines are split
+const DefaultMaxLineLength = 1024 * 1024
+
+// Options configure the process of a command
+type Options struct {
+	ProcessGroup  bool   // Run in a process group of its own, killed as a whole
+	Nice          int    // Scheduling priority adjustment, 0 keeps the inherited priority
+	IOClass       string // I/O scheduling class, empty keeps the inherited class
+	IOLevel       int    // Priority within the I/O class, 0 (highest) to 7
+	PTY           bool   // Run attached to a pseudo-terminal instead of pipes, in a session of its own
+	MaxLineLength int    // Longest output line in bytes, defaults to DefaultMaxLineLength
+	Limits        Limits // Resource limits of the process, empty keeps the inherited limits
+}
+
+// Validate checks the options are supported
+func (o Options) Validate() error {
+	if o.Nice < -20 || o.Nice > 19 {
+		return fmt.Errorf("invalid nice value %d: expected -20 to 19", o.Nice)
+	}
+	switch o.IOClass {
+	case "", IOClassRealtime, IOClassBestEffort, IOClassIdle:
+	default:
+		return fmt.Errorf("invalid I/O class %q: expected realtime, best-effort or idle", o.IOClass)
+	}
+	if o.IOLevel < 0 || o.IOLevel > 7 {
+		return fmt.Errorf("invalid I/O priority %d: expected 0 to 7", o.IOLevel)
+	}
+	if o.MaxLineLength < 0 {
+		return fmt.Errorf("invalid max line length %d", o.MaxLineLength)
+	}
+	for _, value := range []string{o.Limits.NoFile, o.Limits.Core} {
+		if _, _, err := parseLimit(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Limits are resource limits set on a command once it starts, leaving the
+// wrapper's own limits alone. Values are a number or "unlimited", empty
+// keeps the inherited limit.
+type Limits struct {
+	NoFile string // Open files
+	Core   string // Core dump size in bytes, "0" disables core dumps
+}
+
+// parseLimit parses a limit value, reporting false when it is empty
+func parseLimit(value string) (uint64, bool, error) {
+	switch strings.TrimSpace(value) {
+	case "":
+		return 0, false, nil
+	case "unlimited", "infinity":
+		return rlimInfinity, true, nil
+	}
+	n, err := strconv.ParseUint(strings.TrimSpace(value), 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid limit %q: expected a number or unlimited", value)
+	}
+	return n, true, nil
+}
@@ -0,0 +1,57 @@
+package runner
+
+import "testing"
+
+func TestOptionsValidate(t *testing.T) {
+	valid := []Options{
+		{},
+		{ProcessGroup: true, Nice: 10, IOClass: IOClassIdle},
+		{Nice: -20, IOClass: IOClassBestEffort, IOLevel: 7},
+		{Limits: Limits{NoFile: "unlimited", Core: "0"}},
+	}
+	for _, options := range valid {
+		if err := options.Validate(); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", options, err)
+		}
+	}
+
+	invalid := []Options{
+		{Nice: 20},
+		{Nice: -21},
+		{IOClass: "fast"},
+		{IOClass: IOClassBestEffort, IOLevel: 8},
+		{MaxLineLength: -1},
+		{Limits: Limits{Core: "none"}},
+	}
+	for _, options := range invalid {
+		if err := options.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", options)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  uint64
+		set   bool
+		err   bool
+	}{
+		{"", 0, false, false},
+		{"1048576", 1048576, true, false},
+		{" 0 ", 0, true, false},
+		{"unlimited", rlimInfinity, true, false},
+		{"lots", 0, false, true},
+		{"-1", 0, false, true},
+	}
+	for _, test := range tests {
+		got, set, err := parseLimit(test.value)
+		if (err != nil) != test.err {
+			t.Errorf("parseLimit(%q): expected error %v, got %v", test.value, test.err, err)
+			continue
+		}
+		if got != test.want || set != test.set {
+			t.Errorf("parseLimit(%q) = %d, %v, expected %d, %v", test.value, got, set, test.want, test.set)
+		}
+	}
+}
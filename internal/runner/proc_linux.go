@@ -0,0 +1,126 @@
+//go:build linux
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+const rlimInfinity = ^uint64(0)
+
+// ioprio_set(2) constants
+const (
+	ioprioWhoProcess = 1
+	ioprioWhoPgrp    = 2
+	ioprioClassShift = 13
+)
+
+var ioClasses = map[string]int{IOClassRealtime: 1, IOClassBestEffort: 2, IOClassIdle: 3}
+
+// applyLimits sets the resource limits of a started process with prlimit(2),
+// so they apply to it and whatever it starts but not to the wrapper
+func (o Options) applyLimits(pid int) error {
+	for _, limit := range []struct {
+		name     string
+		resource int
+		value    string
+	}{
+		{"open files", syscall.RLIMIT_NOFILE, o.Limits.NoFile},
+		{"core size", syscall.RLIMIT_CORE, o.Limits.Core},
+	} {
+		n, ok, err := parseLimit(limit.value)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		rlimit := syscall.Rlimit{Cur: n, Max: n}
+		var current syscall.Rlimit
+		if err := prlimit(pid, limit.resource, nil, &current); err == nil && n < current.Max {
+			rlimit.Max = current.Max // Keep the hard limit so it can be raised again
+		}
+		if err := prlimit(pid, limit.resource, &rlimit, nil); err != nil {
+			return fmt.Errorf("error setting %s limit to %s: %v", limit.name, limit.value, err)
+		}
+	}
+	return nil
+}
+
+// prlimit gets or sets a resource limit of another process
+func prlimit(pid, resource int, limit, old *syscall.Rlimit) error {
+	_, _, errno := syscall.RawSyscall6(syscall.SYS_PRLIMIT64, uintptr(pid), uintptr(resource),
+		uintptr(unsafe.Pointer(limit)), uintptr(unsafe.Pointer(old)), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// configure sets the process attributes of a command before it starts. A
+// command on a pseudo-terminal leads a session, and so a process group, with
+// the terminal on its stdin as the controlling terminal.
+func (o Options) configure(cmd *exec.Cmd) {
+	switch {
+	case o.PTY:
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	case o.ProcessGroup:
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	}
+}
+
+// applyPriority sets the CPU and I/O priority of a started process. Both
+// only apply to a single thread when given a pid, so a process leading its
+// own group is set through the group and any other process thread by
+// thread. Threads created afterwards inherit them.
+func (o Options) applyPriority(pid int) error {
+	which, ioWho, ids := syscall.PRIO_PROCESS, ioprioWhoProcess, threads(pid)
+	if o.ProcessGroup || o.PTY {
+		which, ioWho, ids = syscall.PRIO_PGRP, ioprioWhoPgrp, []int{pid}
+	}
+
+	for _, id := range ids {
+		// A thread may exit between listing and setting it
+		exited := func(err error) bool { return err == syscall.ESRCH && id != pid }
+		if o.Nice != 0 {
+			if err := syscall.Setpriority(which, id, o.Nice); err != nil && !exited(err) {
+				return fmt.Errorf("error setting nice value %d: %v", o.Nice, err)
+			}
+		}
+		if o.IOClass != "" {
+			prio := ioClasses[o.IOClass]<<ioprioClassShift | o.IOLevel
+			if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, uintptr(ioWho), uintptr(id), uintptr(prio)); errno != 0 && !exited(errno) {
+				return fmt.Errorf("error setting I/O priority %s/%d: %v", o.IOClass, o.IOLevel, errno)
+			}
+		}
+	}
+	return nil
+}
+
+// threads lists the thread ids of a process, just the pid when they can't be read
+func threads(pid int) []int {
+	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return []int{pid}
+	}
+	var ids []int
+	for _, entry := range entries {
+		if id, err := strconv.Atoi(entry.Name()); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return []int{pid}
+	}
+	return ids
+}
+
+// killGroup kills the process group led by pid
+func killGroup(pid int) error {
+	return syscall.Kill(-pid, syscall.SIGKILL)
+}
@@ -0,0 +1,175 @@
+//go:build linux
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunner_KillProcessGroup(t *testing.T) {
+	// The script leaves a child holding its output open
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "spawn.sh")
+	script := "#!/bin/sh\nsleep 60 &\necho $!\nwait\n"
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	r := NewWithOptions(Options{ProcessGroup: true}, scriptPath)
+	if err := r.Start(); err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+
+	var child int
+	select {
+	case line := <-r.GetOutputChan():
+		var err error
+		if child, err = strconv.Atoi(line.Text); err != nil {
+			t.Fatalf("Expected the child pid, got %q", line.Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the child pid")
+	}
+
+	if err := r.Kill(); err != nil {
+		t.Fatalf("Failed to kill process group: %v", err)
+	}
+	go func() {
+		for range r.GetOutputChan() {
+		}
+	}()
+	select {
+	case <-r.Done():
+	case <-time.After(5 * time.Second):
+		syscall.Kill(child, syscall.SIGKILL)
+		t.Fatal("Timed out waiting for the process group to exit")
+	}
+	// The orphaned child may linger as a zombie until it is reaped
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", child))
+		if err != nil || strings.Contains(string(stat), ") Z ") {
+			break
+		}
+		if time.Now().After(deadline) {
+			syscall.Kill(child, syscall.SIGKILL)
+			t.Fatalf("Expected child %d to be killed with the group", child)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRunner_Nice(t *testing.T) {
+	r := NewWithOptions(Options{Nice: 5}, "sleep", "10")
+	if err := r.Start(); err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+	defer func() {
+		r.Kill()
+		r.Wait()
+	}()
+
+	// getpriority(2) returns 20 - nice for the raw syscall
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, r.Pid())
+	if err != nil {
+		t.Fatalf("Failed to read priority: %v", err)
+	}
+	own, _ := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+	if nice := 20 - prio; nice != min(20-own+5, 19) {
+		t.Errorf("Expected nice %d, got %d", min(20-own+5, 19), nice)
+	}
+}
+
+func TestRunner_NiceProcessGroup(t *testing.T) {
+	r := NewWithOptions(Options{Nice: 5, ProcessGroup: true}, "sleep", "10")
+	if err := r.Start(); err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+	defer func() {
+		r.Kill()
+		r.Wait()
+	}()
+
+	// The whole group is reniced, not just the thread with the pid
+	prio, err := syscall.Getpriority(syscall.PRIO_PGRP, r.Pid())
+	if err != nil {
+		t.Fatalf("Failed to read group priority: %v", err)
+	}
+	own, _ := syscall.Getpriority(syscall.PRIO_PROCESS, 0)
+	if nice := 20 - prio; nice != min(20-own+5, 19) {
+		t.Errorf("Expected group nice %d, got %d", min(20-own+5, 19), nice)
+	}
+}
+
+func TestRunner_Limits(t *testing.T) {
+	var own syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &own); err != nil {
+		t.Fatalf("Failed to read own limit: %v", err)
+	}
+
+	r := NewWithOptions(Options{Limits: Limits{NoFile: "64", Core: "0"}}, "sleep", "10")
+	if err := r.Start(); err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+	defer func() {
+		r.Kill()
+		r.Wait()
+	}()
+
+	var noFile, core syscall.Rlimit
+	if err := prlimit(r.Pid(), syscall.RLIMIT_NOFILE, nil, &noFile); err != nil {
+		t.Fatalf("Failed to read open files limit: %v", err)
+	}
+	if err := prlimit(r.Pid(), syscall.RLIMIT_CORE, nil, &core); err != nil {
+		t.Fatalf("Failed to read core size limit: %v", err)
+	}
+	if noFile.Cur != 64 || core.Cur != 0 {
+		t.Errorf("Expected limits 64 and 0, got %d and %d", noFile.Cur, core.Cur)
+	}
+
+	// The wrapper keeps its own limits
+	var after syscall.Rlimit
+	syscall.Getrlimit(syscall.RLIMIT_NOFILE, &after)
+	if after != own {
+		t.Errorf("Expected own open files limit %+v to be unchanged, got %+v", own, after)
+	}
+}
+
+func TestRunner_LimitsFailure(t *testing.T) {
+	var own syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &own); err != nil {
+		t.Fatalf("Failed to read own limit: %v", err)
+	}
+	if own.Max == rlimInfinity {
+		t.Skip("No hard limit to exceed")
+	}
+	if syscall.Setrlimit(syscall.RLIMIT_NOFILE, &syscall.Rlimit{Cur: own.Cur, Max: own.Max + 1}) == nil {
+		syscall.Setrlimit(syscall.RLIMIT_NOFILE, &own)
+		t.Skip("Running with CAP_SYS_RESOURCE")
+	}
+
+	// The server doesn't run when its limits can't be set
+	r := NewWithOptions(Options{Limits: Limits{NoFile: "unlimited"}}, "sleep", "10")
+	if err := r.Start(); err == nil {
+		r.Kill()
+		r.Wait()
+		t.Fatal("Expected an error raising the limit past the hard limit")
+	}
+}
+
+func TestThreads(t *testing.T) {
+	ids := threads(os.Getpid())
+	if len(ids) < 2 {
+		t.Errorf("Expected the threads of the test binary, got %v", ids)
+	}
+	if ids := threads(-1); len(ids) != 1 || ids[0] != -1 {
+		t.Errorf("Expected the pid back when threads can't be read, got %v", ids)
+	}
+}
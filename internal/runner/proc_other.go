@@ -0,0 +1,32 @@
+//go:build !linux
+
+package runner
+
+import (
+	"errors"
+	"os/exec"
+)
+
+const rlimInfinity = ^uint64(0)
+
+var errUnsupported = errors.New("process limits and priorities are only supported on Linux")
+
+func (o Options) applyLimits(pid int) error {
+	if o.Limits.NoFile != "" || o.Limits.Core != "" {
+		return errUnsupported
+	}
+	return nil
+}
+
+func (o Options) configure(cmd *exec.Cmd) {}
+
+func (o Options) applyPriority(pid int) error {
+	if o.Nice != 0 || o.IOClass != "" {
+		return errUnsupported
+	}
+	return nil
+}
+
+func killGroup(pid int) error {
+	return errUnsupported
+}
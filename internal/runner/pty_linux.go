@@ -0,0 +1,68 @@
+//go:build linux
+
+package runner
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// openPTY opens a pseudo-terminal, returning its master side and the
+// terminal the command runs on. Echo is turned off so input isn't repeated
+// in the output.
+func openPTY() (*os.File, *os.File, error) {
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening pseudo-terminal: %v", err)
+	}
+
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("error unlocking pseudo-terminal: %v", err)
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("error reading pseudo-terminal number: %v", err)
+	}
+	tty, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("error opening pseudo-terminal: %v", err)
+	}
+
+	var termios syscall.Termios
+	err = ioctl(tty, syscall.TCGETS, unsafe.Pointer(&termios))
+	if err == nil {
+		termios.Lflag &^= syscall.ECHO | syscall.ECHONL
+		err = ioctl(tty, syscall.TCSETS, unsafe.Pointer(&termios))
+	}
+	if err != nil {
+		master.Close()
+		tty.Close()
+		return nil, nil, fmt.Errorf("error turning off pseudo-terminal echo: %v", err)
+	}
+	return master, tty, nil
+}
+
+// ioctl runs a request on the file without taking it out of the runtime
+// poller, so reads can still be interrupted by Close
+func ioctl(f *os.File, request uintptr, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
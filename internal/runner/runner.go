@@ -1,8 +1,8 @@
 package runner
 
 import (
-	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"sync"
@@ -11,92 +11,153 @@ import (
 // Runner manages the execution of a command and its I/O
 type Runner struct {
 	cmd        *exec.Cmd
+	options    Options
 	stdin      chan string
-	outputChan chan string   // Channel for streaming output
+	outputChan chan Line     // Channel for streaming output
 	done       chan struct{} // Channel to signal when the command is done
+	err        error         // Exit error, set before done is closed
 }
 
 // New creates a new Runner instance
 func New(command string, args ...string) *Runner {
+	return NewWithOptions(Options{}, command, args...)
+}
+
+// NewWithOptions creates a Runner whose process is configured by options
+func NewWithOptions(options Options, command string, args ...string) *Runner {
 	return &Runner{
 		cmd:        exec.Command(command, args...),
+		options:    options,
 		stdin:      make(chan string),
-		outputChan: make(chan string, 100), // Buffered channel for output
+		outputChan: make(chan Line, 100), // Buffered channel for output
 		done:       make(chan struct{}),
 	}
 }
 
 // Start begins the command execution and sets up I/O handling
 func (r *Runner) Start() error {
-	// Create stdin pipe
-	stdin, err := r.cmd.StdinPipe()
-	if err != nil {
-		return fmt.Errorf("error creating stdin pipe: %v", err)
-	}
+	var (
+		stdin   io.WriteCloser
+		outputs map[Stream]io.Reader
+		closers []io.Closer // Closed once the command exited
+	)
+	if r.options.PTY {
+		master, tty, err := openPTY()
+		if err != nil {
+			return err
+		}
+		// The command's output is all on the terminal, reported as stdout
+		r.cmd.Stdin, r.cmd.Stdout, r.cmd.Stderr = tty, tty, tty
+		stdin = master
+		outputs = map[Stream]io.Reader{StreamStdout: master}
+		closers = []io.Closer{master}
+		defer tty.Close() // Only the command keeps the terminal open
+	} else {
+		// Create stdin pipe
+		stdinPipe, err := r.cmd.StdinPipe()
+		if err != nil {
+			return fmt.Errorf("error creating stdin pipe: %v", err)
+		}
 
-	// Create stdout pipe
-	stdout, err := r.cmd.StdoutPipe()
-	if err != nil {
-		return fmt.Errorf("error creating stdout pipe: %v", err)
-	}
+		// Create stdout pipe
+		stdout, err := r.cmd.StdoutPipe()
+		if err != nil {
+			return fmt.Errorf("error creating stdout pipe: %v", err)
+		}
 
-	// Create stderr pipe
-	stderr, err := r.cmd.StderrPipe()
-	if err != nil {
-		return fmt.Errorf("error creating stderr pipe: %v", err)
+		// Create stderr pipe
+		stderr, err := r.cmd.StderrPipe()
+		if err != nil {
+			return fmt.Errorf("error creating stderr pipe: %v", err)
+		}
+		stdin = stdinPipe
+		outputs = map[Stream]io.Reader{StreamStdout: stdout, StreamStderr: stderr}
 	}
 
 	// Start command
+	r.options.configure(r.cmd)
 	if err := r.cmd.Start(); err != nil {
+		for _, closer := range closers {
+			closer.Close()
+		}
 		return fmt.Errorf("error starting command: %v", err)
 	}
-
-	// Create scanners for stdout and stderr
-	outScanner := bufio.NewScanner(stdout)
-	errScanner := bufio.NewScanner(stderr)
-
-	// Create a WaitGroup to coordinate the scanner goroutines
-	var scanners sync.WaitGroup
-	scanners.Add(2)
-
-	// Start goroutine to scan stdout
-	go func() {
-		defer scanners.Done()
-		for outScanner.Scan() {
-			select {
-			case r.outputChan <- outScanner.Text():
-			default:
-				// Channel is full, discard output
-			}
+	if err := r.options.applyLimits(r.cmd.Process.Pid); err != nil {
+		// The server must not run without the limits asked for
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+		for _, closer := range closers {
+			closer.Close()
 		}
-	}()
+		return err
+	}
+	if err := r.options.applyPriority(r.cmd.Process.Pid); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
 
-	// Start goroutine to scan stderr
-	go func() {
-		defer scanners.Done()
-		for errScanner.Scan() {
-			select {
-			case r.outputChan <- "[ERR] " + errScanner.Text():
-			default:
-				// Channel is full, discard output
+	maxLength := r.options.MaxLineLength
+	if maxLength <= 0 {
+		maxLength = DefaultMaxLineLength
+	}
+
+	// Create a WaitGroup to coordinate the reader goroutines
+	var readers sync.WaitGroup
+	readers.Add(len(outputs))
+
+	// Start a goroutine to read each output stream
+	for stream, output := range outputs {
+		go func() {
+			defer readers.Done()
+			err := readLines(output, maxLength, func(text string) {
+				if r.options.PTY {
+					text = cleanTerminalText(text)
+				}
+				// Block rather than drop, the consumer must keep up
+				r.outputChan <- NewLine(stream, text)
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", stream, err)
+				io.Copy(io.Discard, output) // Keep the command from blocking
 			}
-		}
-	}()
+		}()
+	}
 
 	// Start goroutine to manage output channel closure
 	go func() {
-		scanners.Wait()     // Wait for both scanners to complete
+		readers.Wait()      // Wait for all output to be read
 		close(r.outputChan) // Then close the output channel
+
+		// Reap the process once its output is fully read
+		r.err = r.cmd.Wait()
+		for _, closer := range closers {
+			closer.Close()
+		}
+		close(r.done)
 	}()
 
-	// Start goroutine to forward input to the process
+	// Start goroutine to forward input to the process until it exits. After
+	// a write error input is dropped, so WriteInput never blocks on a
+	// broken pipe.
 	go func() {
-		defer stdin.Close() // Ensure stdin is closed when done
-		for input := range r.stdin {
-			input = input + "\n"
-			_, err := stdin.Write([]byte(input))
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error writing to stdin: %v\n", err)
+		if !r.options.PTY {
+			defer stdin.Close() // Ensure stdin is closed when done
+		}
+		broken := false
+		for {
+			select {
+			case input, ok := <-r.stdin:
+				if !ok {
+					return
+				}
+				if broken {
+					fmt.Fprintf(os.Stderr, "Dropping input %q, stdin is closed\n", input)
+					continue
+				}
+				if _, err := stdin.Write([]byte(input + "\n")); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing to stdin: %v\n", err)
+					broken = true
+				}
+			case <-r.done:
 				return
 			}
 		}
@@ -105,13 +166,19 @@ func (r *Runner) Start() error {
 	return nil
 }
 
-// WriteInput sends input to the running command
+// WriteInput sends input to the running command. Input sent after the
+// command exited is dropped.
 func (r *Runner) WriteInput(input string) {
-	r.stdin <- input
+	select {
+	case r.stdin <- input:
+	case <-r.done:
+	}
 }
 
-// GetOutputChan returns a channel that receives command output in real-time
-func (r *Runner) GetOutputChan() <-chan string {
+// GetOutputChan returns a channel that receives command output in real-time.
+// Lines are never dropped, so the channel must be drained or the command
+// will eventually block writing its output.
+func (r *Runner) GetOutputChan() <-chan Line {
 	return r.outputChan
 }
 
@@ -122,5 +189,26 @@ func (r *Runner) Done() <-chan struct{} {
 
 // Wait waits for the command to complete
 func (r *Runner) Wait() error {
-	return r.cmd.Wait()
+	<-r.done
+	return r.err
+}
+
+// Kill forcibly terminates the command, with its process group when it
+// runs in one
+func (r *Runner) Kill() error {
+	if r.cmd.Process == nil {
+		return fmt.Errorf("process not started")
+	}
+	if r.options.ProcessGroup || r.options.PTY {
+		return killGroup(r.cmd.Process.Pid)
+	}
+	return r.cmd.Process.Kill()
+}
+
+// Pid returns the process id of the command, 0 before it started
+func (r *Runner) Pid() int {
+	if r.cmd.Process == nil {
+		return 0
+	}
+	return r.cmd.Process.Pid
 }
@@ -56,7 +56,7 @@ func TestRunner_BasicIO(t *testing.T) {
 		"special chars: !@#$%",
 	}
 	// Channel to collect outputs
-	outputs := make([]string, 0)
+	outputs := make([]Line, 0)
 	done := make(chan struct{})
 
 	// Start collecting outputs
@@ -100,10 +100,10 @@ func TestRunner_BasicIO(t *testing.T) {
 		foundStderr := false
 
 		for _, output := range outputs {
-			if strings.Contains(output, "ECHO: "+input) {
+			if output.Stream == StreamStdout && strings.Contains(output.Text, "ECHO: "+input) {
 				foundStdout = true
 			}
-			if strings.Contains(output, "ERROR: "+input) {
+			if output.Stream == StreamStderr && strings.Contains(output.Text, "ERROR: "+input) {
 				foundStderr = true
 			}
 		}
@@ -134,7 +134,7 @@ func TestRunner_LargeInput(t *testing.T) {
 	largeInput := strings.Repeat(pattern, 1000) // ~36KB of repeating pattern
 
 	// Channel to collect outputs
-	outputs := make([]string, 0)
+	outputs := make([]Line, 0)
 	done := make(chan struct{})
 	found := make(chan struct{})
 
@@ -144,8 +144,8 @@ func TestRunner_LargeInput(t *testing.T) {
 		for output := range r.GetOutputChan() {
 			outputs = append(outputs, output)
 			// Check if we found our input
-			if strings.HasPrefix(output, "ECHO: ") {
-				echoed := strings.TrimPrefix(output, "ECHO: ")
+			if strings.HasPrefix(output.Text, "ECHO: ") {
+				echoed := strings.TrimPrefix(output.Text, "ECHO: ")
 				if echoed == largeInput {
 					close(found)
 				}
@@ -168,9 +168,9 @@ func TestRunner_LargeInput(t *testing.T) {
 	case <-time.After(5 * time.Second):
 		t.Errorf("Large input was not properly echoed after 5 seconds. Got %d lines of output", len(outputs))
 		if len(outputs) > 0 {
-			t.Logf("First output line: %s", outputs[0])
+			t.Logf("First output line: %s", outputs[0].Text)
 			if len(outputs) > 1 {
-				t.Logf("Second output line: %s", outputs[1])
+				t.Logf("Second output line: %s", outputs[1].Text)
 			}
 		}
 	}
@@ -197,7 +197,7 @@ func TestRunner_MultipleWriters(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Channel to collect outputs
-	outputs := make([]string, 0)
+	outputs := make([]Line, 0)
 	done := make(chan struct{})
 
 	// Start collecting outputs
@@ -249,8 +249,8 @@ func TestRunner_MultipleWriters(t *testing.T) {
 	writesFound := make(map[string]bool)
 
 	for _, output := range outputs {
-		if strings.HasPrefix(output, "ECHO: writer-") {
-			writesFound[output] = true
+		if strings.HasPrefix(output.Text, "ECHO: writer-") {
+			writesFound[output.Text] = true
 		}
 	}
 
@@ -259,3 +259,166 @@ func TestRunner_MultipleWriters(t *testing.T) {
 		t.Errorf("Expected %d unique writes, found %d", expectedWrites, len(writesFound))
 	}
 }
+
+func TestRunner_NoDroppedOutput(t *testing.T) {
+	// Print far more lines than the output channel can hold
+	const numLines = 5000
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "flood.sh")
+	script := fmt.Sprintf("#!/bin/sh\ni=0\nwhile [ $i -lt %d ]; do echo \"line $i\"; i=$((i+1)); done\n", numLines)
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	r := New(scriptPath)
+	if err := r.Start(); err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+
+	// Let the process fill the channel before anyone reads
+	time.Sleep(200 * time.Millisecond)
+
+	count := 0
+	for output := range r.GetOutputChan() {
+		if output.Text != fmt.Sprintf("line %d", count) {
+			t.Fatalf("Expected line %d, got %q", count, output.Text)
+		}
+		count++
+	}
+	if err := r.Wait(); err != nil {
+		t.Fatalf("Process failed: %v", err)
+	}
+
+	if count != numLines {
+		t.Errorf("Expected %d lines, got %d", numLines, count)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]string{
+		"[2024-01-01 12:00:00:123 INFO] Server started.":             LevelInfo,
+		"[2024-01-01 12:00:00:123 WARN] Content log file is missing": LevelWarn,
+		"[2024-01-01 12:00:00:123 ERROR] Failed to load":             LevelError,
+		"NO LOG FILE! - setting up server logging...":                "",
+		"[no closing bracket":                                        "",
+	}
+	for text, want := range tests {
+		if got := ParseLevel(text); got != want {
+			t.Errorf("ParseLevel(%q) = %q, want %q", text, got, want)
+		}
+	}
+
+	if line := NewLine(StreamStderr, "plain error"); line.Level != LevelError || line.Time.IsZero() {
+		t.Errorf("Expected stderr lines to default to error level, got %+v", line)
+	}
+}
+
+func TestRunner_LongLines(t *testing.T) {
+	// bufio.Scanner stops at 64KB, the command must be read past it
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "long.sh")
+	script := "#!/bin/sh\nhead -c 200000 /dev/zero | tr '\\0' 'x'\necho\necho done\n"
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	tests := []struct {
+		maxLength int
+		lines     int
+	}{
+		{0, 2},         // The default holds the whole line
+		{64 * 1024, 5}, // Split into 4 pieces
+	}
+	for _, test := range tests {
+		r := NewWithOptions(Options{MaxLineLength: test.maxLength}, scriptPath)
+		if err := r.Start(); err != nil {
+			t.Fatalf("Failed to start runner: %v", err)
+		}
+		var lines []string
+		for output := range r.GetOutputChan() {
+			lines = append(lines, output.Text)
+		}
+		if err := r.Wait(); err != nil {
+			t.Fatalf("Process failed: %v", err)
+		}
+
+		if len(lines) != test.lines {
+			t.Fatalf("Max length %d: expected %d lines, got %d", test.maxLength, test.lines, len(lines))
+		}
+		if got := strings.Join(lines[:len(lines)-1], ""); got != strings.Repeat("x", 200000) {
+			t.Errorf("Max length %d: expected the long line in full, got %d bytes", test.maxLength, len(got))
+		}
+		if lines[len(lines)-1] != "done" {
+			t.Errorf("Max length %d: expected output after the long line, got %q", test.maxLength, lines[len(lines)-1])
+		}
+	}
+}
+
+func TestRunner_PTY(t *testing.T) {
+	// The script reports whether it's on a terminal and echoes input in colour
+	tmpDir := t.TempDir()
+	scriptPath := filepath.Join(tmpDir, "tty.sh")
+	script := `#!/bin/sh
+if [ -t 0 ] && [ -t 1 ]; then echo "terminal"; else echo "pipes"; fi
+echo "error output" >&2
+while IFS= read -r line; do
+    printf '\033[32mECHO: %s\033[0m\n' "$line"
+done
+`
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+
+	r := NewWithOptions(Options{PTY: true}, scriptPath)
+	if err := r.Start(); err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+	r.WriteInput("hello")
+
+	var lines []Line
+	timeout := time.After(5 * time.Second)
+	for len(lines) < 3 {
+		select {
+		case line := <-r.GetOutputChan():
+			lines = append(lines, line)
+		case <-timeout:
+			t.Fatalf("Timed out waiting for output, got %v", lines)
+		}
+	}
+
+	want := []string{"terminal", "error output", "ECHO: hello"}
+	for i, line := range lines {
+		if line.Text != want[i] {
+			t.Errorf("Expected line %d to be %q, got %q", i, want[i], line.Text)
+		}
+		if line.Stream != StreamStdout {
+			t.Errorf("Expected terminal output on stdout, got %s", line.Stream)
+		}
+	}
+
+	if err := r.Kill(); err != nil {
+		t.Fatalf("Failed to kill process: %v", err)
+	}
+	select {
+	case <-r.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the process to exit")
+	}
+}
+
+func TestCleanTerminalText(t *testing.T) {
+	tests := map[string]string{
+		"plain":                                   "plain",
+		"line ending\r":                           "line ending",
+		"\x1b[32mgreen\x1b[0m":                    "green",
+		"\x1b[1;31m[ERROR]\x1b[m failed":          "[ERROR] failed",
+		"\x1b]0;bedrock_server\x07title":          "title",
+		"\x1b[2K\x1b[?25lcleared":                 "cleared",
+		"[2024-01-01 12:00:00:123 INFO] Started.": "[2024-01-01 12:00:00:123 INFO] Started.",
+	}
+	for text, want := range tests {
+		if got := cleanTerminalText(text); got != want {
+			t.Errorf("cleanTerminalText(%q) = %q, expected %q", text, got, want)
+		}
+	}
+}
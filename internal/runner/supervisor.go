@@ -0,0 +1,284 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultStopTimeout is how long Stop waits for a graceful shutdown before
+// killing the process
+const DefaultStopTimeout = 30 * time.Second
+
+var ErrNotRunning = errors.New("server is not running")
+
+// Supervisor runs a command that can be stopped and started again, e.g. for
+// scheduled restarts. Output from every run is forwarded to one channel that
+// stays open until the process exits without being asked to.
+type Supervisor struct {
+	command string
+	args    []string
+	out     chan Line
+
+	// OnRestart, when set, is called after the old process stopped and
+	// before the new one starts
+	OnRestart func()
+
+	// Options configure every run's process
+	Options Options
+
+	exclusive sync.Mutex // Held for a whole restart, see Exclusive
+
+	mu       sync.Mutex
+	current  *Runner
+	started  time.Time
+	restarts int
+	restart  bool // A restart is in progress
+	closed   bool
+	trial    bool // The current run's exit doesn't end the supervisor
+
+	forwarded chan struct{} // Closed when the current run's output is forwarded
+	done      chan struct{} // Closed when the supervisor terminates
+	err       error
+}
+
+// NewSupervisor creates a supervisor for the command, it is started with Start
+func NewSupervisor(command string, args ...string) *Supervisor {
+	return &Supervisor{
+		command: command,
+		args:    args,
+		out:     make(chan Line, 100),
+		done:    make(chan struct{}),
+	}
+}
+
+// Start starts a new run of the command
+func (s *Supervisor) Start() error {
+	return s.start(false)
+}
+
+// StartTrial starts a run whose exit doesn't end the supervisor until
+// Commit is called, e.g. so a failed upgrade can be rolled back
+func (s *Supervisor) StartTrial() error {
+	return s.start(true)
+}
+
+// Commit ends the trial of the current run
+func (s *Supervisor) Commit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.trial = false
+}
+
+func (s *Supervisor) start(trial bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errors.New("supervisor is closed")
+	}
+	if s.current != nil {
+		return errors.New("server is already running")
+	}
+
+	r := NewWithOptions(s.Options, s.command, s.args...)
+	if err := r.Start(); err != nil {
+		return err
+	}
+	forwarded := make(chan struct{})
+	s.current, s.started, s.forwarded, s.trial = r, time.Now(), forwarded, trial
+	go s.forward(r, forwarded)
+	return nil
+}
+
+// forward copies a run's output to the shared channel. If the run ends
+// while it is still current nobody asked it to stop, which ends the
+// supervisor unless the run is on trial.
+func (s *Supervisor) forward(r *Runner, forwarded chan struct{}) {
+	for line := range r.GetOutputChan() {
+		s.out <- line
+	}
+	err := r.Wait()
+	close(forwarded)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == r {
+		s.current = nil
+		if s.trial {
+			fmt.Printf("Server exited during its trial run: %v\n", err)
+			return
+		}
+		s.terminateLocked(err)
+	}
+}
+
+// Stop asks the server to stop with the "stop" command and waits for it to
+// exit, killing it after timeout
+func (s *Supervisor) Stop(timeout time.Duration) error {
+	s.mu.Lock()
+	r, forwarded := s.current, s.forwarded
+	s.current = nil // The exit is expected from now on
+	s.mu.Unlock()
+	if r == nil {
+		return ErrNotRunning
+	}
+
+	// Sent in the background so a stdin that isn't being read can't hold
+	// up the kill, WriteInput returns once the process exits
+	go r.WriteInput("stop")
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-forwarded:
+		return nil
+	case <-timer.C:
+	}
+
+	fmt.Printf("Server did not stop within %v, killing it\n", timeout)
+	if err := r.Kill(); err != nil {
+		return fmt.Errorf("error killing server: %v", err)
+	}
+	<-forwarded
+	return nil
+}
+
+// Restart gracefully stops the server and starts it again
+func (s *Supervisor) Restart(timeout time.Duration) error {
+	return s.Exclusive(func() error {
+		if err := s.Stop(timeout); err != nil && err != ErrNotRunning {
+			return err
+		}
+		if s.OnRestart != nil {
+			s.OnRestart()
+		}
+		if err := s.Start(); err != nil {
+			return fmt.Errorf("error restarting server: %w", err)
+		}
+
+		s.mu.Lock()
+		s.restarts++
+		s.mu.Unlock()
+		return nil
+	})
+}
+
+// Exclusive runs fn, which stops and starts the server, reporting the
+// server as restarting meanwhile. Restarts and other calls wait for it to
+// finish so they don't interleave. If fn fails and leaves the server
+// stopped nothing will start it again, so the supervisor ends with the
+// error and Wait returns instead of the wrapper idling without a server.
+func (s *Supervisor) Exclusive(fn func() error) error {
+	s.exclusive.Lock()
+	defer s.exclusive.Unlock()
+	s.setRestarting(true)
+	defer s.setRestarting(false)
+
+	err := fn()
+	if err != nil {
+		s.mu.Lock()
+		if s.current == nil {
+			s.terminateLocked(err)
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// Shutdown stops the server if it is running and ends the supervisor
+func (s *Supervisor) Shutdown(timeout time.Duration) error {
+	err := s.Stop(timeout)
+	if err == ErrNotRunning {
+		err = nil
+	}
+
+	s.terminate(nil)
+	return err
+}
+
+// terminate ends the supervisor with err, see Wait
+func (s *Supervisor) terminate(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.terminateLocked(err)
+}
+
+func (s *Supervisor) terminateLocked(err error) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	close(s.out)
+	close(s.done)
+}
+
+// WriteInput sends input to the running server, it is dropped while the
+// server is stopped
+func (s *Supervisor) WriteInput(input string) {
+	s.mu.Lock()
+	r := s.current
+	s.mu.Unlock()
+	if r == nil {
+		fmt.Printf("Server is not running, dropping input %q\n", input)
+		return
+	}
+	r.WriteInput(input)
+}
+
+// GetOutputChan returns the output of every run. It is closed when the
+// supervisor ends, so it must be drained like a Runner's.
+func (s *Supervisor) GetOutputChan() <-chan Line {
+	return s.out
+}
+
+// Running reports whether the server process is running
+func (s *Supervisor) Running() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current != nil
+}
+
+// Pid returns the process id of the running server, 0 when stopped
+func (s *Supervisor) Pid() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil {
+		return 0
+	}
+	return s.current.Pid()
+}
+
+// StartedAt returns when the current run started
+func (s *Supervisor) StartedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.started
+}
+
+// Restarts returns how many times the server was restarted
+func (s *Supervisor) Restarts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restarts
+}
+
+// Restarting reports whether a restart is in progress
+func (s *Supervisor) Restarting() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.restart
+}
+
+func (s *Supervisor) setRestarting(restarting bool) {
+	s.mu.Lock()
+	s.restart = restarting
+	s.mu.Unlock()
+}
+
+// Wait waits until the server exits without being asked to, or Shutdown
+func (s *Supervisor) Wait() error {
+	<-s.done
+	return s.err
+}
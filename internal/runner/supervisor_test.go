@@ -0,0 +1,283 @@
+package runner
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// createServerScript creates a script that behaves like the Bedrock server:
+// it announces it started, echoes input and exits on "stop"
+func createServerScript(t *testing.T) string {
+	t.Helper()
+	content := `#!/bin/sh
+echo "Server started."
+while IFS= read -r line; do
+    if [ "$line" = "stop" ]; then
+        echo "Quit correctly"
+        exit 0
+    fi
+    echo "ECHO: $line"
+done
+`
+	scriptPath := filepath.Join(t.TempDir(), "server.sh")
+	if err := os.WriteFile(scriptPath, []byte(content), 0755); err != nil {
+		t.Fatalf("Failed to create test script: %v", err)
+	}
+	return scriptPath
+}
+
+// expectLine reads output until a line with the given text arrives
+func expectLine(t *testing.T, out <-chan Line, text string) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-out:
+			if !ok {
+				t.Fatalf("Output closed waiting for %q", text)
+			}
+			if line.Text == text {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for %q", text)
+		}
+	}
+}
+
+func TestSupervisorRestart(t *testing.T) {
+	s := NewSupervisor(createServerScript(t))
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	out := s.GetOutputChan()
+	expectLine(t, out, "Server started.")
+	firstPid := s.Pid()
+
+	if err := s.Restart(5 * time.Second); err != nil {
+		t.Fatalf("Failed to restart: %v", err)
+	}
+	expectLine(t, out, "Quit correctly")
+	expectLine(t, out, "Server started.")
+
+	if s.Pid() == firstPid || s.Pid() == 0 {
+		t.Errorf("Expected a new process, got pid %d (was %d)", s.Pid(), firstPid)
+	}
+	if s.Restarts() != 1 {
+		t.Errorf("Expected 1 restart, got %d", s.Restarts())
+	}
+
+	// Output keeps flowing from the new process
+	s.WriteInput("hello")
+	expectLine(t, out, "ECHO: hello")
+
+	if err := s.Shutdown(5 * time.Second); err != nil {
+		t.Fatalf("Failed to shut down: %v", err)
+	}
+	if err := s.Wait(); err != nil {
+		t.Errorf("Expected clean shutdown, got %v", err)
+	}
+}
+
+func TestSupervisorUnexpectedExit(t *testing.T) {
+	s := NewSupervisor("sh", "-c", "echo bye; exit 3")
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	for range s.GetOutputChan() {
+	}
+	if err := s.Wait(); err == nil {
+		t.Error("Expected the exit error of the crashed process")
+	}
+	if s.Running() {
+		t.Error("Expected the supervisor to report not running")
+	}
+	if err := s.Start(); err == nil {
+		t.Error("Expected start to fail after the supervisor ended")
+	}
+}
+
+func TestSupervisorStopKillsAfterTimeout(t *testing.T) {
+	// Ignores stop, so it has to be killed
+	s := NewSupervisor("sh", "-c", "while read line; do :; done; sleep 60")
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	go func() {
+		for range s.GetOutputChan() {
+		}
+	}()
+
+	start := time.Now()
+	if err := s.Stop(200 * time.Millisecond); err != nil {
+		t.Fatalf("Failed to stop: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Stop took %v", elapsed)
+	}
+	if s.Running() {
+		t.Error("Expected the server to be stopped")
+	}
+	if err := s.Stop(time.Second); err != ErrNotRunning {
+		t.Errorf("Expected ErrNotRunning stopping twice, got %v", err)
+	}
+	s.WriteInput("dropped") // Must not block while stopped
+}
+
+func TestSupervisorStopWithBrokenStdin(t *testing.T) {
+	// Closes stdin, so writes to it fail, and ignores everything
+	s := NewSupervisor("sh", "-c", "exec 0<&-; echo closed; exec sleep 60")
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	expectLine(t, s.GetOutputChan(), "closed")
+	go func() {
+		for range s.GetOutputChan() {
+		}
+	}()
+
+	stopped := make(chan error)
+	go func() {
+		s.WriteInput("first") // Fails and breaks the pipe
+		s.WriteInput("second")
+		stopped <- s.Stop(200 * time.Millisecond)
+	}()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("Failed to stop: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop hung on a broken stdin")
+	}
+}
+
+func TestSupervisorRestartStartFailure(t *testing.T) {
+	s := NewSupervisor(createServerScript(t))
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	go func() {
+		for range s.GetOutputChan() {
+		}
+	}()
+
+	// The next run fails to start
+	s.command = filepath.Join(t.TempDir(), "missing")
+	if err := s.Restart(5 * time.Second); err == nil {
+		t.Fatal("Expected the restart to fail")
+	}
+
+	waited := make(chan error)
+	go func() { waited <- s.Wait() }()
+	select {
+	case err := <-waited:
+		if err == nil {
+			t.Error("Expected Wait to return the start error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait hung after a failed restart")
+	}
+}
+
+func TestSupervisorExclusiveFailureEndsSupervisor(t *testing.T) {
+	s := NewSupervisor(createServerScript(t))
+	if err := s.Start(); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	go func() {
+		for range s.GetOutputChan() {
+		}
+	}()
+
+	// A failure that leaves the server running doesn't end the supervisor
+	if err := s.Exclusive(func() error { return errors.New("backup failed") }); err == nil {
+		t.Fatal("Expected the error returned")
+	}
+	if !s.Running() {
+		t.Fatal("Expected the server still running")
+	}
+
+	// One that leaves it stopped does
+	err := s.Exclusive(func() error {
+		s.Stop(5 * time.Second)
+		return errors.New("rollback failed")
+	})
+	if err == nil {
+		t.Fatal("Expected the error returned")
+	}
+	if err := s.Wait(); err == nil || err.Error() != "rollback failed" {
+		t.Errorf("Expected Wait to return the rollback error, got %v", err)
+	}
+}
+
+func TestSupervisorTrialExit(t *testing.T) {
+	s := NewSupervisor("sh", "-c", "echo bye; exit 3")
+	if err := s.StartTrial(); err != nil {
+		t.Fatalf("Failed to start: %v", err)
+	}
+	expectLine(t, s.GetOutputChan(), "bye")
+	for i := 0; i < 100 && s.Running(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if s.Running() {
+		t.Fatal("Expected the trial run to exit")
+	}
+
+	// The supervisor survives the failed trial and can start again
+	if err := s.Start(); err != nil {
+		t.Fatalf("Expected start after a failed trial, got %v", err)
+	}
+	expectLine(t, s.GetOutputChan(), "bye")
+	if err := s.Wait(); err == nil {
+		t.Error("Expected the exit of a committed run to end the supervisor")
+	}
+}
+
+func TestSupervisorExclusiveRestarts(t *testing.T) {
+	s := NewSupervisor("true")
+
+	firstEntered, firstDone := make(chan struct{}), make(chan struct{})
+	go s.Exclusive(func() error {
+		close(firstEntered)
+		<-firstDone
+		return nil
+	})
+	<-firstEntered
+
+	secondEntered, secondDone := make(chan struct{}), make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		s.Exclusive(func() error {
+			close(secondEntered)
+			<-secondDone
+			return nil
+		})
+		close(finished)
+	}()
+
+	select {
+	case <-secondEntered:
+		t.Fatal("Expected the second restart to wait for the first")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(firstDone)
+	select {
+	case <-secondEntered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the second restart")
+	}
+	if !s.Restarting() {
+		t.Error("Expected the server still restarting during the second restart")
+	}
+
+	close(secondDone)
+	<-finished
+	if s.Restarting() {
+		t.Error("Expected the restart finished")
+	}
+}
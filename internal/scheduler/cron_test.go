@@ -0,0 +1,86 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+}
+
+func TestCronMatches(t *testing.T) {
+	// 2024-03-15 is a Friday
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 15, hour, minute, 30, 0, time.UTC)
+	}
+
+	tests := []struct {
+		expr string
+		t    time.Time
+		want bool
+	}{
+		{"* * * * *", at(3, 7), true},
+		{"*/15 * * * *", at(3, 45), true},
+		{"*/15 * * * *", at(3, 46), false},
+		{"5/20 * * * *", at(3, 25), true},
+		{"0 20 * * fri", at(20, 0), true},
+		{"0 20 * * mon-thu", at(20, 0), false},
+		{"0 20 * * 5,6", at(20, 0), true},
+		{"30 18-22 * mar *", at(19, 30), true},
+		{"30 18-22 * apr *", at(19, 30), false},
+		{"0 0 1 * mon", time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), true},   // First of the month
+		{"0 0 13 * fri", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), true}, // Either day matches
+		{"0 0 * * 7", time.Date(2024, 3, 17, 0, 0, 0, 0, time.UTC), true},    // 7 is Sunday
+		{"@hourly", at(11, 0), true},
+		{"@daily", at(11, 0), false},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) failed: %v", tt.expr, err)
+		}
+		if got := c.Matches(tt.t); got != tt.want {
+			t.Errorf("%q matches %s = %v, expected %v", tt.expr, tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2024, 3, 15, 20, 0, 10, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 3, 15, 20, 1, 0, 0, time.UTC)},
+		{"0 20 * * fri", time.Date(2024, 3, 22, 20, 0, 0, 0, time.UTC)},
+		{"30 9 1 * *", time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) failed: %v", tt.expr, err)
+		}
+		if got := c.Next(from); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %s, expected %s", tt.expr, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+// Package scheduler sends in-game announcements on cron schedules
+package scheduler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Announcement kinds, each maps to a Bedrock command
+const (
+	KindSay     = "say"     // Chat message from the server
+	KindTellraw = "tellraw" // Plain chat message without the [Server] prefix
+	KindTitle   = "title"   // Text shown on screen
+)
+
+// Title display positions
+const (
+	TitleMain      = "title"
+	TitleSubtitle  = "subtitle"
+	TitleActionbar = "actionbar"
+)
+
+var ErrNotFound = errors.New("announcement not found")
+
+// Announcement is a message sent on a schedule
+type Announcement struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Schedule  string    `json:"schedule"` // Cron expression, e.g. "0 20 * * fri"
+	Kind      string    `json:"kind"`
+	Message   string    `json:"message"`
+	Target    string    `json:"target,omitempty"`    // Player selector for tellraw and title, defaults to @a
+	TitleType string    `json:"titleType,omitempty"` // title, subtitle or actionbar for titles
+	Enabled   bool      `json:"enabled"`
+	LastRun   time.Time `json:"lastRun,omitempty"`
+	NextRun   time.Time `json:"nextRun,omitempty"` // Computed when read, zero when disabled
+}
+
+// Command returns the console command that sends the announcement
+func (a Announcement) Command() string {
+	target := a.Target
+	if target == "" {
+		target = "@a"
+	}
+	// Commands are single lines
+	message := strings.Join(strings.Fields(a.Message), " ")
+
+	switch a.Kind {
+	case KindTellraw:
+		raw, _ := json.Marshal(map[string]interface{}{
+			"rawtext": []map[string]string{{"text": message}},
+		})
+		return fmt.Sprintf("tellraw %s %s", target, raw)
+	case KindTitle:
+		titleType := a.TitleType
+		if titleType == "" {
+			titleType = TitleMain
+		}
+		return fmt.Sprintf("title %s %s %s", target, titleType, message)
+	default:
+		return "say " + message
+	}
+}
+
+// Validate checks the announcement can be scheduled and sent
+func (a Announcement) Validate() error {
+	if _, err := ParseCron(a.Schedule); err != nil {
+		return err
+	}
+	switch a.Kind {
+	case KindSay, KindTellraw, KindTitle:
+	default:
+		return fmt.Errorf("invalid kind %q: expected say, tellraw or title", a.Kind)
+	}
+	switch a.TitleType {
+	case "", TitleMain, TitleSubtitle, TitleActionbar:
+	default:
+		return fmt.Errorf("invalid title type %q: expected title, subtitle or actionbar", a.TitleType)
+	}
+	if strings.TrimSpace(a.Message) == "" {
+		return errors.New("message is required")
+	}
+	if strings.ContainsAny(a.Target, " \r\n") {
+		return fmt.Errorf("invalid target %q", a.Target)
+	}
+	return nil
+}
+
+// Options configure a Scheduler
+type Options struct {
+	Path  string               // JSON file the announcements are persisted to
+	Send  func(command string) // Sends a console command to the server
+	Ready func() bool          // Reports whether the server can receive commands, optional
+}
+
+// Scheduler sends announcements when their schedules fire
+type Scheduler struct {
+	options Options
+	now     func() time.Time
+
+	mu            sync.Mutex
+	announcements map[string]*Announcement
+	schedules     map[string]Cron
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates a scheduler, loading any announcements saved at options.Path
+func New(options Options) (*Scheduler, error) {
+	s := &Scheduler{
+		options:       options,
+		now:           time.Now,
+		announcements: make(map[string]*Announcement),
+		schedules:     make(map[string]Cron),
+	}
+
+	data, err := os.ReadFile(options.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, fmt.Errorf("error reading schedule: %v", err)
+	}
+
+	var saved []Announcement
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("error parsing schedule %s: %v", options.Path, err)
+	}
+	for _, a := range saved {
+		schedule, err := ParseCron(a.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing schedule of %q: %v", a.Name, err)
+		}
+		a := a
+		s.announcements[a.ID] = &a
+		s.schedules[a.ID] = schedule
+	}
+	return s, nil
+}
+
+// Start runs the scheduler in the background until Stop is called
+func (s *Scheduler) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run()
+}
+
+// Stop stops the background scheduler
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.done
+}
+
+func (s *Scheduler) run() {
+	defer close(s.done)
+	for {
+		// Wake at the start of every minute, schedules have minute resolution
+		now := s.now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		timer := time.NewTimer(next.Sub(now))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+			s.RunDue(next)
+		}
+	}
+}
+
+// RunDue sends every enabled announcement whose schedule fires at t
+func (s *Scheduler) RunDue(t time.Time) {
+	if s.options.Ready != nil && !s.options.Ready() {
+		return
+	}
+
+	s.mu.Lock()
+	var due []*Announcement
+	for id, a := range s.announcements {
+		if a.Enabled && s.schedules[id].Matches(t) {
+			a.LastRun = t
+			due = append(due, a)
+		}
+	}
+	var commands []string
+	sort.Slice(due, func(i, j int) bool { return due[i].Name < due[j].Name })
+	for _, a := range due {
+		fmt.Printf("Sending scheduled announcement %q\n", a.Name)
+		commands = append(commands, a.Command())
+	}
+	if len(due) > 0 {
+		if err := s.saveLocked(); err != nil {
+			fmt.Printf("%v\n", err)
+		}
+	}
+	s.mu.Unlock()
+
+	// Sending may block on the server, don't hold the lock
+	for _, command := range commands {
+		s.options.Send(command)
+	}
+}
+
+// List returns the announcements ordered by name
+func (s *Scheduler) List() []Announcement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Announcement, 0, len(s.announcements))
+	for id := range s.announcements {
+		list = append(list, s.getLocked(id))
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Get returns one announcement
+func (s *Scheduler) Get(id string) (Announcement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.announcements[id]; !ok {
+		return Announcement{}, ErrNotFound
+	}
+	return s.getLocked(id), nil
+}
+
+func (s *Scheduler) getLocked(id string) Announcement {
+	a := *s.announcements[id]
+	if a.Enabled {
+		a.NextRun = s.schedules[id].Next(s.now())
+	}
+	return a
+}
+
+// Add validates and saves a new announcement, assigning its id
+func (s *Scheduler) Add(a Announcement) (Announcement, error) {
+	schedule, err := parse(a)
+	if err != nil {
+		return Announcement{}, err
+	}
+	a.ID = newID()
+	a.LastRun, a.NextRun = time.Time{}, time.Time{}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.announcements[a.ID] = &a
+	s.schedules[a.ID] = schedule
+	if err := s.saveLocked(); err != nil {
+		return Announcement{}, err
+	}
+	return s.getLocked(a.ID), nil
+}
+
+// Update replaces an announcement, keeping its id and last run
+func (s *Scheduler) Update(id string, a Announcement) (Announcement, error) {
+	schedule, err := parse(a)
+	if err != nil {
+		return Announcement{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.announcements[id]
+	if !ok {
+		return Announcement{}, ErrNotFound
+	}
+	a.ID, a.LastRun, a.NextRun = id, existing.LastRun, time.Time{}
+	s.announcements[id] = &a
+	s.schedules[id] = schedule
+	if err := s.saveLocked(); err != nil {
+		return Announcement{}, err
+	}
+	return s.getLocked(id), nil
+}
+
+// Delete removes an announcement
+func (s *Scheduler) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.announcements[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.announcements, id)
+	delete(s.schedules, id)
+	return s.saveLocked()
+}
+
+// Send sends an announcement immediately regardless of its schedule
+func (s *Scheduler) Send(id string) error {
+	a, err := s.Get(id)
+	if err != nil {
+		return err
+	}
+	s.options.Send(a.Command())
+	return nil
+}
+
+func parse(a Announcement) (Cron, error) {
+	if err := a.Validate(); err != nil {
+		return Cron{}, err
+	}
+	return ParseCron(a.Schedule)
+}
+
+// saveLocked writes the announcements to a temp file and renames it into
+// place so a crash never leaves a truncated schedule
+func (s *Scheduler) saveLocked() error {
+	list := make([]Announcement, 0, len(s.announcements))
+	for _, a := range s.announcements {
+		saved := *a
+		saved.NextRun = time.Time{}
+		list = append(list, saved)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding schedule: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.options.Path), 0755); err != nil {
+		return fmt.Errorf("error creating schedule directory: %v", err)
+	}
+	tmp := s.options.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("error writing schedule: %v", err)
+	}
+	if err := os.Rename(tmp, s.options.Path); err != nil {
+		return fmt.Errorf("error writing schedule: %v", err)
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAnnouncementCommand(t *testing.T) {
+	tests := []struct {
+		a    Announcement
+		want string
+	}{
+		{Announcement{Kind: KindSay, Message: "Event starts\nsoon"}, "say Event starts soon"},
+		{Announcement{Kind: KindTellraw, Message: `Read the "rules"`}, `tellraw @a {"rawtext":[{"text":"Read the \"rules\""}]}`},
+		{Announcement{Kind: KindTitle, Message: "Welcome", Target: "@p"}, "title @p title Welcome"},
+		{Announcement{Kind: KindTitle, TitleType: TitleActionbar, Message: "5 minutes"}, "title @a actionbar 5 minutes"},
+	}
+	for _, tt := range tests {
+		if got := tt.a.Command(); got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, got)
+		}
+	}
+}
+
+func TestAnnouncementValidate(t *testing.T) {
+	valid := Announcement{Schedule: "0 * * * *", Kind: KindSay, Message: "hi"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected valid announcement, got %v", err)
+	}
+
+	invalid := []func(a *Announcement){
+		func(a *Announcement) { a.Schedule = "every hour" },
+		func(a *Announcement) { a.Kind = "whisper" },
+		func(a *Announcement) { a.TitleType = "banner" },
+		func(a *Announcement) { a.Message = " " },
+		func(a *Announcement) { a.Target = "@a say hi" },
+	}
+	for i, modify := range invalid {
+		a := valid
+		modify(&a)
+		if err := a.Validate(); err == nil {
+			t.Errorf("Case %d: expected validation error for %+v", i, a)
+		}
+	}
+}
+
+func newTestScheduler(t *testing.T, path string, sent *[]string) *Scheduler {
+	t.Helper()
+	s, err := New(Options{Path: path, Send: func(command string) { *sent = append(*sent, command) }})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return s
+}
+
+func TestSchedulerRunDue(t *testing.T) {
+	var sent []string
+	s := newTestScheduler(t, filepath.Join(t.TempDir(), "schedule.json"), &sent)
+
+	s.Add(Announcement{Name: "rules", Schedule: "0 * * * *", Kind: KindSay, Message: "Be nice", Enabled: true})
+	s.Add(Announcement{Name: "event", Schedule: "30 20 * * *", Kind: KindSay, Message: "Event now", Enabled: true})
+	s.Add(Announcement{Name: "disabled", Schedule: "* * * * *", Kind: KindSay, Message: "Never", Enabled: false})
+
+	s.RunDue(time.Date(2024, 3, 15, 20, 0, 0, 0, time.Local))
+	s.RunDue(time.Date(2024, 3, 15, 20, 30, 0, 0, time.Local))
+	s.RunDue(time.Date(2024, 3, 15, 20, 31, 0, 0, time.Local))
+
+	if want := []string{"say Be nice", "say Event now"}; !reflect.DeepEqual(sent, want) {
+		t.Errorf("Expected %v, got %v", want, sent)
+	}
+}
+
+func TestSchedulerWaitsUntilReady(t *testing.T) {
+	var sent []string
+	s := newTestScheduler(t, filepath.Join(t.TempDir(), "schedule.json"), &sent)
+	s.options.Ready = func() bool { return false }
+
+	s.Add(Announcement{Name: "rules", Schedule: "* * * * *", Kind: KindSay, Message: "Be nice", Enabled: true})
+	s.RunDue(time.Now())
+	if len(sent) != 0 {
+		t.Errorf("Expected nothing sent while the server isn't ready, got %v", sent)
+	}
+}
+
+func TestSchedulerPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "schedule.json")
+	var sent []string
+	s := newTestScheduler(t, path, &sent)
+
+	a, err := s.Add(Announcement{Name: "rules", Schedule: "0 20 * * fri", Kind: KindTitle, Message: "Rules", Enabled: true})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if a.ID == "" || a.NextRun.IsZero() {
+		t.Errorf("Expected id and next run, got %+v", a)
+	}
+	b, _ := s.Add(Announcement{Name: "motd", Schedule: "@hourly", Kind: KindSay, Message: "Hello"})
+	a.Message = "Read the rules"
+	if _, err := s.Update(a.ID, a); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if err := s.Delete(b.ID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	// A new scheduler loads what was saved
+	reloaded := newTestScheduler(t, path, &sent)
+	list := reloaded.List()
+	if len(list) != 1 || list[0].ID != a.ID || list[0].Message != "Read the rules" || !list[0].Enabled {
+		t.Errorf("Unexpected reloaded announcements %+v", list)
+	}
+
+	if _, err := reloaded.Update("missing", a); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := reloaded.Delete("missing"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/jsandas/bedrock-server/internal/scheduler"
+)
+
+// handleAnnouncements lists (GET) and creates (POST) scheduled announcements
+func (s *Server) handleAnnouncements(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "announcement scheduler is not enabled", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.scheduler.List())
+	case http.MethodPost:
+		if !requireAdmin(w, r) {
+			return
+		}
+		var a scheduler.Announcement
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			http.Error(w, "invalid announcement: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		created, err := s.scheduler.Add(a)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusCreated, created)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAnnouncement reads (GET), replaces (PUT) and deletes (DELETE)
+// /api/announcements/{id}, and sends it immediately with POST
+// /api/announcements/{id}/send
+func (s *Server) handleAnnouncement(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		http.Error(w, "announcement scheduler is not enabled", http.StatusNotFound)
+		return
+	}
+
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/announcements/"), "/")
+	if r.Method != http.MethodGet && !requireAdmin(w, r) {
+		return
+	}
+
+	var err error
+	switch {
+	case action == "send" && r.Method == http.MethodPost:
+		var a scheduler.Announcement
+		if a, err = s.scheduler.Get(id); err == nil {
+			// Sent directly so it is audited as the user, not the scheduler
+			identity, _ := IdentityFromContext(r.Context())
+			s.recordCommand(r, identity, a.Command(), false)
+			s.runner.WriteInput(a.Command())
+		}
+		if err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case action != "":
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	case r.Method == http.MethodGet:
+		var a scheduler.Announcement
+		if a, err = s.scheduler.Get(id); err == nil {
+			writeJSON(w, http.StatusOK, a)
+		}
+	case r.Method == http.MethodPut:
+		var a scheduler.Announcement
+		if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+			http.Error(w, "invalid announcement: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if a, err = s.scheduler.Update(id, a); err == nil {
+			writeJSON(w, http.StatusOK, a)
+		}
+	case r.Method == http.MethodDelete:
+		if err = s.scheduler.Delete(id); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// requireAdmin rejects callers without the admin role
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if identity, _ := IdentityFromContext(r.Context()); identity.Role != RoleAdmin {
+		http.Error(w, "admin role required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jsandas/bedrock-server/internal/runner"
+	"github.com/jsandas/bedrock-server/internal/scheduler"
+)
+
+func newSchedulerTestServer(t *testing.T) (*httptest.Server, *fakeProcess) {
+	t.Helper()
+	process := &fakeProcess{out: make(chan runner.Line)}
+	sched, err := scheduler.New(scheduler.Options{
+		Path: filepath.Join(t.TempDir(), "schedule.json"),
+		Send: process.WriteInput,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create scheduler: %v", err)
+	}
+	srv := New(ServerConfig{Runner: process, AuthKey: "secret", Scheduler: sched})
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts, process
+}
+
+func apiRequest(t *testing.T, method, url, body string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("X-Auth-Key", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestAnnouncementsAPI(t *testing.T) {
+	ts, process := newSchedulerTestServer(t)
+	base := ts.URL + "/api/announcements"
+
+	resp := apiRequest(t, "POST", base, `{"name":"rules","schedule":"0 20 * * fri","kind":"say","message":"Be nice","enabled":true}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+	var created scheduler.Announcement
+	json.NewDecoder(resp.Body).Decode(&created)
+	if created.ID == "" || created.NextRun.IsZero() {
+		t.Fatalf("Expected id and next run, got %+v", created)
+	}
+
+	if resp := apiRequest(t, "POST", base, `{"name":"bad","schedule":"often","kind":"say","message":"x"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid schedule, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, "PUT", base+"/"+created.ID, `{"name":"rules","schedule":"0 20 * * sat","kind":"title","message":"Rules","enabled":true}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	resp = apiRequest(t, "GET", base, "")
+	var list []scheduler.Announcement
+	json.NewDecoder(resp.Body).Decode(&list)
+	if len(list) != 1 || list[0].Kind != scheduler.KindTitle {
+		t.Errorf("Expected the updated announcement, got %+v", list)
+	}
+
+	if resp := apiRequest(t, "POST", base+"/"+created.ID+"/send", ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+	if sent := process.inputs(); len(sent) != 1 || sent[0] != "title @a title Rules" {
+		t.Errorf("Expected the title to be sent, got %v", sent)
+	}
+
+	if resp := apiRequest(t, "DELETE", base+"/"+created.ID, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+	if resp := apiRequest(t, "GET", base+"/"+created.ID, ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 after delete, got %d", resp.StatusCode)
+	}
+}
+
+func TestAnnouncementsDisabled(t *testing.T) {
+	_, ts := newTestServer(t)
+	if resp := apiRequest(t, "GET", ts.URL+"/api/announcements", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 without a scheduler, got %d", resp.StatusCode)
+	}
+}
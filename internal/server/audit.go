@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/audit"
+)
+
+// Limits on the entries returned by the audit API
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// recordCommand writes a console command to the audit log if one is configured
+func (s *Server) recordCommand(r *http.Request, identity Identity, command string, denied bool) {
+	if s.audit == nil {
+		return
+	}
+
+	err := s.audit.Record(audit.Entry{
+		User:       identity.Name,
+		Method:     identity.Method,
+		RemoteAddr: s.clientAddr(r),
+		Command:    command,
+		Denied:     denied,
+	})
+	if err != nil {
+		fmt.Printf("Error writing audit log: %v\n", err)
+	}
+}
+
+// SendAs sends a console command on behalf of a part of the wrapper or an
+// integration rather than a connected user, recording it in the audit log
+// under actor, e.g. "system:restart" or "discord:alex"
+func (s *Server) SendAs(actor, command string) {
+	if s.audit != nil {
+		method, _, _ := strings.Cut(actor, ":")
+		if err := s.audit.Record(audit.Entry{User: actor, Method: method, Command: command}); err != nil {
+			fmt.Printf("Error writing audit log: %v\n", err)
+		}
+	}
+	s.runner.WriteInput(command)
+}
+
+// Sender returns a function sending commands as actor, see SendAs
+func (s *Server) Sender(actor string) func(command string) {
+	return func(command string) { s.SendAs(actor, command) }
+}
+
+// handleAudit returns audit log entries filtered by the query parameters
+// user, command, since and until (RFC 3339) and limit, at most maxAuditLimit
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if identity, _ := IdentityFromContext(r.Context()); identity.Role != RoleAdmin {
+		http.Error(w, "admin role required", http.StatusForbidden)
+		return
+	}
+	if s.audit == nil {
+		http.Error(w, "audit log is not enabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		User:    query.Get("user"),
+		Command: query.Get("command"),
+		Limit:   defaultAuditLimit,
+	}
+
+	var err error
+	if v := query.Get("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid until: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := query.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if filter.Limit == 0 || filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+
+	entries, err := s.audit.Query(filter)
+	if err != nil {
+		fmt.Printf("Error querying audit log: %v\n", err)
+		http.Error(w, "error reading audit log", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []audit.Entry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/jsandas/bedrock-server/internal/audit"
+	"github.com/jsandas/bedrock-server/internal/logfile"
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+func newAuditTestServer(t *testing.T) (*Server, *httptest.Server, *audit.Logger, *fakeProcess) {
+	t.Helper()
+	logger, err := audit.New(filepath.Join(t.TempDir(), "audit.log"), logfile.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open audit log: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	process := &fakeProcess{out: make(chan runner.Line)}
+	srv := New(ServerConfig{Runner: process, AuthKey: "secret", Audit: logger})
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return srv, ts, logger, process
+}
+
+func queryAudit(t *testing.T, url string) []audit.Entry {
+	t.Helper()
+	resp := apiRequest(t, "GET", url, "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 from %s, got %d", url, resp.StatusCode)
+	}
+	var entries []audit.Entry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatalf("Failed to decode entries: %v", err)
+	}
+	return entries
+}
+
+func TestSendAsIsAudited(t *testing.T) {
+	srv, ts, _, process := newAuditTestServer(t)
+
+	srv.SendAs("system:restart", "say Server restarting in 1 minute")
+	srv.Sender("discord:sam")("say [Discord] sam: hi")
+
+	if got := process.inputs(); len(got) != 2 {
+		t.Fatalf("Expected both commands sent, got %q", got)
+	}
+	entries := queryAudit(t, ts.URL+"/api/audit?user=discord:sam")
+	if len(entries) != 1 || entries[0].Command != "say [Discord] sam: hi" || entries[0].Method != "discord" {
+		t.Errorf("Expected the Discord command audited, got %+v", entries)
+	}
+	entries = queryAudit(t, ts.URL+"/api/audit?command=restarting")
+	if len(entries) != 1 || entries[0].User != "system:restart" || entries[0].Method != "system" {
+		t.Errorf("Expected the restart warning audited, got %+v", entries)
+	}
+}
+
+func TestAuditAPILimits(t *testing.T) {
+	_, ts, logger, _ := newAuditTestServer(t)
+	for i := 0; i < maxAuditLimit+5; i++ {
+		if err := logger.Record(audit.Entry{User: "admin", Command: fmt.Sprintf("say %d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if entries := queryAudit(t, ts.URL+"/api/audit"); len(entries) != defaultAuditLimit {
+		t.Errorf("Expected %d entries by default, got %d", defaultAuditLimit, len(entries))
+	}
+	entries := queryAudit(t, ts.URL+"/api/audit?limit=100000")
+	if len(entries) != maxAuditLimit {
+		t.Fatalf("Expected the limit capped at %d, got %d", maxAuditLimit, len(entries))
+	}
+	if last := entries[len(entries)-1].Command; last != fmt.Sprintf("say %d", maxAuditLimit+4) {
+		t.Errorf("Expected the newest entries, last was %q", last)
+	}
+	if entries := queryAudit(t, ts.URL+"/api/audit?limit=3"); len(entries) != 3 {
+		t.Errorf("Expected 3 entries, got %d", len(entries))
+	}
+
+	if resp := apiRequest(t, "GET", ts.URL+"/api/audit?limit=-1", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a negative limit, got %d", resp.StatusCode)
+	}
+	if resp := apiRequest(t, "GET", ts.URL+"/api/audit?since=yesterday", ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid time, got %d", resp.StatusCode)
+	}
+	if resp := apiRequest(t, "POST", ts.URL+"/api/audit", ""); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", resp.StatusCode)
+	}
+}
+
+func TestAuditAPIDisabled(t *testing.T) {
+	_, ts := newTestServer(t)
+	if resp := apiRequest(t, "GET", ts.URL+"/api/audit", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 without an audit log, got %d", resp.StatusCode)
+	}
+}
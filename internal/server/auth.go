@@ -1,8 +1,10 @@
 package server
 
 import (
+	"context"
 	"crypto/subtle"
 	"errors"
+	"fmt"
 	"net/http"
 )
 
@@ -11,7 +13,50 @@ var (
 	ErrInvalidAuthKey = errors.New("invalid authentication key")
 )
 
-// authMiddleware checks for the presence and validity of the pre-shared key
+// Role controls what an authenticated identity may do
+type Role string
+
+const (
+	RoleAdmin  Role = "admin"  // May view output and send commands
+	RoleViewer Role = "viewer" // May only view output
+)
+
+// Authentication methods recorded on an Identity
+const (
+	AuthMethodKey    = "key"
+	AuthMethodOIDC   = "oidc"
+	AuthMethodMTLS   = "mtls"
+	AuthMethodSocket = "socket" // Trusted by the control socket's file permissions
+)
+
+// Identity describes who made an authenticated request
+type Identity struct {
+	Subject string `json:"subject"`
+	Name    string `json:"name"`
+	Role    Role   `json:"role"`
+	Method  string `json:"method"`
+}
+
+// CanCommand reports whether the identity may send console commands
+func (i Identity) CanCommand() bool {
+	return i.Role == RoleAdmin
+}
+
+type identityKey struct{}
+
+// IdentityFromContext returns the identity stored by the auth middleware
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+func withIdentity(r *http.Request, identity Identity) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, identity))
+}
+
+// authMiddleware checks for a verified client certificate, a valid
+// pre-shared key or an OIDC session. Requests arriving with an identity,
+// such as those over the control socket, pass straight through.
 func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Skip auth check for the index page
@@ -20,23 +65,67 @@ func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		// Requests over the control socket are already trusted
+		if _, ok := IdentityFromContext(r.Context()); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		addr := s.clientAddr(r)
+		if !s.requests.allow(addr) {
+			http.Error(w, ErrTooManyRequests.Error(), http.StatusTooManyRequests)
+			return
+		}
+		if s.limiter.lockedOut(addr) {
+			http.Error(w, ErrTooManyAttempts.Error(), http.StatusTooManyRequests)
+			return
+		}
+
+		// Chains are only populated when a client CA is configured and the
+		// presented certificate verified against it
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			cert := r.TLS.VerifiedChains[0][0]
+			identity, err := s.certIdentity(cert)
+			if err != nil {
+				fmt.Printf("Rejected client certificate %q from %s: %v\n", cert.Subject.CommonName, addr, err)
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, withIdentity(r, identity))
+			return
+		}
+
 		// Try to get auth key from header or query parameter
 		authKey := r.Header.Get("X-Auth-Key")
 		if authKey == "" {
 			authKey = r.URL.Query().Get("auth")
 		}
 
+		// Fall back to a single sign-on session when no key was supplied
+		if authKey == "" && s.oidc != nil {
+			if identity, ok := s.oidc.sessionIdentity(r); ok {
+				next.ServeHTTP(w, withIdentity(r, identity))
+				return
+			}
+		}
+
 		if authKey == "" {
 			http.Error(w, ErrMissingAuthKey.Error(), http.StatusUnauthorized)
 			return
 		}
 
 		// Use constant-time comparison to prevent timing attacks
-		if subtle.ConstantTimeCompare([]byte(authKey), []byte(s.authKey)) != 1 {
+		if s.authKey == "" || subtle.ConstantTimeCompare([]byte(authKey), []byte(s.authKey)) != 1 {
+			fmt.Printf("Failed authentication from %s: %v\n", addr, ErrInvalidAuthKey)
+			if s.limiter.fail(addr) {
+				fmt.Printf("Locking out %s for %s after repeated failed authentication\n", addr, s.limiter.lockout)
+			}
 			http.Error(w, ErrInvalidAuthKey.Error(), http.StatusUnauthorized)
 			return
 		}
+		s.limiter.succeed(addr)
 
-		next.ServeHTTP(w, r)
+		identity := Identity{Subject: "auth-key", Name: "auth-key", Role: RoleAdmin, Method: AuthMethodKey}
+		next.ServeHTTP(w, withIdentity(r, identity))
 	}
 }
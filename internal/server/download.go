@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/jsandas/bedrock-server/internal/downloader"
+)
+
+// stateIdle is reported before any download has started
+const stateIdle = "idle"
+
+// SetDownload records the progress of a server download
+func (s *Server) SetDownload(progress downloader.Progress) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+	s.download = &progress
+}
+
+// Download returns the progress of the last server download
+func (s *Server) Download() downloader.Progress {
+	s.statusLock.RLock()
+	defer s.statusLock.RUnlock()
+	if s.download == nil {
+		return downloader.Progress{State: stateIdle}
+	}
+	return *s.download
+}
+
+// handleDownload reports the progress of the last server download, e.g.
+// while the server is downloaded before it first starts
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Download())
+}
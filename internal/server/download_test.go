@@ -0,0 +1,27 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/jsandas/bedrock-server/internal/downloader"
+)
+
+func TestDownloadStatus(t *testing.T) {
+	srv, ts := newTestServer(t)
+
+	var got downloader.Progress
+	resp := apiRequest(t, "GET", ts.URL+"/api/download", "")
+	json.NewDecoder(resp.Body).Decode(&got)
+	if resp.StatusCode != http.StatusOK || got.State != "idle" {
+		t.Fatalf("Expected an idle download, got %d %+v", resp.StatusCode, got)
+	}
+
+	srv.SetDownload(downloader.Progress{Version: "1.21.0.1", State: downloader.StateDownloading, Bytes: 512, Total: 1024, Percent: 50})
+	resp = apiRequest(t, "GET", ts.URL+"/api/download", "")
+	json.NewDecoder(resp.Body).Decode(&got)
+	if got.Version != "1.21.0.1" || got.Percent != 50 {
+		t.Errorf("Expected the download progress, got %+v", got)
+	}
+}
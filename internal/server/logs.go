@@ -0,0 +1,72 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/consolelog"
+)
+
+const (
+	defaultLogLimit = 500
+	maxLogLimit     = 10000
+)
+
+// handleLogs searches the persisted console history using the query
+// parameters since and until (RFC 3339), q (regular expression) and limit
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.consoleLog == nil {
+		http.Error(w, "console log persistence is not enabled", http.StatusNotFound)
+		return
+	}
+
+	params := r.URL.Query()
+	query := consolelog.Query{Limit: defaultLogLimit}
+
+	var err error
+	if v := params.Get("since"); v != "" {
+		if query.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid since: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := params.Get("until"); v != "" {
+		if query.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			http.Error(w, "invalid until: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := params.Get("q"); v != "" {
+		if query.Pattern, err = regexp.Compile(v); err != nil {
+			http.Error(w, "invalid pattern: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		if query.Limit, err = strconv.Atoi(v); err != nil || query.Limit <= 0 || query.Limit > maxLogLimit {
+			http.Error(w, fmt.Sprintf("limit must be between 1 and %d", maxLogLimit), http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, err := s.consoleLog.Search(query)
+	if err != nil {
+		fmt.Printf("Error searching console log: %v\n", err)
+		http.Error(w, "error reading console log", http.StatusInternalServerError)
+		return
+	}
+	if records == nil {
+		records = []consolelog.Record{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
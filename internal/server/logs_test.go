@@ -0,0 +1,77 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/consolelog"
+	"github.com/jsandas/bedrock-server/internal/logfile"
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+func TestLogsAPI(t *testing.T) {
+	consoleLog, err := consolelog.Open(t.TempDir(), logfile.Options{})
+	if err != nil {
+		t.Fatalf("Failed to open console log: %v", err)
+	}
+	t.Cleanup(func() { consoleLog.Close() })
+
+	base := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, text := range []string{"Server started.", "Player connected: Steve", "tick", "Player connected: Alex"} {
+		consoleLog.Write(runner.Line{Time: base.Add(time.Duration(i) * time.Minute), Stream: runner.StreamStdout, Text: text})
+	}
+
+	srv := New(ServerConfig{Runner: runner.New("true"), AuthKey: "secret", ConsoleLog: consoleLog})
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Server started.", "Player connected: Steve", "tick", "Player connected: Alex"}},
+		{"?q=Player", []string{"Player connected: Steve", "Player connected: Alex"}},
+		{"?limit=1", []string{"Player connected: Alex"}},
+		{"?since=2025-01-01T12:01:00Z&until=2025-01-01T12:03:00Z", []string{"Player connected: Steve", "tick"}},
+	}
+	for _, tt := range tests {
+		resp := apiRequest(t, "GET", ts.URL+"/api/logs"+tt.query, "")
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", tt.query, resp.StatusCode)
+		}
+		var records []consolelog.Record
+		if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
+			t.Fatalf("%s: failed to decode records: %v", tt.query, err)
+		}
+		var got []string
+		for _, record := range records {
+			got = append(got, record.Text)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: expected %q, got %q", tt.query, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: expected %q, got %q", tt.query, tt.want, got)
+				break
+			}
+		}
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=100000", "?since=yesterday", "?q=("} {
+		if resp := apiRequest(t, "GET", ts.URL+"/api/logs"+query, ""); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", query, resp.StatusCode)
+		}
+	}
+}
+
+func TestLogsAPIDisabled(t *testing.T) {
+	_, ts := newTestServer(t)
+	if resp := apiRequest(t, "GET", ts.URL+"/api/logs", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 without console log persistence, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,637 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sessionCookieName = "bedrock_session"
+	sessionTTL        = 12 * time.Hour
+	loginTTL          = 10 * time.Minute
+	maxPendingLogins  = 1000            // Logins in progress, bounds memory used by unauthenticated requests
+	jwksRefreshDelay  = time.Minute     // Least time between signing key fetches for unknown key ids
+	clockSkew         = 2 * time.Minute // Allowed difference from the issuer's clock
+)
+
+var (
+	ErrInvalidIDToken = errors.New("invalid id token")
+	ErrNoRoleMapped   = errors.New("no role mapped for identity")
+)
+
+// OIDCConfig holds the OpenID Connect settings for web console single sign-on
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string   // Optional for public clients, PKCE is always used
+	RedirectURL  string   // Must point at /auth/callback on this server
+	Scopes       []string // Defaults to openid, email and profile
+	GroupsClaim  string   // Claim holding group membership, defaults to "groups"
+	AdminGroups  []string
+	AdminEmails  []string
+	ViewerGroups []string
+	ViewerEmails []string
+}
+
+// Enabled reports whether enough settings are present to use OIDC login
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != "" && c.ClientID != ""
+}
+
+// Validate checks an enabled configuration can map someone to a role, as
+// logins without a role are refused
+func (c OIDCConfig) Validate() error {
+	if c.Enabled() && !c.mapsRoles() {
+		return errors.New("single sign-on needs admin or viewer groups or emails, otherwise every login is refused")
+	}
+	return nil
+}
+
+// mapsRoles reports whether any admin or viewer list is configured
+func (c OIDCConfig) mapsRoles() bool {
+	return len(c.AdminGroups)+len(c.AdminEmails)+len(c.ViewerGroups)+len(c.ViewerEmails) > 0
+}
+
+// role maps group memberships and emails to a role through the admin and
+// viewer lists, admin winning when both match
+func (c OIDCConfig) role(groups []string, emails ...string) (Role, bool) {
+	switch {
+	case matchesAny(groups, c.AdminGroups) || matchesAnyFold(emails, c.AdminEmails):
+		return RoleAdmin, true
+	case matchesAny(groups, c.ViewerGroups) || matchesAnyFold(emails, c.ViewerEmails):
+		return RoleViewer, true
+	}
+	return "", false
+}
+
+// oidcProvider performs the authorization-code flow against an issuer
+type oidcProvider struct {
+	config OIDCConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]*rsa.PublicKey
+	keysFetch time.Time               // When the signing keys were last fetched
+	pending   map[string]pendingLogin // Keyed by state
+	sessions  map[string]*session     // Keyed by session id
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type pendingLogin struct {
+	verifier string
+	nonce    string
+	expires  time.Time
+}
+
+type session struct {
+	identity Identity
+	expires  time.Time
+}
+
+func newOIDCProvider(config OIDCConfig) *oidcProvider {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+	return &oidcProvider{
+		config:   config,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		pending:  make(map[string]pendingLogin),
+		sessions: make(map[string]*session),
+	}
+}
+
+// discover fetches and caches the issuer's OpenID configuration document
+func (p *oidcProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	cached := p.discovery
+	p.mu.Unlock()
+	if cached != nil {
+		return cached, nil
+	}
+
+	wellKnown := strings.TrimSuffix(p.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	var doc oidcDiscovery
+	if err := p.getJSON(ctx, wellKnown, &doc); err != nil {
+		return nil, fmt.Errorf("error fetching discovery document: %w", err)
+	}
+	if doc.Issuer != strings.TrimSuffix(p.config.IssuerURL, "/") && doc.Issuer != p.config.IssuerURL {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer %q", doc.Issuer, p.config.IssuerURL)
+	}
+
+	p.mu.Lock()
+	p.discovery = &doc
+	p.mu.Unlock()
+	return &doc, nil
+}
+
+func (p *oidcProvider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// handleLogin starts the authorization-code flow with PKCE
+func (p *oidcProvider) handleLogin(w http.ResponseWriter, r *http.Request) {
+	doc, err := p.discover(r.Context())
+	if err != nil {
+		fmt.Printf("OIDC login failed: %v\n", err)
+		http.Error(w, "identity provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	state := randomToken()
+	login := pendingLogin{
+		verifier: randomToken(),
+		nonce:    randomToken(),
+		expires:  time.Now().Add(loginTTL),
+	}
+
+	p.mu.Lock()
+	p.pruneLocked()
+	full := len(p.pending) >= maxPendingLogins
+	if !full {
+		p.pending[state] = login
+	}
+	p.mu.Unlock()
+	if full {
+		http.Error(w, "too many logins in progress, try again later", http.StatusServiceUnavailable)
+		return
+	}
+
+	challenge := sha256.Sum256([]byte(login.verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {login.nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(doc.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	http.Redirect(w, r, doc.AuthorizationEndpoint+sep+params.Encode(), http.StatusFound)
+}
+
+// handleCallback exchanges the authorization code and creates a session
+func (p *oidcProvider) handleCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if errCode := query.Get("error"); errCode != "" {
+		http.Error(w, "login failed: "+errCode, http.StatusUnauthorized)
+		return
+	}
+
+	state := query.Get("state")
+	p.mu.Lock()
+	login, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(login.expires) {
+		http.Error(w, "unknown or expired login state", http.StatusBadRequest)
+		return
+	}
+
+	rawIDToken, err := p.exchange(r.Context(), query.Get("code"), login.verifier)
+	if err != nil {
+		fmt.Printf("OIDC code exchange failed: %v\n", err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+
+	claims, err := p.verifyIDToken(r.Context(), rawIDToken, login.nonce)
+	if err != nil {
+		fmt.Printf("OIDC token verification failed: %v\n", err)
+		http.Error(w, "login failed", http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := p.identityFromClaims(claims)
+	if err != nil {
+		fmt.Printf("OIDC login denied for %s: %v\n", claims.Subject, err)
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+
+	id := randomToken()
+	p.mu.Lock()
+	p.sessions[id] = &session{identity: identity, expires: time.Now().Add(sessionTTL)}
+	p.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+		MaxAge:   int(sessionTTL.Seconds()),
+	})
+	fmt.Printf("OIDC login: %s (%s)\n", identity.Name, identity.Role)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// handleLogout removes the caller's session
+func (p *oidcProvider) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		p.mu.Lock()
+		delete(p.sessions, cookie.Value)
+		p.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1})
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// sessionIdentity returns the identity bound to the request's session cookie
+func (p *oidcProvider) sessionIdentity(r *http.Request) (Identity, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return Identity{}, false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sess, ok := p.sessions[cookie.Value]
+	if !ok {
+		return Identity{}, false
+	}
+	if time.Now().After(sess.expires) {
+		delete(p.sessions, cookie.Value)
+		return Identity{}, false
+	}
+	return sess.identity, true
+}
+
+// pruneLocked drops expired logins and sessions, p.mu must be held
+func (p *oidcProvider) pruneLocked() {
+	now := time.Now()
+	for state, login := range p.pending {
+		if now.After(login.expires) {
+			delete(p.pending, state)
+		}
+	}
+	for id, sess := range p.sessions {
+		if now.After(sess.expires) {
+			delete(p.sessions, id)
+		}
+	}
+}
+
+// exchange trades an authorization code for an ID token
+func (p *oidcProvider) exchange(ctx context.Context, code, verifier string) (string, error) {
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned status code: %d", resp.StatusCode)
+	}
+
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("error decoding token response: %w", err)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("token response did not include an id_token")
+	}
+	return token.IDToken, nil
+}
+
+// idTokenClaims are the ID token claims used by the console
+type idTokenClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  audience        `json:"aud"`
+	Expiry    int64           `json:"exp"`
+	IssuedAt  int64           `json:"iat"`
+	NotBefore int64           `json:"nbf"`
+	Nonce     string          `json:"nonce"`
+	Email     string          `json:"email"`
+	Verified  claimBool       `json:"email_verified"`
+	Name      string          `json:"name"`
+	Raw       json.RawMessage `json:"-"`
+}
+
+// claimBool accepts both booleans and the "true" strings some issuers send
+type claimBool bool
+
+func (b *claimBool) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case bool:
+		*b = claimBool(v)
+	case string:
+		*b = claimBool(strings.EqualFold(v, "true"))
+	}
+	return nil
+}
+
+// audience accepts both the string and array forms of the aud claim
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(data, &multi); err != nil {
+		return err
+	}
+	*a = multi
+	return nil
+}
+
+// verifyIDToken checks the RS256 signature and standard claims of an ID token
+func (p *oidcProvider) verifyIDToken(ctx context.Context, raw, nonce string) (*idTokenClaims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported signing algorithm %q", ErrInvalidIDToken, header.Alg)
+	}
+
+	key, err := p.signingKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	var claims idTokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	claims.Raw = payload
+
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Issuer != doc.Issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	}
+	if !containsString(claims.Audience, p.config.ClientID) {
+		return nil, fmt.Errorf("%w: client id not in audience", ErrInvalidIDToken)
+	}
+	now := time.Now()
+	skew := int64(clockSkew.Seconds())
+	if now.Unix() > claims.Expiry+skew {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	}
+	if claims.IssuedAt == 0 || claims.IssuedAt > now.Unix()+skew {
+		return nil, fmt.Errorf("%w: missing or future issue time", ErrInvalidIDToken)
+	}
+	if claims.NotBefore > now.Unix()+skew {
+		return nil, fmt.Errorf("%w: token not valid yet", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	return &claims, nil
+}
+
+// signingKey looks up a key by id, refreshing the JWKS on a miss at most
+// once per jwksRefreshDelay so forged key ids can't flood the issuer
+func (p *oidcProvider) signingKey(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	recent := p.keys != nil && time.Since(p.keysFetch) < jwksRefreshDelay
+	if !ok && !recent {
+		p.keysFetch = time.Now()
+	}
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if recent {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+	}
+
+	doc, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, doc.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("error fetching signing keys: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown signing key %q", ErrInvalidIDToken, kid)
+	}
+	return key, nil
+}
+
+// identityFromClaims maps the token's verified email and groups onto a
+// console role
+func (p *oidcProvider) identityFromClaims(claims *idTokenClaims) (Identity, error) {
+	var extra map[string]interface{}
+	if err := json.Unmarshal(claims.Raw, &extra); err != nil {
+		return Identity{}, err
+	}
+
+	var groups []string
+	switch v := extra[p.config.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range v {
+			if s, ok := g.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	case string:
+		groups = []string{v}
+	}
+
+	name := claims.Email
+	if name == "" {
+		name = claims.Subject
+	}
+	identity := Identity{Subject: claims.Subject, Name: name, Method: AuthMethodOIDC}
+
+	// Anyone can claim an address they don't own with some issuers, only
+	// verified ones are mapped to roles
+	var email string
+	if claims.Verified {
+		email = claims.Email
+	}
+
+	role, ok := p.config.role(groups, email)
+	if !ok {
+		return Identity{}, ErrNoRoleMapped
+	}
+	identity.Role = role
+	return identity, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyFold(have, want []string) bool {
+	for _, h := range have {
+		if containsFold(want, h) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAny(have, want []string) bool {
+	for _, h := range have {
+		if containsString(want, h) {
+			return true
+		}
+	}
+	return false
+}
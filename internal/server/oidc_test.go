@@ -0,0 +1,420 @@
+package server
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+// mockIssuer is a minimal OpenID Connect provider for tests
+type mockIssuer struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+
+	codes       map[string]mockAuthRequest
+	jwksFetches int
+}
+
+type mockAuthRequest struct {
+	nonce     string
+	challenge string
+}
+
+func newMockIssuer(t *testing.T, claims map[string]interface{}) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	m := &mockIssuer{t: t, key: key, claims: claims, codes: make(map[string]mockAuthRequest)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		m.jwksFetches++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "test",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+			t.Errorf("Expected PKCE S256 challenge, got %q", r.URL.RawQuery)
+		}
+		code := randomToken()
+		m.codes[code] = mockAuthRequest{nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+		target := q.Get("redirect_uri") + "?code=" + code + "&state=" + url.QueryEscape(q.Get("state"))
+		http.Redirect(w, r, target, http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		req, ok := m.codes[r.Form.Get("code")]
+		if !ok {
+			http.Error(w, "bad code", http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != req.challenge {
+			http.Error(w, "bad verifier", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(req.nonce)})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) sign(nonce string) string {
+	claims := map[string]interface{}{
+		"iss":   m.server.URL,
+		"sub":   "user-1",
+		"aud":   "console",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": nonce,
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	return m.signClaims("test", claims)
+}
+
+// signClaims signs arbitrary claims with the issuer's key
+func (m *mockIssuer) signClaims(kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		m.t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// newOIDCTestServer starts the console wired to the given mock issuer
+func newOIDCTestServer(t *testing.T, issuer *mockIssuer) (*httptest.Server, *http.Client) {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(nil)
+	srv := New(ServerConfig{
+		Runner:  runner.New("true"),
+		AuthKey: "automation-key",
+		OIDC: OIDCConfig{
+			IssuerURL:    issuer.server.URL,
+			ClientID:     "console",
+			RedirectURL:  "http://" + ts.Listener.Addr().String() + "/auth/callback",
+			AdminGroups:  []string{"minecraft-admins"},
+			ViewerEmails: []string{"viewer@example.com"},
+		},
+	})
+	ts.Config.Handler = srv.Handler()
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	jar, _ := cookiejar.New(nil)
+	return ts, &http.Client{Jar: jar}
+}
+
+func whoAmI(t *testing.T, client *http.Client, base string) (Identity, int) {
+	t.Helper()
+	resp, err := client.Get(base + "/auth/me")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var identity Identity
+	if resp.StatusCode == http.StatusOK {
+		json.NewDecoder(resp.Body).Decode(&identity)
+	}
+	return identity, resp.StatusCode
+}
+
+func TestOIDCLoginMapsGroupToAdmin(t *testing.T) {
+	issuer := newMockIssuer(t, map[string]interface{}{
+		"email":  "alice@example.com",
+		"groups": []string{"minecraft-admins"},
+	})
+	ts, client := newOIDCTestServer(t, issuer)
+
+	if _, status := whoAmI(t, client, ts.URL); status != http.StatusUnauthorized {
+		t.Fatalf("Expected 401 before login, got %d", status)
+	}
+
+	resp, err := client.Get(ts.URL + "/auth/login")
+	if err != nil {
+		t.Fatalf("Login flow failed: %v", err)
+	}
+	resp.Body.Close()
+
+	identity, status := whoAmI(t, client, ts.URL)
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200 after login, got %d", status)
+	}
+	if identity.Role != RoleAdmin || identity.Name != "alice@example.com" || identity.Method != AuthMethodOIDC {
+		t.Errorf("Unexpected identity: %+v", identity)
+	}
+
+	// Logging out takes a same-origin POST, a cross-site link or form can't
+	for _, req := range []struct {
+		method, origin string
+		want           int
+	}{
+		{"GET", "", http.StatusMethodNotAllowed},
+		{"POST", "https://evil.example.com", http.StatusForbidden},
+	} {
+		r, _ := http.NewRequest(req.method, ts.URL+"/auth/logout", nil)
+		if req.origin != "" {
+			r.Header.Set("Origin", req.origin)
+		}
+		resp, err := client.Do(r)
+		if err != nil {
+			t.Fatalf("Logout request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != req.want {
+			t.Errorf("%s logout from %q: expected %d, got %d", req.method, req.origin, req.want, resp.StatusCode)
+		}
+	}
+	if _, status := whoAmI(t, client, ts.URL); status != http.StatusOK {
+		t.Fatalf("Expected the session kept after rejected logouts, got %d", status)
+	}
+
+	// Logging out drops the session
+	r, _ := http.NewRequest("POST", ts.URL+"/auth/logout", nil)
+	r.Header.Set("Origin", ts.URL)
+	resp, err = client.Do(r)
+	if err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+	resp.Body.Close()
+	if _, status := whoAmI(t, client, ts.URL); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 after logout, got %d", status)
+	}
+}
+
+func TestOIDCLoginMapsEmailToViewer(t *testing.T) {
+	issuer := newMockIssuer(t, map[string]interface{}{"email": "Viewer@example.com", "email_verified": true})
+	ts, client := newOIDCTestServer(t, issuer)
+
+	resp, err := client.Get(ts.URL + "/auth/login")
+	if err != nil {
+		t.Fatalf("Login flow failed: %v", err)
+	}
+	resp.Body.Close()
+
+	identity, status := whoAmI(t, client, ts.URL)
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200 after login, got %d", status)
+	}
+	if identity.Role != RoleViewer || identity.CanCommand() {
+		t.Errorf("Expected read-only viewer, got %+v", identity)
+	}
+}
+
+func TestOIDCLoginDeniedWithoutRole(t *testing.T) {
+	issuer := newMockIssuer(t, map[string]interface{}{"email": "stranger@example.com"})
+	ts, client := newOIDCTestServer(t, issuer)
+
+	resp, err := client.Get(ts.URL + "/auth/login")
+	if err != nil {
+		t.Fatalf("Login flow failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for unmapped user, got %d", resp.StatusCode)
+	}
+}
+
+func TestOIDCConfigValidate(t *testing.T) {
+	config := OIDCConfig{IssuerURL: "https://issuer.example.com", ClientID: "console"}
+	if err := config.Validate(); err == nil {
+		t.Error("Expected single sign-on without admin or viewer lists to be rejected")
+	}
+	config.ViewerGroups = []string{"minecraft-viewers"}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Expected valid config, got %v", err)
+	}
+	if err := (OIDCConfig{}).Validate(); err != nil {
+		t.Errorf("Expected disabled single sign-on to be valid, got %v", err)
+	}
+}
+
+func TestOIDCKeepsPreSharedKey(t *testing.T) {
+	issuer := newMockIssuer(t, nil)
+	ts, _ := newOIDCTestServer(t, issuer)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/auth/me", nil)
+	req.Header.Set("X-Auth-Key", "automation-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var identity Identity
+	json.NewDecoder(resp.Body).Decode(&identity)
+	if resp.StatusCode != http.StatusOK || identity.Method != AuthMethodKey {
+		t.Errorf("Expected key authentication to succeed, got %d %+v", resp.StatusCode, identity)
+	}
+}
+
+func TestVerifyIDTokenRejectsTampering(t *testing.T) {
+	issuer := newMockIssuer(t, nil)
+	p := newOIDCProvider(OIDCConfig{IssuerURL: issuer.server.URL, ClientID: "console"})
+
+	token := issuer.sign("nonce")
+	if _, err := p.verifyIDToken(t.Context(), token, "nonce"); err != nil {
+		t.Fatalf("Expected valid token, got %v", err)
+	}
+	if _, err := p.verifyIDToken(t.Context(), token, "other"); err == nil {
+		t.Error("Expected nonce mismatch to be rejected")
+	}
+
+	parts := strings.Split(token, ".")
+	forged, _ := json.Marshal(map[string]interface{}{"iss": issuer.server.URL, "sub": "evil", "aud": "console", "exp": time.Now().Add(time.Hour).Unix(), "nonce": "nonce"})
+	parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+	if _, err := p.verifyIDToken(t.Context(), strings.Join(parts, "."), "nonce"); err == nil {
+		t.Error("Expected forged payload to be rejected")
+	}
+}
+
+func TestOIDCIgnoresUnverifiedEmail(t *testing.T) {
+	for _, verified := range []interface{}{false, "false", nil} {
+		claims := map[string]interface{}{"email": "viewer@example.com"}
+		if verified != nil {
+			claims["email_verified"] = verified
+		}
+		issuer := newMockIssuer(t, claims)
+		ts, client := newOIDCTestServer(t, issuer)
+
+		resp, err := client.Get(ts.URL + "/auth/login")
+		if err != nil {
+			t.Fatalf("Login flow failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("Expected 403 with email_verified %v, got %d", verified, resp.StatusCode)
+		}
+	}
+
+	// Some issuers send the claim as a string
+	issuer := newMockIssuer(t, map[string]interface{}{"email": "viewer@example.com", "email_verified": "true"})
+	ts, client := newOIDCTestServer(t, issuer)
+	resp, err := client.Get(ts.URL + "/auth/login")
+	if err != nil {
+		t.Fatalf("Login flow failed: %v", err)
+	}
+	resp.Body.Close()
+	if identity, _ := whoAmI(t, client, ts.URL); identity.Role != RoleViewer {
+		t.Errorf("Expected a verified email mapped to viewer, got %+v", identity)
+	}
+}
+
+func TestVerifyIDTokenChecksTimes(t *testing.T) {
+	issuer := newMockIssuer(t, nil)
+	p := newOIDCProvider(OIDCConfig{IssuerURL: issuer.server.URL, ClientID: "console"})
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		claim map[string]interface{}
+		valid bool
+	}{
+		{"current", map[string]interface{}{"iat": now.Unix()}, true},
+		{"within skew", map[string]interface{}{"iat": now.Add(time.Minute).Unix(), "nbf": now.Add(time.Minute).Unix()}, true},
+		{"no issue time", map[string]interface{}{}, false},
+		{"issued in the future", map[string]interface{}{"iat": now.Add(time.Hour).Unix()}, false},
+		{"not valid yet", map[string]interface{}{"iat": now.Unix(), "nbf": now.Add(time.Hour).Unix()}, false},
+		{"expired", map[string]interface{}{"iat": now.Add(-2 * time.Hour).Unix(), "exp": now.Add(-time.Hour).Unix()}, false},
+	}
+	for _, tt := range tests {
+		claims := map[string]interface{}{"iss": issuer.server.URL, "sub": "user-1", "aud": "console", "exp": now.Add(time.Hour).Unix(), "nonce": "nonce"}
+		for k, v := range tt.claim {
+			claims[k] = v
+		}
+		_, err := p.verifyIDToken(t.Context(), issuer.signClaims("test", claims), "nonce")
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: expected valid %v, got %v", tt.name, tt.valid, err)
+		}
+	}
+}
+
+func TestSigningKeyRefreshIsRateLimited(t *testing.T) {
+	issuer := newMockIssuer(t, nil)
+	p := newOIDCProvider(OIDCConfig{IssuerURL: issuer.server.URL, ClientID: "console"})
+
+	if _, err := p.signingKey(t.Context(), "test"); err != nil {
+		t.Fatalf("Expected the signing key, got %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, err := p.signingKey(t.Context(), "forged"); err == nil {
+			t.Fatal("Expected an unknown key rejected")
+		}
+	}
+	if issuer.jwksFetches != 1 {
+		t.Errorf("Expected one signing key fetch, got %d", issuer.jwksFetches)
+	}
+
+	// A rotated key is picked up once the delay passed
+	p.mu.Lock()
+	p.keysFetch = time.Now().Add(-jwksRefreshDelay)
+	p.mu.Unlock()
+	p.signingKey(t.Context(), "forged")
+	if issuer.jwksFetches != 2 {
+		t.Errorf("Expected the keys fetched again after the delay, got %d fetches", issuer.jwksFetches)
+	}
+}
+
+func TestOIDCPendingLoginsAreCapped(t *testing.T) {
+	issuer := newMockIssuer(t, nil)
+	ts, _ := newOIDCTestServer(t, issuer)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+
+	for i := 0; i < maxPendingLogins; i++ {
+		resp, err := client.Get(ts.URL + "/auth/login")
+		if err != nil {
+			t.Fatalf("Login failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound {
+			t.Fatalf("Expected a redirect for login %d, got %d", i, resp.StatusCode)
+		}
+	}
+	resp, err := client.Get(ts.URL + "/auth/login")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 once the pending logins are full, got %d", resp.StatusCode)
+	}
+}
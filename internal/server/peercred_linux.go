@@ -0,0 +1,31 @@
+//go:build linux
+
+package server
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// peerName describes the process on the other end of a Unix socket by its
+// user and process id
+func peerName(c net.Conn) string {
+	unixConn, ok := c.(*net.UnixConn)
+	if !ok {
+		return "unix"
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return "unix"
+	}
+
+	var cred *syscall.Ucred
+	raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || cred == nil {
+		return "unix"
+	}
+	return fmt.Sprintf("unix:uid=%d,pid=%d", cred.Uid, cred.Pid)
+}
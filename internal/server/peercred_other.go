@@ -0,0 +1,10 @@
+//go:build !linux
+
+package server
+
+import "net"
+
+// peerName can only identify socket peers on Linux
+func peerName(c net.Conn) string {
+	return "unix"
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultAuthMaxFailures = 5
+	defaultAuthWindow      = time.Minute
+	defaultAuthLockout     = 15 * time.Minute
+)
+
+var (
+	ErrTooManyAttempts = errors.New("too many failed authentication attempts, try again later")
+	ErrTooManyRequests = errors.New("too many requests, try again later")
+)
+
+// authLimiter tracks failed authentication attempts per client address and
+// locks out addresses that fail too often
+type authLimiter struct {
+	maxFailures int
+	window      time.Duration
+	lockout     time.Duration
+	now         func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*authAttempts
+}
+
+type authAttempts struct {
+	failures    int
+	windowStart time.Time
+	lockedUntil time.Time
+}
+
+func newAuthLimiter(maxFailures int, window, lockout time.Duration) *authLimiter {
+	if maxFailures <= 0 {
+		maxFailures = defaultAuthMaxFailures
+	}
+	if window <= 0 {
+		window = defaultAuthWindow
+	}
+	if lockout <= 0 {
+		lockout = defaultAuthLockout
+	}
+	return &authLimiter{
+		maxFailures: maxFailures,
+		window:      window,
+		lockout:     lockout,
+		now:         time.Now,
+		clients:     make(map[string]*authAttempts),
+	}
+}
+
+// lockedOut reports whether the address is currently locked out
+func (l *authLimiter) lockedOut(addr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	attempts, ok := l.clients[addr]
+	return ok && l.now().Before(attempts.lockedUntil)
+}
+
+// fail records a failed attempt and reports whether it triggered a lockout
+func (l *authLimiter) fail(addr string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.pruneLocked(now)
+
+	attempts, ok := l.clients[addr]
+	if !ok || now.Sub(attempts.windowStart) > l.window {
+		attempts = &authAttempts{windowStart: now}
+		l.clients[addr] = attempts
+	}
+
+	attempts.failures++
+	if attempts.failures >= l.maxFailures {
+		attempts.lockedUntil = now.Add(l.lockout)
+		attempts.failures = 0
+		attempts.windowStart = now
+		return true
+	}
+	return false
+}
+
+// succeed clears the failure history of an address
+func (l *authLimiter) succeed(addr string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.clients, addr)
+}
+
+// pruneLocked forgets addresses with no recent failures or active lockout
+func (l *authLimiter) pruneLocked(now time.Time) {
+	for addr, attempts := range l.clients {
+		if now.After(attempts.lockedUntil) && now.Sub(attempts.windowStart) > l.window {
+			delete(l.clients, addr)
+		}
+	}
+}
+
+// requestLimiter caps the number of requests each client address makes per
+// window, counted in fixed windows
+type requestLimiter struct {
+	limit  int // Requests allowed per window, 0 disables the limit
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*requestCount
+}
+
+type requestCount struct {
+	count       int
+	windowStart time.Time
+}
+
+func newRequestLimiter(limit int, window time.Duration) *requestLimiter {
+	return &requestLimiter{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		clients: make(map[string]*requestCount),
+	}
+}
+
+// allow counts a request and reports whether the address is within its limit
+func (l *requestLimiter) allow(addr string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	requests, ok := l.clients[addr]
+	if !ok || now.Sub(requests.windowStart) >= l.window {
+		// Forget addresses that went quiet while starting a new window
+		for other, r := range l.clients {
+			if now.Sub(r.windowStart) >= l.window {
+				delete(l.clients, other)
+			}
+		}
+		requests = &requestCount{windowStart: now}
+		l.clients[addr] = requests
+	}
+	requests.count++
+	return requests.count <= l.limit
+}
+
+// ParseTrustedProxies parses a comma separated list of proxy addresses or
+// CIDR ranges, e.g. "10.0.0.0/8,192.0.2.1"
+func ParseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(item); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %v", item, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// clientAddr returns the remote IP of a request without the port. Requests
+// from a trusted proxy are attributed to the address it forwarded them for:
+// the last X-Forwarded-For entry that isn't itself a trusted proxy.
+func (s *Server) clientAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	if !s.trustedProxy(host) {
+		return host
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, addr := range strings.Split(header, ",") {
+			forwarded = append(forwarded, strings.TrimSpace(addr))
+		}
+	}
+	// Proxies append the address they received the request from, so only
+	// entries added by trusted proxies can be relied on
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(forwarded[i])
+		if err != nil {
+			break
+		}
+		host = addr.Unmap().String()
+		if !s.trustedProxy(host) {
+			break
+		}
+	}
+	return host
+}
+
+// trustedProxy reports whether addr is in the configured trusted proxies
+func (s *Server) trustedProxy(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOrigin validates the Origin header of WebSocket upgrade and logout
+// requests. Requests without an Origin come from non-browser clients and are
+// allowed. With no configured origins only same-origin requests are
+// accepted, "*" accepts every origin.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if len(s.allowedOrigins) == 0 {
+		u, err := url.Parse(origin)
+		if err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		fmt.Printf("Rejected cross-origin request to %s from %s with origin %s\n", r.URL.Path, s.clientAddr(r), origin)
+		return false
+	}
+
+	for _, allowed := range s.allowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	fmt.Printf("Rejected request to %s from %s with origin %s\n", r.URL.Path, s.clientAddr(r), origin)
+	return false
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+func TestAuthLimiterLocksOutAfterRepeatedFailures(t *testing.T) {
+	now := time.Now()
+	l := newAuthLimiter(3, time.Minute, 10*time.Minute)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if l.fail("10.0.0.1") {
+			t.Fatalf("Locked out after only %d failures", i+1)
+		}
+	}
+	if !l.fail("10.0.0.1") {
+		t.Fatal("Expected lockout on the third failure")
+	}
+	if !l.lockedOut("10.0.0.1") {
+		t.Error("Expected address to be locked out")
+	}
+	if l.lockedOut("10.0.0.2") {
+		t.Error("Other addresses must not be affected")
+	}
+
+	now = now.Add(11 * time.Minute)
+	if l.lockedOut("10.0.0.1") {
+		t.Error("Expected lockout to expire")
+	}
+}
+
+func TestAuthLimiterFailuresExpireWithWindow(t *testing.T) {
+	now := time.Now()
+	l := newAuthLimiter(2, time.Minute, 10*time.Minute)
+	l.now = func() time.Time { return now }
+
+	l.fail("10.0.0.1")
+	now = now.Add(2 * time.Minute)
+	if l.fail("10.0.0.1") {
+		t.Error("Failures outside the window should not count towards a lockout")
+	}
+}
+
+func TestAuthMiddlewareLockout(t *testing.T) {
+	srv := New(ServerConfig{Runner: runner.New("true"), AuthKey: "secret", AuthMaxFailures: 2})
+	handler := srv.Handler()
+
+	request := func(key string) int {
+		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		req.RemoteAddr = "192.0.2.10:5000"
+		req.Header.Set("X-Auth-Key", key)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := request("wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401, got %d", code)
+	}
+	if code := request("secret"); code != http.StatusOK {
+		t.Fatalf("Expected a valid key to succeed and reset failures, got %d", code)
+	}
+
+	request("wrong")
+	request("wrong")
+	if code := request("secret"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 while locked out even with a valid key, got %d", code)
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"no origin header", nil, "", true},
+		{"same origin by default", nil, "http://console.example.com", true},
+		{"cross origin rejected by default", nil, "http://evil.example.com", false},
+		{"listed origin", []string{"https://admin.example.com"}, "https://admin.example.com", true},
+		{"unlisted origin", []string{"https://admin.example.com"}, "https://evil.example.com", false},
+		{"wildcard", []string{"*"}, "https://anything.example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &Server{allowedOrigins: tt.allowed}
+			req := httptest.NewRequest(http.MethodGet, "http://console.example.com/ws", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if got := srv.checkOrigin(req); got != tt.want {
+				t.Errorf("checkOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebSocketRejectsForeignOrigin(t *testing.T) {
+	srv := New(ServerConfig{Runner: runner.New("true"), AuthKey: "secret"})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?auth=secret"
+	header := http.Header{"Origin": {"http://evil.example.com"}}
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err == nil {
+		t.Fatal("Expected connection from foreign origin to fail")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected 403 for foreign origin, got %v", resp)
+	}
+}
+
+func TestClientAddrTrustedProxies(t *testing.T) {
+	proxies, err := ParseTrustedProxies("10.0.0.0/8, 192.0.2.1")
+	if err != nil {
+		t.Fatalf("Failed to parse trusted proxies: %v", err)
+	}
+	srv := New(ServerConfig{Runner: runner.New("true"), TrustedProxies: proxies})
+
+	tests := []struct {
+		remote    string
+		forwarded string
+		want      string
+	}{
+		{"198.51.100.7:5000", "203.0.113.9", "198.51.100.7"},      // Not a proxy, the header is ignored
+		{"192.0.2.1:5000", "203.0.113.9", "203.0.113.9"},          // Single trusted proxy
+		{"10.1.2.3:5000", "203.0.113.9, 10.0.0.5", "203.0.113.9"}, // Chain of trusted proxies
+		{"10.1.2.3:5000", "6.6.6.6, 203.0.113.9", "203.0.113.9"},  // Spoofed leading entries are skipped
+		{"10.1.2.3:5000", "", "10.1.2.3"},                         // Proxy without the header
+		{"10.1.2.3:5000", "garbage, 203.0.113.9", "203.0.113.9"},  // Invalid entries stop the walk
+		{"10.1.2.3:5000", "203.0.113.9, garbage", "10.1.2.3"},     // An invalid last entry isn't trusted
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/status", nil)
+		req.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := srv.clientAddr(req); got != tt.want {
+			t.Errorf("%s with %q: expected %s, got %s", tt.remote, tt.forwarded, tt.want, got)
+		}
+	}
+
+	if _, err := ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("Expected an error for an invalid range")
+	}
+}
+
+func TestRequestLimiter(t *testing.T) {
+	now := time.Now()
+	l := newRequestLimiter(2, time.Minute)
+	l.now = func() time.Time { return now }
+
+	if !l.allow("10.0.0.1") || !l.allow("10.0.0.1") {
+		t.Fatal("Expected requests within the limit to be allowed")
+	}
+	if l.allow("10.0.0.1") {
+		t.Error("Expected the third request in the window to be rejected")
+	}
+	if !l.allow("10.0.0.2") {
+		t.Error("Other addresses must not be affected")
+	}
+
+	now = now.Add(time.Minute)
+	if !l.allow("10.0.0.1") {
+		t.Error("Expected the limit to reset with the window")
+	}
+}
+
+func TestAuthMiddlewareRateLimit(t *testing.T) {
+	srv := New(ServerConfig{Runner: runner.New("true"), AuthKey: "secret", RateLimit: 2})
+	handler := srv.Handler()
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/auth/me", nil)
+		req.RemoteAddr = "192.0.2.10:5000"
+		req.Header.Set("X-Auth-Key", "secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Request %d: expected %d, got %d", i+1, want, rec.Code)
+		}
+	}
+}
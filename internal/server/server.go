@@ -1,44 +1,129 @@
 package server
 
 import (
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/netip"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/jsandas/bedrock-server/internal/audit"
+	"github.com/jsandas/bedrock-server/internal/broker"
+	"github.com/jsandas/bedrock-server/internal/consolelog"
+	"github.com/jsandas/bedrock-server/internal/downloader"
+	"github.com/jsandas/bedrock-server/internal/events"
 	"github.com/jsandas/bedrock-server/internal/runner"
+	"github.com/jsandas/bedrock-server/internal/scheduler"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for now, should be configured in production
-	},
+const (
+	DefaultBufferSize = 1000             // Lines kept for replay to new clients
+	wsWriteTimeout    = 10 * time.Second // Maximum time to write one message to a client
+)
+
+// Process is the Bedrock server the console talks to, a Runner or a
+// restartable Supervisor
+type Process interface {
+	WriteInput(input string)
+	GetOutputChan() <-chan runner.Line
 }
 
 // Server handles the HTTP endpoints and web UI
 type Server struct {
-	runner       *runner.Runner
-	connections  map[*websocket.Conn]bool
-	connLock     sync.RWMutex
-	outputBuffer []string
-	authKey      string // Pre-shared key for authentication
+	runner     Process
+	broker     *broker.Broker[runner.Line]  // Distributes output to WebSocket clients
+	events     *broker.Broker[events.Event] // Distributes events parsed from the output
+	statusLock sync.RWMutex
+	status     Status
+	download   *downloader.Progress
+	lastBackup time.Time
+	players    map[string]bool // Players online, tracked from join and leave events
+	authKey    string          // Pre-shared key for authentication
+	oidc       *oidcProvider   // Optional single sign-on, nil when disabled
+	roles      OIDCConfig      // Admin and viewer lists, also applied to client certificates
+	tls        TLSConfig
+	upgrader   websocket.Upgrader
+	limiter    *authLimiter
+	requests   *requestLimiter
+	audit      *audit.Logger // Optional command audit log, nil when disabled
+	consoleLog *consolelog.Log
+	scheduler  *scheduler.Scheduler // Optional announcement scheduler, nil when disabled
+	versions   VersionManager       // Optional version switching, nil when disabled
+
+	appDir         string // Where the Bedrock server is installed, for the status API
+	wrapperVersion string
+
+	// Origins allowed to open WebSocket connections, empty means same-origin only
+	allowedOrigins []string
+	// Proxies whose X-Forwarded-For header is believed, empty trusts none
+	trustedProxies []netip.Prefix
 }
 
 // ServerConfig holds configuration for the server
 type ServerConfig struct {
-	Runner  *runner.Runner
-	AuthKey string
+	Runner     Process
+	AuthKey    string
+	OIDC       OIDCConfig
+	TLS        TLSConfig
+	BufferSize int    // Output lines kept for replay, defaults to DefaultBufferSize
+	Channel    string // Release channel of the server, reported in the status
+
+	AppDir         string // Where the Bedrock server is installed, read by the status API
+	WrapperVersion string // Version of this wrapper, reported by the status API
+
+	AllowedOrigins  []string      // Origins allowed to connect to /ws, "*" allows any
+	AuthMaxFailures int           // Failed key attempts before an address is locked out
+	AuthLockout     time.Duration // How long a locked out address is rejected
+	RateLimit       int           // Requests per minute allowed from one address, 0 disables the limit
+
+	TrustedProxies []netip.Prefix // Proxies allowed to set X-Forwarded-For
+
+	Audit      *audit.Logger   // Records every command sent to the server when set
+	ConsoleLog *consolelog.Log // Persists server output when set
+
+	Scheduler *scheduler.Scheduler // Exposes scheduled announcements through the API when set
+	Versions  VersionManager       // Exposes installed versions and switching through the API when set
 }
 
 // New creates a new Server instance
 func New(config ServerConfig) *Server {
+	bufferSize := config.BufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+
 	srv := &Server{
-		runner:      config.Runner,
-		connections: make(map[*websocket.Conn]bool),
-		authKey:     config.AuthKey,
+		runner:     config.Runner,
+		broker:     broker.New[runner.Line](bufferSize),
+		events:     broker.New[events.Event](bufferSize),
+		status:     Status{State: StateStarting, Since: time.Now(), Channel: config.Channel},
+		players:    make(map[string]bool),
+		authKey:    config.AuthKey,
+		roles:      config.OIDC,
+		tls:        config.TLS,
+		limiter:    newAuthLimiter(config.AuthMaxFailures, defaultAuthWindow, config.AuthLockout),
+		requests:   newRequestLimiter(config.RateLimit, time.Minute),
+		audit:      config.Audit,
+		consoleLog: config.ConsoleLog,
+		scheduler:  config.Scheduler,
+		versions:   config.Versions,
+
+		appDir:         config.AppDir,
+		wrapperVersion: config.WrapperVersion,
+
+		allowedOrigins: config.AllowedOrigins,
+		trustedProxies: config.TrustedProxies,
+	}
+	srv.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     srv.checkOrigin,
+	}
+	if config.OIDC.Enabled() {
+		srv.oidc = newOIDCProvider(config.OIDC)
 	}
 
 	// Start goroutine to handle runner output
@@ -49,93 +134,152 @@ func New(config ServerConfig) *Server {
 
 // Start begins the HTTP server
 func (s *Server) Start(addr string) error {
+	if !s.tls.Enabled() {
+		fmt.Printf("Web server started at http://%s\n", addr)
+		return http.ListenAndServe(addr, s.Handler())
+	}
+
+	tlsConfig, err := buildTLSConfig(s.tls)
+	if err != nil {
+		return err
+	}
+	httpServer := &http.Server{
+		Addr:      addr,
+		Handler:   s.Handler(),
+		TLSConfig: tlsConfig,
+	}
+
+	fmt.Printf("Web server started at https://%s\n", addr)
+	// Certificates are supplied by the TLS config
+	return httpServer.ListenAndServeTLS("", "")
+}
+
+// Handler returns the HTTP handler serving the web UI and API
+func (s *Server) Handler() http.Handler {
 	// Create a new ServeMux for our routes
 	mux := http.NewServeMux()
 
 	// Index page doesn't require auth
 	mux.HandleFunc("/", s.handleIndex)
 
+	// Single sign-on routes are only registered when OIDC is configured
+	if s.oidc != nil {
+		mux.HandleFunc("/auth/login", s.oidc.handleLogin)
+		mux.HandleFunc("/auth/callback", s.oidc.handleCallback)
+		mux.HandleFunc("/auth/logout", s.handleLogout)
+	}
+
 	// Protected routes with auth middleware
 	mux.HandleFunc("/ws", s.authMiddleware(s.handleWebSocket))
-
-	fmt.Printf("Web server started at http://%s\n", addr)
-	return http.ListenAndServe(addr, mux)
+	mux.HandleFunc("/api/stream", s.authMiddleware(s.handleStream))
+	mux.HandleFunc("/auth/me", s.authMiddleware(s.handleWhoAmI))
+	mux.HandleFunc("/api/audit", s.authMiddleware(s.handleAudit))
+	mux.HandleFunc("/api/logs", s.authMiddleware(s.handleLogs))
+	mux.HandleFunc("/api/announcements", s.authMiddleware(s.handleAnnouncements))
+	mux.HandleFunc("/api/announcements/", s.authMiddleware(s.handleAnnouncement))
+	mux.HandleFunc("/api/status", s.authMiddleware(s.handleStatus))
+	mux.HandleFunc("/api/download", s.authMiddleware(s.handleDownload))
+	mux.HandleFunc("/api/versions", s.authMiddleware(s.handleVersions))
+	mux.HandleFunc("/api/versions/switch", s.authMiddleware(s.handleVersionSwitch))
+	mux.HandleFunc("/api/versions/rollback", s.authMiddleware(s.handleVersionRollback))
+	mux.HandleFunc("/api/versions/unpin", s.authMiddleware(s.handleVersionUnpin))
+
+	return mux
 }
 
-func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		fmt.Printf("Error upgrading to WebSocket: %v\n", err)
-		return
+// handleRunnerOutput persists every line and hands it to the broker. The
+// broker never blocks, so a slow client can't hold up the runner.
+func (s *Server) handleRunnerOutput() {
+	for line := range s.runner.GetOutputChan() {
+		s.publish(line)
 	}
-	defer conn.Close()
-
-	// Register connection
-	s.connLock.Lock()
-	s.connections[conn] = true
-	s.connLock.Unlock()
-
-	// Clean up on disconnect
-	defer func() {
-		s.connLock.Lock()
-		delete(s.connections, conn)
-		s.connLock.Unlock()
-	}()
-
-	// Send initial buffer
-	s.connLock.RLock()
-	for _, line := range s.outputBuffer {
-		err := conn.WriteMessage(websocket.TextMessage, []byte(line))
-		if err != nil {
-			s.connLock.RUnlock()
-			return
-		}
+
+	// Output ends when the process exits, without a clean shutdown it crashed
+	if s.Status().State != StateStopped {
+		s.Emit(events.Event{Type: events.ServerCrashed, Message: "server process exited unexpectedly"})
 	}
-	s.connLock.RUnlock()
+	s.broker.Close()
+	s.events.Close()
+}
 
-	// Handle incoming messages (stdin)
-	for {
-		_, message, err := conn.ReadMessage()
-		if err != nil {
-			break
+// publish persists a line, distributes it to clients and raises any event
+// parsed from it
+func (s *Server) publish(line runner.Line) runner.Line {
+	// Persist before anything else so history survives restarts
+	if s.consoleLog != nil {
+		if err := s.consoleLog.Write(line); err != nil {
+			fmt.Printf("%v\n", err)
 		}
+	}
+	line = s.broker.Publish(line)
 
-		// Check if this is the authentication message
-		if len(message) > 0 && message[0] == '{' {
-			continue // Skip the auth message as it's already handled by the middleware
-		}
+	if event, ok := events.Parse(line); ok {
+		s.Emit(event)
+	}
+	return line
+}
+
+// Emit distributes an event to clients and updates the server status
+func (s *Server) Emit(event events.Event) events.Event {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
 
-		s.runner.WriteInput(string(message))
+	switch event.Type {
+	case events.ServerStarting:
+		s.setState(StateStarting)
+	case events.ServerStarted:
+		s.setState(StateRunning)
+	case events.ServerStopping:
+		s.setState(StateStopping)
+	case events.ServerStopped:
+		s.setState(StateStopped)
+	case events.ServerCrashed:
+		s.setState(StateCrashed)
 	}
+	s.trackPlayers(event)
+	s.trackBackups(event)
+	return s.events.Publish(event)
 }
 
-func (s *Server) handleRunnerOutput() {
-	for line := range s.runner.GetOutputChan() {
-		// Store in buffer
-		s.connLock.Lock()
-		s.outputBuffer = append(s.outputBuffer, line)
-		// Keep buffer size reasonable
-		if len(s.outputBuffer) > 1000 {
-			s.outputBuffer = s.outputBuffer[len(s.outputBuffer)-1000:]
-		}
-		s.connLock.Unlock()
-
-		// Broadcast to all connections
-		s.connLock.RLock()
-		for conn := range s.connections {
-			err := conn.WriteMessage(websocket.TextMessage, []byte(line))
-			if err != nil {
-				conn.Close()
-				delete(s.connections, conn)
-			}
-		}
-		s.connLock.RUnlock()
+// SubscribeEvents subscribes to events as they are emitted, e.g. to send
+// notifications. The subscription closes when the server process exits.
+func (s *Server) SubscribeEvents() *broker.Subscription[events.Event] {
+	sub, _ := s.events.Subscribe(broker.DefaultQueueSize)
+	return sub
+}
+
+// Log writes a wrapper message to stdout and the console stream
+func (s *Server) Log(format string, args ...interface{}) {
+	text := fmt.Sprintf(format, args...)
+	fmt.Println(text)
+	s.publish(runner.NewLine(runner.StreamWrapper, text))
+}
+
+// handleWhoAmI returns the identity of the authenticated caller
+func (s *Server) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	identity, _ := IdentityFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(identity)
+}
+
+// handleLogout ends a single sign-on session. Only same-origin POSTs are
+// accepted so another site can't log a console user out with a link.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
+	if !s.checkOrigin(r) {
+		http.Error(w, "cross-origin request rejected", http.StatusForbidden)
+		return
+	}
+	s.oidc.handleLogout(w, r)
 }
 
 func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
 	tmpl := template.Must(template.New("index").Parse(htmlTemplate))
-	tmpl.Execute(w, nil)
+	tmpl.Execute(w, struct{ OIDCEnabled bool }{OIDCEnabled: s.oidc != nil})
 }
 
 const htmlTemplate = `
@@ -161,6 +305,14 @@ const htmlTemplate = `
         }
         .stdout { color: #6A9955; }
         .stderr { color: #F44747; }
+        .wrapper { color: #569CD6; }
+        .level-warn { color: #DCDCAA; }
+        .level-error { color: #F44747; }
+        .level-debug { color: #808080; }
+        #output.hide-debug .level-debug,
+        #output.min-warn .level-info, #output.min-warn .level-debug, #output.min-warn .level-none,
+        #output.hide-wrapper .wrapper { display: none; }
+        #filters { margin-bottom: 10px; font-size: 12px; }
         .disconnected { color: #F44747; font-style: italic; }
         #input-container {
             display: flex;
@@ -196,16 +348,63 @@ const htmlTemplate = `
         }
         .status.connected { background: #6A9955; }
         .status.disconnected { background: #F44747; }
+        #session { font-size: 12px; }
+        #history { margin-top: 30px; }
+        #history-controls { display: flex; gap: 10px; margin-bottom: 10px; }
+        #history-controls input {
+            padding: 8px;
+            background: #2d2d2d;
+            border: 1px solid #3d3d3d;
+            border-radius: 4px;
+            color: #d4d4d4;
+            font-family: monospace;
+        }
+        #history-pattern { flex-grow: 1; }
+        #history-output {
+            white-space: pre-wrap;
+            padding: 10px;
+            background: #2d2d2d;
+            border-radius: 5px;
+            height: 300px;
+            overflow-y: auto;
+        }
+        .timestamp { color: #808080; }
+        #session button {
+            padding: 0;
+            background: none;
+            border: none;
+            color: #569CD6;
+            font-size: 12px;
+            text-decoration: underline;
+            cursor: pointer;
+        }
     </style>
     <script>
         let ws;
+        let lastSeq = 0;
+        let commandId = 0;
         let reconnectAttempts = 0;
         const maxReconnectAttempts = 5;
 
+        const oidcEnabled = {{.OIDCEnabled}};
+        let sessionUser = null;
+
+        async function checkSession() {
+            if (!oidcEnabled || localStorage.getItem('authKey')) return;
+            const resp = await fetch('/auth/me');
+            if (resp.ok) {
+                sessionUser = await resp.json();
+                document.getElementById('user').textContent = sessionUser.name + ' (' + sessionUser.role + ')';
+                document.getElementById('logout').style.display = 'inline';
+            } else {
+                window.location = '/auth/login';
+            }
+        }
+
         function connect() {
             const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
             let authKey = localStorage.getItem('authKey');
-            if (!authKey) {
+            if (!authKey && !sessionUser) {
                 authKey = prompt('Please enter your authentication key:');
                 if (authKey) {
                     localStorage.setItem('authKey', authKey);
@@ -215,9 +414,16 @@ const htmlTemplate = `
                 }
             }
             
-            // Add auth key as a query parameter
+            // Add auth key as a query parameter, SSO sessions use the cookie instead
             const wsUrl = new URL(protocol + '//' + window.location.host + '/ws');
-            wsUrl.searchParams.append('auth', authKey);
+            wsUrl.searchParams.append('format', 'json');
+            if (authKey) {
+                wsUrl.searchParams.append('auth', authKey);
+            }
+            // Only replay what was missed while disconnected
+            if (lastSeq > 0) {
+                wsUrl.searchParams.append('since', lastSeq);
+            }
             ws = new WebSocket(wsUrl.toString());
 
             ws.onopen = function() {
@@ -249,13 +455,26 @@ const htmlTemplate = `
             };
 
             ws.onmessage = function(event) {
-                const line = event.data;
-                const output = document.getElementById('output');
-                const div = document.createElement('div');
-                div.className = line.startsWith('[ERR]') ? 'stderr' : 'stdout';
-                div.textContent = line;
-                output.appendChild(div);
-                output.scrollTop = output.scrollHeight;
+                const msg = JSON.parse(event.data);
+                switch (msg.type) {
+                case 'output':
+                    if (msg.line.seq <= lastSeq) return; // Already shown
+                    lastSeq = msg.line.seq;
+                    appendLine(msg.line);
+                    break;
+                case 'gap':
+                    appendNotice(msg.gap.reset
+                        ? 'Server output restarted'
+                        : (msg.gap.to - msg.gap.from + 1) + ' lines were missed while disconnected');
+                    if (msg.gap.reset) lastSeq = 0;
+                    break;
+                case 'status':
+                    document.getElementById('server-state').textContent = 'Server ' + msg.status.state;
+                    break;
+                case 'error':
+                    appendNotice('Command failed: ' + msg.error);
+                    break;
+                }
             };
 
             ws.onerror = function(error) {
@@ -263,16 +482,83 @@ const htmlTemplate = `
             };
         }
 
+        // appendLine renders a structured output line, classed by stream and
+        // level so the filters can hide it with CSS
+        function appendLine(line) {
+            const output = document.getElementById('output');
+            const atBottom = output.scrollTop + output.clientHeight >= output.scrollHeight - 5;
+            const div = document.createElement('div');
+            div.className = line.stream + ' level-' + (line.level || 'none');
+            div.title = new Date(line.time).toLocaleString() + ' #' + line.seq;
+            div.textContent = line.text;
+            output.appendChild(div);
+            if (atBottom) output.scrollTop = output.scrollHeight;
+        }
+
+        function appendNotice(text) {
+            const output = document.getElementById('output');
+            const div = document.createElement('div');
+            div.className = 'disconnected';
+            div.textContent = text;
+            output.appendChild(div);
+        }
+
+        function applyFilters() {
+            const output = document.getElementById('output');
+            const level = document.getElementById('level-filter').value;
+            output.classList.toggle('hide-debug', level === 'info');
+            output.classList.toggle('min-warn', level === 'warn');
+            output.classList.toggle('hide-wrapper', !document.getElementById('show-wrapper').checked);
+        }
+
         function sendCommand() {
             const input = document.getElementById('command-input');
             const command = input.value;
             if (command.trim() === '' || !ws || ws.readyState !== WebSocket.OPEN) return;
 
-            ws.send(command);
+            ws.send(JSON.stringify({ v: 1, type: 'command', id: String(++commandId), command: command }));
             input.value = '';
         }
 
-        document.addEventListener('DOMContentLoaded', function() {
+        // authHeaders returns the key header, SSO sessions rely on the cookie
+        function authHeaders() {
+            const authKey = localStorage.getItem('authKey');
+            return authKey ? { 'X-Auth-Key': authKey } : {};
+        }
+
+        async function searchHistory() {
+            const params = new URLSearchParams();
+            const since = document.getElementById('history-since').value;
+            const until = document.getElementById('history-until').value;
+            const pattern = document.getElementById('history-pattern').value;
+            if (since) params.set('since', new Date(since).toISOString());
+            if (until) params.set('until', new Date(until).toISOString());
+            if (pattern) params.set('q', pattern);
+
+            const output = document.getElementById('history-output');
+            output.textContent = 'Searching...';
+            const resp = await fetch('/api/logs?' + params.toString(), { headers: authHeaders() });
+            if (!resp.ok) {
+                output.textContent = 'Search failed: ' + await resp.text();
+                return;
+            }
+
+            const records = await resp.json();
+            output.textContent = records.length ? '' : 'No matching lines';
+            for (const record of records) {
+                const div = document.createElement('div');
+                div.className = record.stream;
+                const stamp = document.createElement('span');
+                stamp.className = 'timestamp';
+                stamp.textContent = new Date(record.time).toLocaleString() + ' ';
+                div.appendChild(stamp);
+                div.appendChild(document.createTextNode(record.text));
+                output.appendChild(div);
+            }
+            output.scrollTop = output.scrollHeight;
+        }
+
+        document.addEventListener('DOMContentLoaded', async function() {
             const input = document.getElementById('command-input');
             input.addEventListener('keypress', function(e) {
                 if (e.key === 'Enter') {
@@ -280,18 +566,44 @@ const htmlTemplate = `
                     sendCommand();
                 }
             });
+            await checkSession();
+            if (sessionUser && sessionUser.role !== 'admin') {
+                input.disabled = true;
+                input.placeholder = 'Read-only access';
+            }
             connect();
         });
     </script>
 </head>
 <body>
     <div id="status" class="status disconnected">Disconnected</div>
+    <div id="session"><span id="server-state"></span> <span id="user"></span> <form id="logout" method="post" action="/auth/logout" style="display:none"><button type="submit">Log out</button></form></div>
     <h1>Minecraft Server Output</h1>
+    <div id="filters">
+        <label>Level
+            <select id="level-filter" onchange="applyFilters()">
+                <option value="all">All</option>
+                <option value="info">Info and above</option>
+                <option value="warn">Warnings and errors</option>
+            </select>
+        </label>
+        <label><input type="checkbox" id="show-wrapper" checked onchange="applyFilters()"> Wrapper messages</label>
+    </div>
     <div id="output"></div>
     <div id="input-container">
         <input type="text" id="command-input" placeholder="Type a command and press Enter">
         <button onclick="sendCommand()">Send</button>
     </div>
+    <div id="history">
+        <h2>Log History</h2>
+        <div id="history-controls">
+            <input type="datetime-local" id="history-since" title="From">
+            <input type="datetime-local" id="history-until" title="Until">
+            <input type="text" id="history-pattern" placeholder="Regular expression, e.g. Player (connected|disconnected)">
+            <button onclick="searchHistory()">Search</button>
+        </div>
+        <div id="history-output"></div>
+    </div>
 </body>
 </html>
 `
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jsandas/bedrock-server/internal/events"
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+// newTestServer starts the console with a runner that is never started, so
+// tests can publish output directly
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	t.Helper()
+	srv := New(ServerConfig{Runner: runner.New("true"), AuthKey: "secret"})
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return srv, ts
+}
+
+func dialWS(t *testing.T, ts *httptest.Server, query string) *websocket.Conn {
+	t.Helper()
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws?auth=secret" + query
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn
+}
+
+// readMessage reads the next protocol message, skipping the given types
+func readMessage(t *testing.T, conn *websocket.Conn, skip ...string) Message {
+	t.Helper()
+	for {
+		var msg Message
+		if err := conn.ReadJSON(&msg); err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		if msg.V != ProtocolVersion {
+			t.Fatalf("Expected protocol version %d, got %+v", ProtocolVersion, msg)
+		}
+		if !containsString(skip, msg.Type) {
+			return msg
+		}
+	}
+}
+
+func TestWebSocketSendsStructuredLines(t *testing.T) {
+	srv, ts := newTestServer(t)
+	srv.publish(runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:00:000 INFO] Server started."))
+
+	conn := dialWS(t, ts, "&format=json")
+	if msg := readMessage(t, conn); msg.Type != MessageStatus || msg.Status.State != StateRunning {
+		t.Fatalf("Expected running status first, got %+v", msg)
+	}
+	srv.publish(runner.NewLine(runner.StreamStderr, "something broke"))
+	srv.Log("wrapper message")
+
+	want := []runner.Line{
+		{Seq: 1, Stream: runner.StreamStdout, Level: runner.LevelInfo, Text: "[2024-01-01 12:00:00:000 INFO] Server started."},
+		{Seq: 2, Stream: runner.StreamStderr, Level: runner.LevelError, Text: "something broke"},
+		{Seq: 3, Stream: runner.StreamWrapper, Text: "wrapper message"},
+	}
+	for _, expected := range want {
+		msg := readMessage(t, conn)
+		if msg.Type != MessageOutput || msg.Line == nil {
+			t.Fatalf("Expected output message, got %+v", msg)
+		}
+		line := *msg.Line
+		if line.Seq != expected.Seq || line.Stream != expected.Stream || line.Level != expected.Level || line.Text != expected.Text || line.Time.IsZero() {
+			t.Errorf("Expected %+v, got %+v", expected, line)
+		}
+	}
+}
+
+func TestWebSocketCommandAck(t *testing.T) {
+	r := runner.New("cat")
+	if err := r.Start(); err != nil {
+		t.Fatalf("Failed to start runner: %v", err)
+	}
+	srv := New(ServerConfig{Runner: r, AuthKey: "secret"})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	conn := dialWS(t, ts, "&format=json")
+	tests := []struct {
+		message   string
+		wantType  string
+		wantID    string
+		wantError string
+	}{
+		{`{"v":1,"type":"command","id":"a1","command":"list"}`, MessageAck, "a1", ""},
+		{`{"v":1,"type":"command","id":"a2","command":"  "}`, MessageError, "a2", "empty command"},
+		{`{"v":2,"type":"command","id":"a3","command":"list"}`, MessageError, "a3", "unsupported protocol version 2"},
+		{`{"v":1,"type":"subscribe","id":"a4"}`, MessageError, "a4", `unknown message type "subscribe"`},
+	}
+	echoed := false
+	for _, tt := range tests {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(tt.message)); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+		msg := readMessage(t, conn, MessageStatus, MessageEvent)
+		// cat echoes the acknowledged command back as output
+		for msg.Type == MessageOutput {
+			echoed = echoed || msg.Line.Text == "list"
+			msg = readMessage(t, conn, MessageStatus, MessageEvent)
+		}
+		if msg.Type != tt.wantType || msg.ID != tt.wantID || msg.Error != tt.wantError {
+			t.Errorf("%s: expected %s %q %q, got %+v", tt.message, tt.wantType, tt.wantID, tt.wantError, msg)
+		}
+	}
+
+	for !echoed {
+		msg := readMessage(t, conn, MessageStatus, MessageEvent)
+		echoed = msg.Type == MessageOutput && msg.Line.Text == "list"
+	}
+}
+
+func TestRunCommandRejectsViewer(t *testing.T) {
+	srv, _ := newTestServer(t)
+	client := &wsClient{
+		server:   srv,
+		request:  httptest.NewRequest("GET", "/ws", nil),
+		identity: Identity{Subject: "viewer", Role: RoleViewer, Method: AuthMethodOIDC},
+	}
+
+	reply := client.runCommand(Message{ID: "7", Command: "stop"})
+	if reply.Type != MessageError || reply.ID != "7" || reply.Error != "read-only access" {
+		t.Errorf("Expected read-only error, got %+v", reply)
+	}
+}
+
+func TestReplyAfterWriterExits(t *testing.T) {
+	client := &wsClient{replies: make(chan Message), done: make(chan struct{})}
+	close(client.done)
+
+	result := make(chan bool)
+	go func() { result <- client.reply(Message{Type: MessageAck}) }()
+	select {
+	case ok := <-result:
+		if ok {
+			t.Error("Expected the reply to be dropped once the writer exited")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Reader blocked on a reply after the writer exited")
+	}
+}
+
+func TestWebSocketSendsEvents(t *testing.T) {
+	srv, ts := newTestServer(t)
+	conn := dialWS(t, ts, "&format=json")
+	if msg := readMessage(t, conn); msg.Type != MessageStatus || msg.Status.State != StateStarting {
+		t.Fatalf("Expected starting status first, got %+v", msg)
+	}
+
+	srv.publish(runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:00:000 INFO] Player connected: Steve, xuid: 2535400000000000"))
+	msg := readMessage(t, conn, MessageOutput)
+	if msg.Type != MessageEvent || msg.Event.Type != events.PlayerJoined || msg.Event.Player != "Steve" {
+		t.Errorf("Expected player joined event, got %+v", msg)
+	}
+
+	srv.publish(runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:01:000 INFO] Server started."))
+	if msg := readMessage(t, conn, MessageOutput, MessageEvent); msg.Type != MessageStatus || msg.Status.State != StateRunning {
+		t.Errorf("Expected running status after start, got %+v", msg)
+	}
+}
+
+func TestWebSocketSendsStartingStatus(t *testing.T) {
+	srv, ts := newTestServer(t)
+	srv.Emit(events.Event{Type: events.ServerStarted})
+	conn := dialWS(t, ts, "&format=json")
+	if msg := readMessage(t, conn); msg.Type != MessageStatus || msg.Status.State != StateRunning {
+		t.Fatalf("Expected running status first, got %+v", msg)
+	}
+
+	// A restart or update starting the server again is reported as it begins
+	srv.Emit(events.Event{Type: events.ServerStarting, Message: "starting 1.21.0"})
+	if msg := readMessage(t, conn, MessageEvent); msg.Type != MessageStatus || msg.Status.State != StateStarting {
+		t.Errorf("Expected starting status, got %+v", msg)
+	}
+}
+
+func TestWebSocketTextByDefault(t *testing.T) {
+	srv, ts := newTestServer(t)
+	srv.publish(runner.NewLine(runner.StreamStdout, "hello"))
+	srv.publish(runner.NewLine(runner.StreamStderr, "oops"))
+
+	conn := dialWS(t, ts, "")
+	for _, want := range []string{"hello", "[ERR] oops"} {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+		if string(msg) != want {
+			t.Errorf("Expected %q, got %q", want, msg)
+		}
+	}
+}
+
+func TestWebSocketResumeFromSequence(t *testing.T) {
+	srv := New(ServerConfig{Runner: runner.New("true"), AuthKey: "secret", BufferSize: 3})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	for i := 0; i < 5; i++ {
+		srv.publish(runner.NewLine(runner.StreamStdout, "line"))
+	}
+
+	// Seq 3 is still buffered, so only 4 and 5 are replayed
+	conn := dialWS(t, ts, "&format=json&since=3")
+	for _, want := range []uint64{4, 5} {
+		msg := readMessage(t, conn, MessageStatus)
+		if msg.Type != MessageOutput || msg.Line.Seq != want {
+			t.Errorf("Expected seq %d, got %+v", want, msg)
+		}
+	}
+
+	// Seq 2 was evicted, the client is told about the gap first
+	conn = dialWS(t, ts, "&format=json&since=1")
+	msg := readMessage(t, conn, MessageStatus)
+	if msg.Type != MessageGap || msg.Gap.From != 2 || msg.Gap.To != 2 {
+		t.Errorf("Expected gap marker for seq 2, got %+v", msg)
+	}
+}
+
+func TestWebSocketTail(t *testing.T) {
+	srv, ts := newTestServer(t)
+	for i := 0; i < 5; i++ {
+		srv.publish(runner.NewLine(runner.StreamStdout, "line"))
+	}
+
+	conn := dialWS(t, ts, "&format=json&tail=2")
+	for _, want := range []uint64{4, 5} {
+		msg := readMessage(t, conn, MessageStatus)
+		if msg.Type != MessageOutput || msg.Line.Seq != want {
+			t.Errorf("Expected seq %d, got %+v", want, msg)
+		}
+	}
+}
+
+func TestPlayersTrackedFromOutput(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	srv.publish(runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:00:000 INFO] Player connected: Steve, xuid: 1"))
+	srv.publish(runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:01:000 INFO] Player connected: Alex, xuid: 2"))
+	srv.publish(runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:02:000 INFO] Player disconnected: Steve, xuid: 1"))
+	if players := srv.Players(); len(players) != 1 || players[0] != "Alex" {
+		t.Errorf("Expected only Alex online, got %v", players)
+	}
+
+	// A restart disconnects everyone
+	srv.Emit(events.Event{Type: events.ServerStarting})
+	if players := srv.Players(); len(players) != 0 {
+		t.Errorf("Expected nobody online after a restart, got %v", players)
+	}
+	if state := srv.Status().State; state != StateStarting {
+		t.Errorf("Expected state %q, got %q", StateStarting, state)
+	}
+}
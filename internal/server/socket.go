@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+)
+
+// DefaultSocketMode restricts the control socket to its owner and group
+const DefaultSocketMode os.FileMode = 0660
+
+type peerKey struct{}
+
+// StartSocket serves the same API as Start on a Unix domain socket. Anyone
+// able to connect is trusted as an admin, so access is controlled by the
+// socket's file permissions instead of the auth key.
+func (s *Server) StartSocket(path string, mode os.FileMode) error {
+	listener, err := listenSocket(path, mode)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	httpServer := &http.Server{
+		Handler: s.socketHandler(s.Handler()),
+		// Remember who is on the other end for the audit log
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, peerKey{}, peerName(c))
+		},
+	}
+
+	fmt.Printf("Control socket listening at %s\n", path)
+	return httpServer.Serve(listener)
+}
+
+// listenSocket creates the socket, replacing one left behind by a previous
+// run, and applies mode to it
+func listenSocket(path string, mode os.FileMode) (net.Listener, error) {
+	if mode == 0 {
+		mode = DefaultSocketMode
+	}
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("error creating control socket: %s exists and is not a socket", path)
+		}
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating control socket: %v", err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("error setting control socket permissions: %v", err)
+	}
+	return listener, nil
+}
+
+// socketHandler marks every request as coming from a trusted local admin
+func (s *Server) socketHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, _ := r.Context().Value(peerKey{}).(string)
+		r.RemoteAddr = peer
+		identity := Identity{Subject: peer, Name: peer, Role: RoleAdmin, Method: AuthMethodSocket}
+		next.ServeHTTP(w, withIdentity(r, identity))
+	})
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startSocket serves srv on a control socket in a temp directory
+func startSocket(t *testing.T, srv *Server, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "control.sock")
+	go srv.StartSocket(path, mode)
+
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Control socket %s was not created", path)
+	return ""
+}
+
+func socketClient(path string) *http.Client {
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestControlSocketTrustsLocalClients(t *testing.T) {
+	srv, _ := newTestServer(t)
+	path := startSocket(t, srv, 0600)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat socket: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected socket mode 0600, got %o", info.Mode().Perm())
+	}
+
+	// No auth key is needed over the socket
+	resp, err := socketClient(path).Get("http://localhost/auth/me")
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+
+	var identity Identity
+	if err := json.NewDecoder(resp.Body).Decode(&identity); err != nil {
+		t.Fatalf("Failed to decode identity: %v", err)
+	}
+	if identity.Method != AuthMethodSocket || identity.Role != RoleAdmin || !strings.HasPrefix(identity.Name, "unix") {
+		t.Errorf("Expected socket admin identity, got %+v", identity)
+	}
+}
+
+func TestControlSocketReplacesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "control.sock")
+	stale, err := listenSocket(path, 0)
+	if err != nil {
+		t.Fatalf("Failed to create socket: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := listenSocket(path, 0)
+	if err != nil {
+		t.Fatalf("Expected stale socket to be replaced: %v", err)
+	}
+	listener.Close()
+}
+
+func TestControlSocketRefusesRegularFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "control.sock")
+	os.WriteFile(path, []byte("data"), 0644)
+
+	if _, err := listenSocket(path, 0); err == nil {
+		t.Error("Expected error when the path is a regular file")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "data" {
+		t.Error("Regular file was overwritten")
+	}
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/broker"
+)
+
+// sseKeepAlive is how often an idle stream sends a comment so proxies don't
+// close it
+const sseKeepAlive = 15 * time.Second
+
+// handleStream serves output and events as Server-Sent Events. Each message
+// id is "<line seq>:<event seq>" so a reconnecting client's Last-Event-ID
+// resumes both streams where it left off.
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// EventSource sends the header on reconnect, the query parameter lets
+	// curl and first connections resume too
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventId")
+	}
+	lineSeq, eventSeq, resume := parseStreamID(lastID)
+
+	lines, lineBacklog, gap := s.broker.SubscribeSince(broker.DefaultQueueSize, lineSeq)
+	defer lines.Close()
+
+	// Fresh clients only get live events, like WebSocket clients
+	eventSub, eventBacklog, _ := s.events.SubscribeSince(broker.DefaultQueueSize, eventSeq)
+	defer eventSub.Close()
+	if !resume {
+		if len(eventBacklog) > 0 {
+			eventSeq = eventBacklog[len(eventBacklog)-1].Seq
+		}
+		eventBacklog = nil
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+
+	stream := &sseWriter{w: w, lineSeq: lineSeq, eventSeq: eventSeq}
+	status := s.Status()
+	stream.send(MessageStatus, status)
+	if gap != nil {
+		stream.send(MessageGap, gap)
+	}
+	for _, line := range lineBacklog {
+		stream.lineSeq = line.Seq
+		stream.send(MessageOutput, line)
+	}
+	for _, event := range eventBacklog {
+		stream.eventSeq = event.Seq
+		stream.send(MessageEvent, event)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAlive)
+	defer keepAlive.Stop()
+
+	for stream.err == nil {
+		select {
+		case <-r.Context().Done():
+			return
+		case line, ok := <-lines.C():
+			if !ok {
+				return
+			}
+			stream.lineSeq = line.Seq
+			stream.send(MessageOutput, line)
+		case event, ok := <-eventSub.C():
+			if !ok {
+				return
+			}
+			stream.eventSeq = event.Seq
+			stream.send(MessageEvent, event)
+			if isLifecycle(event.Type) {
+				stream.send(MessageStatus, s.Status())
+			}
+		case <-keepAlive.C:
+			_, stream.err = fmt.Fprint(w, ": keepalive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// sseWriter writes SSE messages, remembering the first error so the stream
+// loop can stop
+type sseWriter struct {
+	w        http.ResponseWriter
+	lineSeq  uint64
+	eventSeq uint64
+	err      error
+}
+
+func (sw *sseWriter) send(eventType string, v interface{}) {
+	if sw.err != nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		sw.err = err
+		return
+	}
+	_, sw.err = fmt.Fprintf(sw.w, "id: %d:%d\nevent: %s\ndata: %s\n\n", sw.lineSeq, sw.eventSeq, eventType, data)
+}
+
+// parseStreamID splits a "<line seq>:<event seq>" id, reporting whether the
+// client is resuming
+func parseStreamID(id string) (lineSeq, eventSeq uint64, ok bool) {
+	lineID, eventID, found := strings.Cut(id, ":")
+	if !found {
+		return 0, 0, false
+	}
+	lineSeq, err := strconv.ParseUint(lineID, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	eventSeq, err = strconv.ParseUint(eventID, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return lineSeq, eventSeq, true
+}
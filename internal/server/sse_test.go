@@ -0,0 +1,133 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/events"
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+type sseMessage struct {
+	ID    string
+	Event string
+	Data  string
+}
+
+// openStream connects to /api/stream and returns a function reading the
+// next message
+func openStream(t *testing.T, url, lastEventID string) func() sseMessage {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", url+"/api/stream", nil)
+	req.Header.Set("X-Auth-Key", "secret")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected text/event-stream, got %q", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	return func() sseMessage {
+		t.Helper()
+		var msg sseMessage
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				t.Fatalf("Failed to read stream: %v", err)
+			}
+			line = strings.TrimSuffix(line, "\n")
+			switch {
+			case line == "" && msg.Event != "":
+				return msg
+			case strings.HasPrefix(line, "id: "):
+				msg.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				msg.Event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				msg.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}
+}
+
+func TestStreamSendsOutputAndEvents(t *testing.T) {
+	srv, ts := newTestServer(t)
+	srv.publish(runner.NewLine(runner.StreamStdout, "hello"))
+
+	next := openStream(t, ts.URL, "")
+	if msg := next(); msg.Event != MessageStatus {
+		t.Fatalf("Expected status first, got %+v", msg)
+	}
+	if msg := next(); msg.Event != MessageOutput || msg.ID != "1:0" || !strings.Contains(msg.Data, `"text":"hello"`) {
+		t.Errorf("Expected buffered line, got %+v", msg)
+	}
+
+	srv.publish(runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:00:000 INFO] Player connected: Steve, xuid: 123"))
+	if msg := next(); msg.Event != MessageOutput || msg.ID != "2:0" {
+		t.Errorf("Expected live line, got %+v", msg)
+	}
+	msg := next()
+	var event events.Event
+	if err := json.Unmarshal([]byte(msg.Data), &event); err != nil {
+		t.Fatalf("Failed to decode event: %v", err)
+	}
+	if msg.Event != MessageEvent || msg.ID != "2:1" || event.Type != events.PlayerJoined || event.Player != "Steve" {
+		t.Errorf("Expected player joined event, got %+v", msg)
+	}
+}
+
+func TestStreamResumesFromLastEventID(t *testing.T) {
+	srv, ts := newTestServer(t)
+	srv.publish(runner.NewLine(runner.StreamStdout, "one"))
+	srv.publish(runner.NewLine(runner.StreamStdout, "[2024-01-01 12:00:00:000 INFO] Player connected: Steve, xuid: 123"))
+	srv.publish(runner.NewLine(runner.StreamStdout, "three"))
+
+	// The client saw line 1 and no events
+	next := openStream(t, ts.URL, "1:0")
+	want := []struct{ event, id string }{
+		{MessageStatus, "1:0"},
+		{MessageOutput, "2:0"},
+		{MessageOutput, "3:0"},
+		{MessageEvent, "3:1"},
+	}
+	for _, w := range want {
+		if msg := next(); msg.Event != w.event || msg.ID != w.id {
+			t.Errorf("Expected %s with id %s, got %+v", w.event, w.id, msg)
+		}
+	}
+}
+
+func TestParseStreamID(t *testing.T) {
+	tests := []struct {
+		id        string
+		lineSeq   uint64
+		eventSeq  uint64
+		wantValid bool
+	}{
+		{"12:3", 12, 3, true},
+		{"0:0", 0, 0, true},
+		{"", 0, 0, false},
+		{"12", 0, 0, false},
+		{"a:1", 0, 0, false},
+	}
+	for _, tt := range tests {
+		lineSeq, eventSeq, ok := parseStreamID(tt.id)
+		if lineSeq != tt.lineSeq || eventSeq != tt.eventSeq || ok != tt.wantValid {
+			t.Errorf("parseStreamID(%q) = %d, %d, %v", tt.id, lineSeq, eventSeq, ok)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/events"
+)
+
+// Server process states
+const (
+	StateStarting = "starting"
+	StateRunning  = "running"
+	StateStopping = "stopping"
+	StateStopped  = "stopped"
+	StateCrashed  = "crashed"
+)
+
+// Status describes the state of the Bedrock server process
+type Status struct {
+	State   string    `json:"state"`
+	Since   time.Time `json:"since"`             // When the server entered this state
+	Channel string    `json:"channel,omitempty"` // Release channel, e.g. preview
+}
+
+// Status returns the current server status
+func (s *Server) Status() Status {
+	s.statusLock.RLock()
+	defer s.statusLock.RUnlock()
+	return s.status
+}
+
+// setState records a state change, reporting whether the state changed
+func (s *Server) setState(state string) bool {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	if s.status.State == state {
+		return false
+	}
+	s.status = Status{State: state, Since: time.Now(), Channel: s.status.Channel}
+	return true
+}
+
+// Players returns the names of the players online, sorted
+func (s *Server) Players() []string {
+	s.statusLock.RLock()
+	defer s.statusLock.RUnlock()
+
+	players := make([]string, 0, len(s.players))
+	for name := range s.players {
+		players = append(players, name)
+	}
+	sort.Strings(players)
+	return players
+}
+
+// trackPlayers updates the players online from an event
+func (s *Server) trackPlayers(event events.Event) {
+	s.statusLock.Lock()
+	defer s.statusLock.Unlock()
+
+	switch event.Type {
+	case events.PlayerJoined:
+		s.players[event.Player] = true
+	case events.PlayerLeft:
+		delete(s.players, event.Player)
+	case events.ServerStarting, events.ServerStopped, events.ServerCrashed:
+		// Nobody is connected to a server that isn't running
+		s.players = make(map[string]bool)
+	}
+}
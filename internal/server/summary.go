@@ -0,0 +1,137 @@
+package server
+
+import (
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/config"
+	"github.com/jsandas/bedrock-server/internal/downloader"
+	"github.com/jsandas/bedrock-server/internal/events"
+)
+
+// StateRestarting is reported by the status API while the server restarts
+const StateRestarting = "restarting"
+
+// ProcessInfo is implemented by runners that report on the server process,
+// e.g. runner.Supervisor
+type ProcessInfo interface {
+	Pid() int
+	StartedAt() time.Time
+	Restarts() int
+	Restarting() bool
+}
+
+// Summary is the state of the whole server returned by GET /api/status
+type Summary struct {
+	WrapperVersion string `json:"wrapper_version"`
+	BedrockVersion string `json:"bedrock_version"`
+	Channel        string `json:"channel"`
+
+	State         string     `json:"state"`
+	Since         time.Time  `json:"since"`
+	PID           int        `json:"pid"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	UptimeSeconds int64      `json:"uptime_seconds"`
+	Restarts      int        `json:"restarts"`
+
+	PlayersOnline int      `json:"players_online"`
+	MaxPlayers    int      `json:"max_players"`
+	Players       []string `json:"players"`
+
+	LevelName  string `json:"level_name"`
+	Gamemode   string `json:"gamemode"`
+	Difficulty string `json:"difficulty"`
+
+	LastBackup      *time.Time           `json:"last_backup,omitempty"`
+	WorldsDiskBytes int64                `json:"worlds_disk_bytes"`
+	Download        *downloader.Progress `json:"download,omitempty"` // While the server is downloaded
+}
+
+// Summary collects the state of the wrapper, process, players and world
+func (s *Server) Summary() Summary {
+	status := s.Status()
+	players := s.Players()
+	summary := Summary{
+		WrapperVersion: s.wrapperVersion,
+		Channel:        status.Channel,
+		State:          status.State,
+		Since:          status.Since,
+		PlayersOnline:  len(players),
+		Players:        players,
+	}
+
+	if info, ok := s.runner.(ProcessInfo); ok {
+		summary.PID = info.Pid()
+		summary.Restarts = info.Restarts()
+		if info.Restarting() {
+			summary.State = StateRestarting
+		}
+		if started := info.StartedAt(); summary.PID != 0 && !started.IsZero() {
+			summary.StartedAt = &started
+			summary.UptimeSeconds = int64(time.Since(started).Seconds())
+		}
+	}
+
+	s.statusLock.RLock()
+	if !s.lastBackup.IsZero() {
+		lastBackup := s.lastBackup
+		summary.LastBackup = &lastBackup
+	}
+	if s.download != nil && s.download.State != downloader.StateDone {
+		download := *s.download
+		summary.Download = &download
+	}
+	s.statusLock.RUnlock()
+
+	if s.appDir == "" {
+		return summary
+	}
+	summary.BedrockVersion = downloader.InstalledVersion(s.appDir)
+	if props, err := config.ReadServerProperties(s.appDir); err == nil {
+		summary.MaxPlayers, _ = strconv.Atoi(props["max-players"])
+		summary.LevelName = props["level-name"]
+		summary.Gamemode = props["gamemode"]
+		summary.Difficulty = props["difficulty"]
+	}
+	summary.WorldsDiskBytes = diskUsage(filepath.Join(s.appDir, "worlds"))
+	return summary
+}
+
+// trackBackups records when the last backup finished
+func (s *Server) trackBackups(event events.Event) {
+	if event.Type != events.BackupFinished {
+		return
+	}
+	s.statusLock.Lock()
+	s.lastBackup = event.Time
+	s.statusLock.Unlock()
+}
+
+// diskUsage returns the size of the files under dir
+func diskUsage(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip what can't be read
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// handleStatus summarises the state of the server
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.Summary())
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/downloader"
+	"github.com/jsandas/bedrock-server/internal/events"
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+// fakeProcess is a running server process that reports on itself
+type fakeProcess struct {
+	out        chan runner.Line
+	started    time.Time
+	restarting bool
+
+	mu    sync.Mutex
+	input []string
+}
+
+func (p *fakeProcess) WriteInput(input string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.input = append(p.input, input)
+}
+
+func (p *fakeProcess) inputs() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.input...)
+}
+
+func (p *fakeProcess) GetOutputChan() <-chan runner.Line { return p.out }
+func (p *fakeProcess) Pid() int                          { return 4242 }
+func (p *fakeProcess) StartedAt() time.Time              { return p.started }
+func (p *fakeProcess) Restarts() int                     { return 2 }
+func (p *fakeProcess) Restarting() bool                  { return p.restarting }
+
+func TestStatusAPI(t *testing.T) {
+	appDir := t.TempDir()
+	files := map[string]string{
+		downloader.VersionFile:   "1.21.50.07\n",
+		"server.properties":      "level-name=Bedrock level\ngamemode=creative\ndifficulty=hard\nmax-players=10\n",
+		"worlds/world/level.dat": "12345",
+		"worlds/world/db/000001": "1234567890",
+	}
+	for name, content := range files {
+		path := filepath.Join(appDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	process := &fakeProcess{out: make(chan runner.Line), started: time.Now().Add(-time.Minute)}
+	defer close(process.out)
+	srv := New(ServerConfig{Runner: process, AuthKey: "secret", AppDir: appDir, WrapperVersion: "1.2.3", Channel: "release"})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	backup := time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC)
+	srv.Emit(events.Event{Type: events.ServerStarted})
+	srv.Emit(events.Event{Type: events.PlayerJoined, Player: "Steve"})
+	srv.Emit(events.Event{Type: events.BackupFinished, Time: backup})
+
+	var got Summary
+	json.NewDecoder(apiRequest(t, "GET", ts.URL+"/api/status", "").Body).Decode(&got)
+	if got.WrapperVersion != "1.2.3" || got.BedrockVersion != "1.21.50.07" || got.Channel != "release" {
+		t.Errorf("Unexpected versions %+v", got)
+	}
+	if got.State != StateRunning || got.PID != 4242 || got.Restarts != 2 || got.UptimeSeconds < 60 {
+		t.Errorf("Unexpected process status %+v", got)
+	}
+	if got.PlayersOnline != 1 || got.MaxPlayers != 10 || len(got.Players) != 1 || got.Players[0] != "Steve" {
+		t.Errorf("Unexpected players %+v", got)
+	}
+	if got.LevelName != "Bedrock level" || got.Gamemode != "creative" || got.Difficulty != "hard" {
+		t.Errorf("Unexpected world settings %+v", got)
+	}
+	if got.LastBackup == nil || !got.LastBackup.Equal(backup) {
+		t.Errorf("Expected the last backup at %v, got %v", backup, got.LastBackup)
+	}
+	if got.WorldsDiskBytes != 15 {
+		t.Errorf("Expected 15 bytes of worlds, got %d", got.WorldsDiskBytes)
+	}
+
+	process.restarting = true
+	if state := srv.Summary().State; state != StateRestarting {
+		t.Errorf("Expected %s while restarting, got %s", StateRestarting, state)
+	}
+}
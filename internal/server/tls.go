@@ -0,0 +1,264 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCertReloadInterval = 30 * time.Second
+	selfSignedValidity        = 7 * 24 * time.Hour // Generated certificates are never reused across restarts
+	selfSignedRenewBefore     = 24 * time.Hour     // Replaced this long before they expire
+)
+
+// TLSConfig holds the settings for serving the web console over HTTPS
+type TLSConfig struct {
+	CertFile       string
+	KeyFile        string
+	SelfSigned     bool          // Generate an in-memory certificate when no files are given
+	ClientCAFile   string        // Optional CA bundle enabling mTLS client authentication
+	ReloadInterval time.Duration // How often to check the cert files for changes
+}
+
+// Enabled reports whether the web console should be served over TLS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.SelfSigned
+}
+
+// buildTLSConfig creates the server TLS configuration, starting a certificate
+// reloader when the certificate comes from files
+func buildTLSConfig(config TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	switch {
+	case config.CertFile != "" && config.KeyFile != "":
+		reloader, err := newCertReloader(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		interval := config.ReloadInterval
+		if interval <= 0 {
+			interval = defaultCertReloadInterval
+		}
+		go reloader.watch(interval)
+		tlsConfig.GetCertificate = reloader.GetCertificate
+	case config.CertFile != "" || config.KeyFile != "":
+		return nil, errors.New("both a TLS certificate and key file are required")
+	case config.SelfSigned:
+		selfSigned := &selfSignedCert{now: time.Now}
+		if _, err := selfSigned.GetCertificate(nil); err != nil {
+			return nil, err
+		}
+		fmt.Println("Using a generated self-signed certificate for the web server")
+		tlsConfig.GetCertificate = selfSigned.GetCertificate
+	}
+
+	if config.ClientCAFile != "" {
+		pem, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		// Browsers without a client certificate still use the key or SSO
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig, nil
+}
+
+// certReloader serves a key pair from disk and reloads it when the files change
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// reload loads the key pair if either file changed since the last load
+func (r *certReloader) reload() error {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error checking certificate files: %v", err)
+	}
+
+	r.mu.RLock()
+	unchanged := r.cert != nil && modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("error loading certificate: %v", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+// watch polls the certificate files, since secrets mounted by cert-manager are
+// replaced through symlink swaps that file notifications don't handle well
+func (r *certReloader) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.mu.RLock()
+		previous := r.modTime
+		r.mu.RUnlock()
+
+		if err := r.reload(); err != nil {
+			// Keep serving the old certificate, a half-written secret will settle
+			fmt.Fprintf(os.Stderr, "Error reloading TLS certificate: %v\n", err)
+			continue
+		}
+
+		r.mu.RLock()
+		changed := !r.modTime.Equal(previous)
+		r.mu.RUnlock()
+		if changed {
+			fmt.Println("Reloaded TLS certificate")
+		}
+	}
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		// Stat follows symlinks, so a swapped secret directory is noticed
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// selfSignedCert serves a generated certificate, replacing it before it expires
+type selfSignedCert struct {
+	now func() time.Time
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (c *selfSignedCert) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if c.cert != nil && now.Before(c.cert.Leaf.NotAfter.Add(-selfSignedRenewBefore)) {
+		return c.cert, nil
+	}
+	cert, err := generateSelfSigned(now)
+	if err != nil {
+		if c.cert != nil && now.Before(c.cert.Leaf.NotAfter) {
+			fmt.Fprintf(os.Stderr, "Error renewing self-signed certificate: %v\n", err)
+			return c.cert, nil
+		}
+		return nil, fmt.Errorf("error generating self-signed certificate: %v", err)
+	}
+	c.cert = &cert
+	return c.cert, nil
+}
+
+// generateSelfSigned creates a short-lived certificate for quick starts
+func generateSelfSigned(now time.Time) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "minecraft-bedrock-wrapper"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// certIdentity maps a verified client certificate to an identity. Without
+// admin or viewer lists every certificate signed by the client CA is an
+// admin. Otherwise its common name, email and DNS names are matched against
+// the admin and viewer emails, and its organizational units against the
+// groups, the same lists used for single sign-on.
+func (s *Server) certIdentity(cert *x509.Certificate) (Identity, error) {
+	name := cert.Subject.CommonName
+	identity := Identity{Subject: name, Name: name, Role: RoleAdmin, Method: AuthMethodMTLS}
+	if !s.roles.mapsRoles() {
+		return identity, nil
+	}
+
+	names := append([]string{name}, cert.EmailAddresses...)
+	names = append(names, cert.DNSNames...)
+	role, ok := s.roles.role(cert.Subject.OrganizationalUnit, names...)
+	if !ok {
+		return Identity{}, ErrNoRoleMapped
+	}
+	identity.Role = role
+	return identity, nil
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+// issueCert creates a certificate signed by parent (self-signed when nil)
+func issueCert(t *testing.T, cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+		DNSNames:              []string{"localhost"},
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func writeKeyPair(t *testing.T, dir string, cert *x509.Certificate, key *ecdsa.PrivateKey) (string, string) {
+	t.Helper()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644); err != nil {
+		t.Fatalf("Failed to write cert: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestCertReloaderPicksUpNewCertificate(t *testing.T) {
+	dir := t.TempDir()
+	first, firstKey := issueCert(t, "first", false, nil, nil)
+	certFile, keyFile := writeKeyPair(t, dir, first, firstKey)
+
+	reloader, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("Failed to create reloader: %v", err)
+	}
+
+	second, secondKey := issueCert(t, "second", false, nil, nil)
+	writeKeyPair(t, dir, second, secondKey)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	if err := reloader.reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	cert, _ := reloader.GetCertificate(nil)
+	leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+	if leaf.Subject.CommonName != "second" {
+		t.Errorf("Expected reloaded certificate, got %s", leaf.Subject.CommonName)
+	}
+}
+
+func TestBuildTLSConfigRequiresKeyPair(t *testing.T) {
+	if _, err := buildTLSConfig(TLSConfig{CertFile: "tls.crt"}); err == nil {
+		t.Error("Expected an error when the key file is missing")
+	}
+}
+
+func TestMutualTLSAuthentication(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := issueCert(t, "automation-ca", true, nil, nil)
+	caFile := filepath.Join(dir, "ca.crt")
+	os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}), 0644)
+
+	tlsConfig, err := buildTLSConfig(TLSConfig{SelfSigned: true, ClientCAFile: caFile})
+	if err != nil {
+		t.Fatalf("Failed to build TLS config: %v", err)
+	}
+
+	srv := New(ServerConfig{Runner: runner.New("true"), AuthKey: "secret"})
+	ts := httptest.NewUnstartedServer(srv.Handler())
+	ts.TLS = tlsConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	client, clientKey := issueCert(t, "backup-job", false, ca, caKey)
+	withCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		Certificates:       []tls.Certificate{{Certificate: [][]byte{client.Raw}, PrivateKey: clientKey}},
+	}}}
+	withoutCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+
+	resp, err := withCert.Get(ts.URL + "/auth/me")
+	if err != nil {
+		t.Fatalf("Request with client certificate failed: %v", err)
+	}
+	var identity Identity
+	json.NewDecoder(resp.Body).Decode(&identity)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || identity.Method != AuthMethodMTLS || identity.Name != "backup-job" {
+		t.Errorf("Expected mTLS identity, got %d %+v", resp.StatusCode, identity)
+	}
+
+	resp, err = withoutCert.Get(ts.URL + "/auth/me")
+	if err != nil {
+		t.Fatalf("Request without client certificate failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without certificate or key, got %d", resp.StatusCode)
+	}
+}
+
+func TestSelfSignedCertIsShortLivedAndRenewed(t *testing.T) {
+	now := time.Now()
+	c := &selfSignedCert{now: func() time.Time { return now }}
+
+	first, err := c.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("Failed to generate certificate: %v", err)
+	}
+	if lifetime := first.Leaf.NotAfter.Sub(now); lifetime > selfSignedValidity {
+		t.Errorf("Expected a certificate valid for at most %v, got %v", selfSignedValidity, lifetime)
+	}
+
+	now = now.Add(time.Hour)
+	if same, _ := c.GetCertificate(nil); same != first {
+		t.Error("Expected the certificate reused while it is fresh")
+	}
+
+	now = now.Add(selfSignedValidity - selfSignedRenewBefore)
+	renewed, err := c.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("Failed to renew certificate: %v", err)
+	}
+	if renewed == first || !renewed.Leaf.NotAfter.After(first.Leaf.NotAfter) {
+		t.Error("Expected the certificate replaced before it expires")
+	}
+}
+
+func TestCertIdentityRoles(t *testing.T) {
+	cert := func(cn string, ou ...string) *x509.Certificate {
+		return &x509.Certificate{
+			Subject:        pkix.Name{CommonName: cn, OrganizationalUnit: ou},
+			EmailAddresses: []string{cn + "@example.com"},
+		}
+	}
+
+	// Without role lists every trusted certificate is an admin
+	srv := New(ServerConfig{Runner: runner.New("true")})
+	if identity, err := srv.certIdentity(cert("backup-job")); err != nil || identity.Role != RoleAdmin {
+		t.Errorf("Expected admin without role lists, got %+v %v", identity, err)
+	}
+
+	srv = New(ServerConfig{Runner: runner.New("true"), OIDC: OIDCConfig{
+		AdminEmails:  []string{"deploy@example.com"},
+		ViewerGroups: []string{"monitoring"},
+		ViewerEmails: []string{"dashboard"},
+	}})
+	tests := []struct {
+		cert    *x509.Certificate
+		want    Role
+		wantErr bool
+	}{
+		{cert("deploy"), RoleAdmin, false},                    // Email SAN in the admin emails
+		{cert("dashboard"), RoleViewer, false},                // Common name in the viewer emails
+		{cert("prometheus", "monitoring"), RoleViewer, false}, // Organizational unit in the viewer groups
+		{cert("backup-job"), "", true},                        // Not in any list
+	}
+	for _, tt := range tests {
+		identity, err := srv.certIdentity(tt.cert)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected no role, got %+v", tt.cert.Subject.CommonName, identity)
+			}
+			continue
+		}
+		if err != nil || identity.Role != tt.want || identity.Method != AuthMethodMTLS {
+			t.Errorf("%s: expected %s, got %+v %v", tt.cert.Subject.CommonName, tt.want, identity, err)
+		}
+	}
+}
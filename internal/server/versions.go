@@ -0,0 +1,102 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/jsandas/bedrock-server/internal/downloader"
+)
+
+// VersionManager installs cached server versions
+type VersionManager interface {
+	Versions() (downloader.Versions, error)
+	Switch(version string) error
+	Rollback() error
+	Unpin() error
+}
+
+// handleVersions lists the installed and cached server versions
+func (s *Server) handleVersions(w http.ResponseWriter, r *http.Request) {
+	if s.versions == nil {
+		http.Error(w, "version management is not enabled", http.StatusNotFound)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	versions, err := s.versions.Versions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// handleVersionSwitch installs the version in the body, e.g. {"version":
+// "1.21.50.07"}, restarting the server. It returns once the new version
+// started or was rolled back.
+func (s *Server) handleVersionSwitch(w http.ResponseWriter, r *http.Request) {
+	if !s.versionAction(w, r) {
+		return
+	}
+	var body struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Version == "" {
+		http.Error(w, "expected {\"version\": \"...\"}", http.StatusBadRequest)
+		return
+	}
+
+	identity, _ := IdentityFromContext(r.Context())
+	s.Log("Switch to version %s requested by %s", body.Version, identity.Name)
+	s.finishVersionAction(w, s.versions.Switch(body.Version))
+}
+
+// handleVersionRollback installs the previously installed version
+func (s *Server) handleVersionRollback(w http.ResponseWriter, r *http.Request) {
+	if !s.versionAction(w, r) {
+		return
+	}
+	identity, _ := IdentityFromContext(r.Context())
+	s.Log("Rollback to the previous version requested by %s", identity.Name)
+	s.finishVersionAction(w, s.versions.Rollback())
+}
+
+// handleVersionUnpin lets the pinned version be replaced by MINECRAFT_VER
+// and automatic updates again
+func (s *Server) handleVersionUnpin(w http.ResponseWriter, r *http.Request) {
+	if !s.versionAction(w, r) {
+		return
+	}
+	identity, _ := IdentityFromContext(r.Context())
+	s.Log("Version unpinned by %s", identity.Name)
+	s.finishVersionAction(w, s.versions.Unpin())
+}
+
+// versionAction checks a version change can be requested
+func (s *Server) versionAction(w http.ResponseWriter, r *http.Request) bool {
+	if s.versions == nil {
+		http.Error(w, "version management is not enabled", http.StatusNotFound)
+		return false
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+	return requireAdmin(w, r)
+}
+
+func (s *Server) finishVersionAction(w http.ResponseWriter, err error) {
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	versions, err := s.versions.Versions()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
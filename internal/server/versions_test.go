@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jsandas/bedrock-server/internal/downloader"
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+// fakeVersions switches between versions without installing anything
+type fakeVersions struct {
+	versions downloader.Versions
+}
+
+func (f *fakeVersions) Versions() (downloader.Versions, error) { return f.versions, nil }
+
+func (f *fakeVersions) Switch(version string) error {
+	if version == f.versions.Installed {
+		return fmt.Errorf("version %s is already installed", version)
+	}
+	f.versions.Previous, f.versions.Installed = f.versions.Installed, version
+	f.versions.Pinned = version
+	return nil
+}
+
+func (f *fakeVersions) Rollback() error { return f.Switch(f.versions.Previous) }
+
+func (f *fakeVersions) Unpin() error {
+	f.versions.Pinned = ""
+	return nil
+}
+
+func TestVersionsAPI(t *testing.T) {
+	versions := &fakeVersions{versions: downloader.Versions{Installed: "1.21.0.1"}}
+	srv := New(ServerConfig{Runner: runner.New("true"), AuthKey: "secret", Versions: versions})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp := apiRequest(t, "POST", ts.URL+"/api/versions/switch", `{"version":"1.21.1.1"}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	var got downloader.Versions
+	json.NewDecoder(resp.Body).Decode(&got)
+	if got.Installed != "1.21.1.1" || got.Previous != "1.21.0.1" {
+		t.Errorf("Expected 1.21.1.1 installed, got %+v", got)
+	}
+
+	if resp := apiRequest(t, "POST", ts.URL+"/api/versions/switch", `{"version":"1.21.1.1"}`); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409 switching to the installed version, got %d", resp.StatusCode)
+	}
+	if resp := apiRequest(t, "POST", ts.URL+"/api/versions/switch", `{}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a version, got %d", resp.StatusCode)
+	}
+	if resp := apiRequest(t, "GET", ts.URL+"/api/versions/rollback", ""); resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", resp.StatusCode)
+	}
+
+	if resp := apiRequest(t, "POST", ts.URL+"/api/versions/rollback", ""); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	resp = apiRequest(t, "GET", ts.URL+"/api/versions", "")
+	json.NewDecoder(resp.Body).Decode(&got)
+	if got.Installed != "1.21.0.1" || got.Pinned != "1.21.0.1" {
+		t.Errorf("Expected 1.21.0.1 installed and pinned after rollback, got %+v", got)
+	}
+
+	resp = apiRequest(t, "POST", ts.URL+"/api/versions/unpin", "")
+	got = downloader.Versions{}
+	json.NewDecoder(resp.Body).Decode(&got)
+	if resp.StatusCode != http.StatusOK || got.Pinned != "" {
+		t.Errorf("Expected the version unpinned, got %d %+v", resp.StatusCode, got)
+	}
+}
+
+func TestVersionsDisabled(t *testing.T) {
+	_, ts := newTestServer(t)
+	if resp := apiRequest(t, "GET", ts.URL+"/api/versions", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 without version management, got %d", resp.StatusCode)
+	}
+}
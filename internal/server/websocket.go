@@ -0,0 +1,301 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/jsandas/bedrock-server/internal/broker"
+	"github.com/jsandas/bedrock-server/internal/events"
+	"github.com/jsandas/bedrock-server/internal/runner"
+)
+
+// ProtocolVersion is the version of the JSON WebSocket protocol
+const ProtocolVersion = 1
+
+// Message types of the JSON WebSocket protocol
+const (
+	MessageCommand = "command" // Client to server: run a console command
+	MessageAck     = "ack"     // Server to client: command accepted and sent to the server
+	MessageError   = "error"   // Server to client: command rejected or malformed message
+	MessageOutput  = "output"  // Server to client: a line of console output
+	MessageGap     = "gap"     // Server to client: resumed output is missing lines
+	MessageEvent   = "event"   // Server to client: a parsed server or player event
+	MessageStatus  = "status"  // Server to client: the server status, sent on connect and on change
+)
+
+// Message is the envelope of every frame in the JSON WebSocket protocol
+type Message struct {
+	V       int           `json:"v"`
+	Type    string        `json:"type"`
+	ID      string        `json:"id,omitempty"` // Client chosen id echoed in the ack or error
+	Command string        `json:"command,omitempty"`
+	Line    *runner.Line  `json:"line,omitempty"`
+	Gap     *broker.Gap   `json:"gap,omitempty"`
+	Event   *events.Event `json:"event,omitempty"`
+	Status  *Status       `json:"status,omitempty"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// handleWebSocket serves the console over a WebSocket. By default clients get
+// the plain-text protocol: bare output lines out and raw commands in. Clients
+// connecting with format=json speak the JSON protocol described by Message.
+func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	identity, _ := IdentityFromContext(r.Context())
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		fmt.Printf("Error upgrading to WebSocket: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	// Reconnecting clients pass the last sequence number they saw and only
+	// get what they missed. Subscribing before replaying ensures no line
+	// falls between the backlog and live output.
+	since, _ := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	lines, backlog, gap := s.broker.SubscribeSince(broker.DefaultQueueSize, since)
+	defer lines.Close()
+
+	// Clients that only care about recent or new output limit the replay
+	if tail, err := strconv.Atoi(r.URL.Query().Get("tail")); err == nil && tail >= 0 && tail < len(backlog) {
+		backlog = backlog[len(backlog)-tail:]
+		gap = nil
+	}
+
+	client := &wsClient{
+		server:   s,
+		conn:     conn,
+		request:  r,
+		identity: identity,
+		replies:  make(chan Message, 16),
+		done:     make(chan struct{}),
+	}
+
+	if r.URL.Query().Get("format") != "json" {
+		go client.writeText(lines, backlog, gap)
+		client.readText()
+		return
+	}
+
+	// Events are delivered live only, they can be rebuilt from the output
+	eventSub, _ := s.events.Subscribe(broker.DefaultQueueSize)
+	defer eventSub.Close()
+
+	go client.writeJSON(lines, eventSub, backlog, gap)
+	client.readJSON()
+}
+
+// wsClient is a single WebSocket connection. Only the writer goroutine
+// writes to conn, gorilla connections don't support concurrent writers.
+type wsClient struct {
+	server   *Server
+	conn     *websocket.Conn
+	request  *http.Request
+	identity Identity
+	replies  chan Message  // Acks and errors queued by the reader for the writer
+	done     chan struct{} // Closed when the JSON writer exits
+}
+
+func (c *wsClient) write(v interface{}) error {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if text, ok := v.(string); ok {
+		return c.conn.WriteMessage(websocket.TextMessage, []byte(text))
+	}
+	return c.conn.WriteJSON(v)
+}
+
+// readJSON handles protocol messages from the client until it disconnects
+func (c *wsClient) readJSON() {
+	defer close(c.replies)
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var reply Message
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			reply = Message{V: ProtocolVersion, Type: MessageError, Error: "malformed message: " + err.Error()}
+		} else if msg.V != 0 && msg.V != ProtocolVersion {
+			reply = Message{V: ProtocolVersion, Type: MessageError, ID: msg.ID, Error: fmt.Sprintf("unsupported protocol version %d", msg.V)}
+		} else if msg.Type == MessageCommand {
+			reply = c.runCommand(msg)
+		} else {
+			reply = Message{V: ProtocolVersion, Type: MessageError, ID: msg.ID, Error: fmt.Sprintf("unknown message type %q", msg.Type)}
+		}
+
+		if !c.reply(reply) {
+			return
+		}
+	}
+}
+
+// reply queues a message for the writer, returning false once the writer
+// has exited so the reader doesn't block on a full queue
+func (c *wsClient) reply(msg Message) bool {
+	select {
+	case c.replies <- msg:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// runCommand forwards a command to the server and returns the ack or error
+func (c *wsClient) runCommand(msg Message) Message {
+	reply := Message{V: ProtocolVersion, ID: msg.ID}
+	command := strings.TrimSpace(msg.Command)
+
+	switch {
+	case command == "":
+		reply.Type, reply.Error = MessageError, "empty command"
+	case strings.ContainsAny(command, "\r\n"):
+		reply.Type, reply.Error = MessageError, "command must be a single line"
+	case !c.identity.CanCommand():
+		c.server.recordCommand(c.request, c.identity, command, true)
+		reply.Type, reply.Error = MessageError, "read-only access"
+	default:
+		c.server.recordCommand(c.request, c.identity, command, false)
+		c.server.runner.WriteInput(command)
+		reply.Type = MessageAck
+	}
+	return reply
+}
+
+// writeJSON sends the status, gap marker and backlog, then live output,
+// events and replies until the connection or a subscription ends
+func (c *wsClient) writeJSON(lines *broker.Subscription[runner.Line], eventSub *broker.Subscription[events.Event], backlog []runner.Line, gap *broker.Gap) {
+	defer close(c.done)
+	defer c.conn.Close()
+
+	status := c.server.Status()
+	if err := c.write(Message{V: ProtocolVersion, Type: MessageStatus, Status: &status}); err != nil {
+		return
+	}
+	if gap != nil {
+		if err := c.write(Message{V: ProtocolVersion, Type: MessageGap, Gap: gap}); err != nil {
+			return
+		}
+	}
+	for i := range backlog {
+		if err := c.write(Message{V: ProtocolVersion, Type: MessageOutput, Line: &backlog[i]}); err != nil {
+			return
+		}
+	}
+
+	for {
+		var msg Message
+		select {
+		case line, ok := <-lines.C():
+			if !ok {
+				c.closeSlow(lines.Slow())
+				return
+			}
+			msg = Message{V: ProtocolVersion, Type: MessageOutput, Line: &line}
+		case event, ok := <-eventSub.C():
+			if !ok {
+				c.closeSlow(eventSub.Slow())
+				return
+			}
+			if err := c.write(Message{V: ProtocolVersion, Type: MessageEvent, Event: &event}); err != nil {
+				return
+			}
+			if !isLifecycle(event.Type) {
+				continue
+			}
+			status := c.server.Status()
+			msg = Message{V: ProtocolVersion, Type: MessageStatus, Status: &status}
+		case reply, ok := <-c.replies:
+			if !ok {
+				return // Reader finished, the client went away
+			}
+			msg = reply
+		}
+
+		if err := c.write(msg); err != nil {
+			return
+		}
+	}
+}
+
+// readText forwards raw messages from a plain-text client to the server
+func (c *wsClient) readText() {
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		// Older clients sent a JSON auth message that is already handled by the middleware
+		if len(message) > 0 && message[0] == '{' {
+			continue
+		}
+
+		reply := c.runCommand(Message{Command: string(message)})
+		if reply.Type == MessageError {
+			fmt.Printf("Ignoring command from %s: %s\n", c.identity.Name, reply.Error)
+		}
+	}
+}
+
+// writeText sends the gap marker, backlog and live output as bare text
+func (c *wsClient) writeText(lines *broker.Subscription[runner.Line], backlog []runner.Line, gap *broker.Gap) {
+	defer c.conn.Close()
+
+	if gap != nil {
+		if err := c.write(gapText(gap)); err != nil {
+			return
+		}
+	}
+	for _, line := range backlog {
+		if err := c.write(legacyText(line)); err != nil {
+			return
+		}
+	}
+	for line := range lines.C() {
+		if err := c.write(legacyText(line)); err != nil {
+			return
+		}
+	}
+	c.closeSlow(lines.Slow())
+}
+
+// closeSlow tells a client that fell behind why it is being disconnected
+func (c *wsClient) closeSlow(slow bool) {
+	if !slow {
+		return
+	}
+	fmt.Printf("Disconnecting slow WebSocket client %s\n", c.conn.RemoteAddr())
+	msg := websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client too slow")
+	c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+}
+
+func isLifecycle(t events.Type) bool {
+	switch t {
+	case events.ServerStarting, events.ServerStarted, events.ServerStopping, events.ServerStopped, events.ServerCrashed:
+		return true
+	}
+	return false
+}
+
+func gapText(gap *broker.Gap) string {
+	if gap.Reset {
+		return "--- server output restarted ---"
+	}
+	return fmt.Sprintf("--- %d lines missed ---", gap.To-gap.From+1)
+}
+
+// legacyText renders a line the way plain-text clients expect it
+func legacyText(line runner.Line) string {
+	if line.Stream == runner.StreamStderr {
+		return "[ERR] " + line.Text
+	}
+	return line.Text
+}
@@ -0,0 +1,143 @@
+package updater
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// worldsDir holds the worlds, backed up since a new version may convert them
+const worldsDir = "worlds"
+
+// addedFile lists files the upgrade added, removed again on restore
+const addedFile = "added.txt"
+
+// backup is a copy of everything an upgrade changes
+type backup struct {
+	dir   string
+	added []string // Files that didn't exist before the upgrade
+}
+
+// createBackup copies the files an upgrade overwrites and the worlds from
+// appDir into dir
+func createBackup(appDir, dir string, files []string) (*backup, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating backup directory: %v", err)
+	}
+
+	b := &backup{dir: dir}
+	for _, name := range files {
+		src := filepath.Join(appDir, name)
+		if _, err := os.Stat(src); os.IsNotExist(err) {
+			b.added = append(b.added, name)
+			continue
+		}
+		if err := copyFile(src, filepath.Join(dir, "files", name)); err != nil {
+			return nil, fmt.Errorf("error backing up %s: %v", name, err)
+		}
+	}
+	if err := copyDir(filepath.Join(appDir, worldsDir), filepath.Join(dir, worldsDir)); err != nil {
+		return nil, fmt.Errorf("error backing up worlds: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, addedFile), []byte(strings.Join(b.added, "\n")), 0644); err != nil {
+		return nil, fmt.Errorf("error writing backup: %v", err)
+	}
+	return b, nil
+}
+
+// restore puts the backed up files and worlds back in appDir
+func (b *backup) restore(appDir string) error {
+	for _, name := range b.added {
+		os.Remove(filepath.Join(appDir, name))
+	}
+
+	files := filepath.Join(b.dir, "files")
+	err := filepath.Walk(files, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(files, path)
+		return copyFile(path, filepath.Join(appDir, rel))
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error restoring files: %v", err)
+	}
+
+	worlds := filepath.Join(appDir, worldsDir)
+	if err := os.RemoveAll(worlds); err != nil {
+		return fmt.Errorf("error removing upgraded worlds: %v", err)
+	}
+	if err := copyDir(filepath.Join(b.dir, worldsDir), worlds); err != nil {
+		return fmt.Errorf("error restoring worlds: %v", err)
+	}
+	return nil
+}
+
+// pruneBackups removes all but the newest keep backups in dir
+func pruneBackups(dir string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), backupPrefix) {
+			names = append(names, entry.Name())
+		}
+	}
+	// Names end in a sortable timestamp
+	sort.Slice(names, func(i, j int) bool { return backupTime(names[i]) > backupTime(names[j]) })
+	for i := keep; i < len(names); i++ {
+		os.RemoveAll(filepath.Join(dir, names[i]))
+	}
+}
+
+func backupTime(name string) string {
+	return name[strings.LastIndexByte(name, '-')+1:]
+}
+
+func copyDir(src, dest string) error {
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dest, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		return copyFile(path, target)
+	})
+	if os.IsNotExist(err) {
+		return nil // Nothing to copy
+	}
+	return err
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
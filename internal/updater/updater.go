@@ -0,0 +1,458 @@
+// Package updater upgrades the Bedrock server when a new version is published,
+// rolling back when the new version doesn't start
+package updater
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/downloader"
+	"github.com/jsandas/bedrock-server/internal/events"
+)
+
+// Defaults for unset options
+const (
+	DefaultInterval     = 6 * time.Hour
+	DefaultReadyTimeout = 5 * time.Minute
+	DefaultKeepBackups  = 3
+	pollInterval        = time.Minute // How often a pending update checks whether it can run
+	warnDelay           = time.Minute // Notice given to players before updating in the window
+	backupPrefix        = "update-"
+)
+
+var versionPattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)*$`)
+
+// Process is the supervised server the updater stops and starts
+type Process interface {
+	Stop(timeout time.Duration) error
+	Start() error
+	StartTrial() error
+	Commit()
+	Running() bool
+	Exclusive(fn func() error) error // Runs fn without other restarts interleaving
+}
+
+// Options configure an Updater
+type Options struct {
+	AppDir       string
+	BackupDir    string            // Where backups are kept, defaults to <AppDir>/backups
+	KeepBackups  int               // Backups kept, defaults to DefaultKeepBackups
+	LinksURL     string            // Download links API, defaults to downloader.DefaultLinksURL
+	Channel      string            // Release channel to follow, defaults to downloader.ChannelRelease
+	DownloadType string            // Download type to follow, defaults to the type of the channel
+	Sources      string            // Comma separated mirrors server zips are downloaded from, defaults to downloader.DefaultBaseURL
+	Cache        *downloader.Cache // Keeps downloads for switching versions, optional
+	FetchTimeout time.Duration     // Limit for each download, 0 for none
+	Interval     time.Duration     // How often to check for a new version
+	Window       string            // Maintenance window "HH:MM-HH:MM" updates may run in with players online
+	ReadyTimeout time.Duration     // How long the new version has to start
+	StopTimeout  time.Duration     // How long to wait for the server to stop
+
+	Process Process
+	Players func() int                               // Number of players online
+	Ready   func() bool                              // Reports whether the server finished starting
+	Send    func(command string)                     // Sends a console command to the server
+	Emit    func(event events.Event)                 // Raises backup and update events
+	Log     func(format string, args ...interface{}) // Reports progress in the console stream
+}
+
+// Updater checks for new versions and installs them
+type Updater struct {
+	options Options
+	window  *window
+	now     func() time.Time
+	sleep   func(d time.Duration) bool // Returns false when stopped
+
+	mu      sync.Mutex // Only one update runs at a time
+	ctx     context.Context
+	cancel  context.CancelFunc // Aborts version checks and downloads when stopped
+	stop    chan struct{}
+	done    chan struct{}
+	stopped sync.Once
+}
+
+// New validates the options and creates an updater
+func New(options Options) (*Updater, error) {
+	if options.BackupDir == "" {
+		options.BackupDir = filepath.Join(options.AppDir, "backups")
+	}
+	if options.KeepBackups <= 0 {
+		options.KeepBackups = DefaultKeepBackups
+	}
+	if options.DownloadType == "" {
+		options.DownloadType = downloader.ChannelType(options.Channel)
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultInterval
+	}
+	if options.ReadyTimeout <= 0 {
+		options.ReadyTimeout = DefaultReadyTimeout
+	}
+
+	u := &Updater{
+		options: options,
+		now:     time.Now,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	u.ctx, u.cancel = context.WithCancel(context.Background())
+	u.sleep = u.sleepUntilStopped
+	if options.Window != "" {
+		w, err := parseWindow(options.Window)
+		if err != nil {
+			return nil, err
+		}
+		u.window = &w
+	}
+	return u, nil
+}
+
+// Start checks for updates in the background until Stop is called
+func (u *Updater) Start() {
+	go u.run()
+}
+
+// Stop stops the background checks
+func (u *Updater) Stop() {
+	u.stopped.Do(func() {
+		u.cancel()
+		close(u.stop)
+	})
+	<-u.done
+}
+
+func (u *Updater) run() {
+	defer close(u.done)
+	for {
+		if err := u.Check(); err != nil {
+			u.options.Log("Update check failed: %v", err)
+		}
+		if !u.sleep(u.options.Interval) {
+			return
+		}
+	}
+}
+
+// Check installs the latest version if it is newer than the installed one,
+// waiting until the server is empty or the maintenance window opens. A
+// pinned version is kept.
+func (u *Updater) Check() error {
+	if pinned := downloader.PinnedVersion(u.options.AppDir); pinned != "" {
+		u.options.Log("Skipping update check, version %s is pinned", pinned)
+		return nil
+	}
+	installed := downloader.InstalledVersion(u.options.AppDir)
+	if installed == "" {
+		return fmt.Errorf("installed version unknown, set MINECRAFT_VER to install a known version")
+	}
+	latest, _, err := downloader.LatestVersion(u.ctx, u.options.LinksURL, u.options.DownloadType)
+	if err != nil {
+		return err
+	}
+	if downloader.CompareVersions(latest, installed) <= 0 {
+		return nil
+	}
+
+	u.options.Log("Bedrock server %s is available (installed %s), downloading", latest, installed)
+	zipPath, cleanup, err := u.fetch(latest)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if !u.waitForMaintenance(latest) {
+		return nil
+	}
+
+	// The version may have been switched while waiting
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if pinned := downloader.PinnedVersion(u.options.AppDir); pinned != "" {
+		u.options.Log("Skipping update to %s, version %s is pinned", latest, pinned)
+		return nil
+	}
+	if downloader.CompareVersions(latest, downloader.InstalledVersion(u.options.AppDir)) <= 0 {
+		return nil
+	}
+	return u.update(latest, zipPath)
+}
+
+// fetch downloads a version, into the cache when there is one, logging the
+// progress
+func (u *Updater) fetch(version string) (string, func(), error) {
+	options := downloader.FetchOptions{
+		Sources: u.options.Sources,
+		Channel: u.options.Channel,
+		Timeout: u.options.FetchTimeout,
+		Progress: func(p downloader.Progress) {
+			if p.State == downloader.StateDownloading {
+				u.options.Log("Downloading %s", p)
+			}
+		},
+	}
+	if u.options.Cache != nil {
+		path, err := u.options.Cache.Fetch(u.ctx, version, options)
+		return path, func() {}, err
+	}
+	path, err := downloader.FetchServer(u.ctx, version, options)
+	if err != nil {
+		return "", nil, err
+	}
+	return path, func() { os.Remove(path) }, nil
+}
+
+// Versions lists the installed and cached versions
+func (u *Updater) Versions() (downloader.Versions, error) {
+	versions := downloader.Versions{
+		Channel:   downloader.InstalledChannel(u.options.AppDir),
+		Installed: downloader.InstalledVersion(u.options.AppDir),
+		Previous:  downloader.PreviousVersion(u.options.AppDir),
+		Pinned:    downloader.PinnedVersion(u.options.AppDir),
+		Cached:    []downloader.CachedVersion{},
+	}
+	if u.options.Cache != nil {
+		cached, err := u.options.Cache.List()
+		if err != nil {
+			return downloader.Versions{}, err
+		}
+		versions.Cached = cached
+	}
+	return versions, nil
+}
+
+// Switch installs a version right away, from the cache when it is there,
+// and pins it so it isn't replaced on restart or by automatic updates
+func (u *Updater) Switch(version string) error {
+	if !versionPattern.MatchString(version) {
+		return fmt.Errorf("invalid version %q", version)
+	}
+	if version == downloader.InstalledVersion(u.options.AppDir) {
+		return fmt.Errorf("version %s is already installed", version)
+	}
+
+	zipPath, cleanup, err := u.fetch(version)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.update(version, zipPath); err != nil {
+		return err
+	}
+	return downloader.PinVersion(u.options.AppDir, version)
+}
+
+// Rollback switches back to the version installed before the current one,
+// pinning it
+func (u *Updater) Rollback() error {
+	previous := downloader.PreviousVersion(u.options.AppDir)
+	if previous == "" {
+		return fmt.Errorf("no previous version to roll back to")
+	}
+	return u.Switch(previous)
+}
+
+// Unpin lets MINECRAFT_VER and automatic updates replace the installed
+// version again
+func (u *Updater) Unpin() error {
+	return downloader.UnpinVersion(u.options.AppDir)
+}
+
+// waitForMaintenance waits until the server is empty or the maintenance
+// window is open, returning false if the updater was stopped
+func (u *Updater) waitForMaintenance(version string) bool {
+	logged := false
+	for {
+		players := u.options.Players()
+		if players == 0 {
+			return true
+		}
+		if u.window != nil && u.window.contains(u.now()) {
+			u.options.Send(fmt.Sprintf("say Server updating to %s in 1 minute", version))
+			return u.sleep(warnDelay)
+		}
+		if !logged {
+			u.options.Log("Update to %s waiting for %d players to leave", version, players)
+			logged = true
+		}
+		if !u.sleep(pollInterval) {
+			return false
+		}
+	}
+}
+
+// Update stops the server, backs it up, installs the downloaded zip and
+// starts the new version, restoring the backup if it fails to start
+func (u *Updater) Update(version, zipPath string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.update(version, zipPath)
+}
+
+// update runs an update while holding mu, excluding other restarts of the
+// process
+func (u *Updater) update(version, zipPath string) error {
+	return u.options.Process.Exclusive(func() error { return u.install(version, zipPath) })
+}
+
+// install replaces the installed version. The installed version is read
+// here as it may have changed while the update waited.
+func (u *Updater) install(version, zipPath string) error {
+	installed := downloader.InstalledVersion(u.options.AppDir)
+	if version == installed {
+		return fmt.Errorf("version %s is already installed", version)
+	}
+
+	files, err := downloader.ZipFiles(zipPath)
+	if err != nil {
+		return err
+	}
+	// Rewritten by the install
+	files = append(files, downloader.VersionFile, downloader.PreviousVersionFile)
+
+	if u.options.Process.Running() {
+		u.options.Log("Stopping server to install %s", version)
+		if err := u.options.Process.Stop(u.options.StopTimeout); err != nil {
+			return fmt.Errorf("error stopping server: %v", err)
+		}
+	}
+
+	name := fmt.Sprintf("%s%s-%s", backupPrefix, installed, u.now().UTC().Format("20060102150405"))
+	b, err := createBackup(u.options.AppDir, filepath.Join(u.options.BackupDir, name), files)
+	if err != nil {
+		u.emit(events.BackupFailed, fmt.Sprintf("Backup before updating to %s failed: %v", version, err))
+		if startErr := u.start(); startErr != nil {
+			return fmt.Errorf("%v, and restarting the server failed: %v", err, startErr)
+		}
+		return err
+	}
+	u.emit(events.BackupFinished, "Backed up server "+installed+" to "+name)
+	pruneBackups(u.options.BackupDir, u.options.KeepBackups)
+
+	if err := downloader.InstallServer(zipPath, version, u.options.AppDir, true); err != nil {
+		return u.rollback(b, fmt.Errorf("error installing %s: %v", version, err))
+	}
+
+	u.emit(events.ServerStarting, "starting "+version)
+	if err := u.options.Process.StartTrial(); err != nil {
+		return u.rollback(b, fmt.Errorf("error starting %s: %v", version, err))
+	}
+	if !u.waitReady() {
+		u.options.Process.Stop(u.options.StopTimeout)
+		return u.rollback(b, fmt.Errorf("%s did not start within %v", version, u.options.ReadyTimeout))
+	}
+	u.options.Process.Commit()
+	if u.options.Cache != nil {
+		u.options.Cache.Prune(version, installed)
+	}
+
+	u.emit(events.UpdateInstalled, "Updated Bedrock server from "+installed+" to "+version)
+	return nil
+}
+
+// waitReady waits for the new version to report it started
+func (u *Updater) waitReady() bool {
+	deadline := u.now().Add(u.options.ReadyTimeout)
+	for u.now().Before(deadline) {
+		if u.options.Ready() {
+			return true
+		}
+		if !u.options.Process.Running() {
+			return false // Crashed while starting
+		}
+		if !u.sleep(time.Second) {
+			return false
+		}
+	}
+	return false
+}
+
+// rollback restores the backup and starts the previous version again,
+// returning cause, or why the server is left stopped if that fails too
+func (u *Updater) rollback(b *backup, cause error) error {
+	u.options.Log("Update failed, rolling back: %v", cause)
+	if err := b.restore(u.options.AppDir); err != nil {
+		u.options.Log("Rollback failed: %v", err)
+		return fmt.Errorf("%v, and the rollback failed: %v", cause, err)
+	}
+	if err := u.start(); err != nil {
+		return fmt.Errorf("%v, and starting the previous version failed: %v", cause, err)
+	}
+	return cause
+}
+
+func (u *Updater) start() error {
+	u.emit(events.ServerStarting, "")
+	if err := u.options.Process.Start(); err != nil {
+		u.options.Log("Error starting server: %v", err)
+		return err
+	}
+	return nil
+}
+
+func (u *Updater) emit(t events.Type, message string) {
+	if message != "" {
+		u.options.Log("%s", message)
+	}
+	u.options.Emit(events.Event{Type: t, Message: message})
+}
+
+func (u *Updater) sleepUntilStopped(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-u.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// window is a daily time range, possibly spanning midnight
+type window struct {
+	start, end int // Minutes after midnight
+}
+
+// parseWindow parses "HH:MM-HH:MM"
+func parseWindow(s string) (window, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return window{}, fmt.Errorf("invalid maintenance window %q: expected HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return window{}, fmt.Errorf("invalid maintenance window %q: %v", s, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return window{}, fmt.Errorf("invalid maintenance window %q: %v", s, err)
+	}
+	return window{start: start, end: end}, nil
+}
+
+func parseClock(s string) (int, error) {
+	hour, minute, ok := strings.Cut(strings.TrimSpace(s), ":")
+	h, herr := strconv.Atoi(hour)
+	m, merr := strconv.Atoi(minute)
+	if !ok || herr != nil || merr != nil || h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+func (w window) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end // Spans midnight
+}
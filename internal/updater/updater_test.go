@@ -0,0 +1,409 @@
+package updater
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/downloader"
+	"github.com/jsandas/bedrock-server/internal/events"
+)
+
+// fakeProcess records how the updater drives the server
+type fakeProcess struct {
+	running  bool
+	calls    []string
+	startErr error // Returned by Start
+}
+
+func (p *fakeProcess) Stop(time.Duration) error {
+	p.calls = append(p.calls, "stop")
+	p.running = false
+	return nil
+}
+
+func (p *fakeProcess) Start() error {
+	p.calls = append(p.calls, "start")
+	if p.startErr != nil {
+		return p.startErr
+	}
+	p.running = true
+	return nil
+}
+
+func (p *fakeProcess) StartTrial() error {
+	p.calls = append(p.calls, "trial")
+	p.running = true
+	return nil
+}
+
+func (p *fakeProcess) Commit()       { p.calls = append(p.calls, "commit") }
+func (p *fakeProcess) Running() bool { return p.running }
+
+func (p *fakeProcess) Exclusive(fn func() error) error { return fn() }
+
+// newRelease serves the links API listing version and its server zip
+func newRelease(t *testing.T, version string, files map[string]string) *httptest.Server {
+	t.Helper()
+	var zipData bytes.Buffer
+	w := zip.NewWriter(&zipData)
+	for name, content := range files {
+		f, _ := w.Create(name)
+		f.Write([]byte(content))
+	}
+	w.Close()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/links":
+			fmt.Fprintf(rw, `{"result":{"links":[{"downloadType":"serverBedrockLinux","downloadUrl":"https://example.com/bedrock-server-%s.zip"}]}}`, version)
+		case "/bedrock-server-" + version + ".zip":
+			rw.Write(zipData.Bytes())
+		default:
+			http.NotFound(rw, r)
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+type testUpdate struct {
+	updater *Updater
+	process *fakeProcess
+	appDir  string
+	events  []events.Type
+	logs    []string
+}
+
+func newTestUpdate(t *testing.T, release *httptest.Server, ready func(appDir string) bool) *testUpdate {
+	t.Helper()
+	tu := &testUpdate{process: &fakeProcess{running: true}, appDir: t.TempDir()}
+
+	// The installed release with a customised configuration and a world
+	installed := map[string]string{
+		downloader.VersionFile:   "1.21.0.1\n",
+		"bedrock_server":         "old binary",
+		"server.properties":      "server-name=Ours\n",
+		"worlds/world/level.dat": "old world",
+	}
+	for name, content := range installed {
+		path := filepath.Join(tu.appDir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u, err := New(Options{
+		AppDir:   tu.appDir,
+		LinksURL: release.URL + "/links",
+		Sources:  release.URL,
+		Process:  tu.process,
+		Players:  func() int { return 0 },
+		Ready:    func() bool { return ready(tu.appDir) },
+		Send:     func(string) {},
+		Emit:     func(e events.Event) { tu.events = append(tu.events, e.Type) },
+		Log: func(format string, args ...interface{}) {
+			tu.logs = append(tu.logs, fmt.Sprintf(format, args...))
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create updater: %v", err)
+	}
+	// Sleeping advances a fake clock
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	u.now = func() time.Time { return now }
+	u.sleep = func(d time.Duration) bool {
+		now = now.Add(d)
+		return true
+	}
+	tu.updater = u
+	return tu
+}
+
+func (tu *testUpdate) read(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(tu.appDir, name))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+var newFiles = map[string]string{
+	"bedrock_server":    "new binary",
+	"server.properties": "server-name=Dedicated Server\n",
+	"release-notes.txt": "new file",
+}
+
+func TestUpdateInstallsNewVersion(t *testing.T) {
+	release := newRelease(t, "1.21.1.1", newFiles)
+	tu := newTestUpdate(t, release, func(string) bool { return true })
+
+	if err := tu.updater.Check(); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	if got := strings.Join(tu.process.calls, ","); got != "stop,trial,commit" {
+		t.Errorf("Expected stop,trial,commit, got %s", got)
+	}
+	if v := downloader.InstalledVersion(tu.appDir); v != "1.21.1.1" {
+		t.Errorf("Expected version 1.21.1.1 installed, got %q", v)
+	}
+	if got := tu.read(t, "bedrock_server"); got != "new binary" {
+		t.Errorf("Expected the new binary, got %q", got)
+	}
+	// The configuration is preserved
+	if got := tu.read(t, "server.properties"); got != "server-name=Ours\n" {
+		t.Errorf("Expected server.properties preserved, got %q", got)
+	}
+	want := []events.Type{events.BackupFinished, events.ServerStarting, events.UpdateInstalled}
+	if fmt.Sprint(tu.events) != fmt.Sprint(want) {
+		t.Errorf("Expected events %v, got %v", want, tu.events)
+	}
+
+	backups, _ := os.ReadDir(filepath.Join(tu.appDir, "backups"))
+	if len(backups) != 1 || !strings.HasPrefix(backups[0].Name(), "update-1.21.0.1-") {
+		t.Fatalf("Expected one backup of 1.21.0.1, got %v", backups)
+	}
+	world := filepath.Join(tu.appDir, "backups", backups[0].Name(), "worlds", "world", "level.dat")
+	if _, err := os.Stat(world); err != nil {
+		t.Errorf("Expected the world backed up: %v", err)
+	}
+}
+
+func TestUpdateRollsBackWhenNotReady(t *testing.T) {
+	release := newRelease(t, "1.21.1.1", newFiles)
+	// The new version never reports it started
+	tu := newTestUpdate(t, release, func(appDir string) bool {
+		return downloader.InstalledVersion(appDir) != "1.21.1.1"
+	})
+	tu.updater.options.ReadyTimeout = time.Minute
+
+	if err := tu.updater.Check(); err == nil {
+		t.Fatal("Expected the update to fail")
+	}
+
+	if got := strings.Join(tu.process.calls, ","); got != "stop,trial,stop,start" {
+		t.Errorf("Expected stop,trial,stop,start, got %s", got)
+	}
+	if v := downloader.InstalledVersion(tu.appDir); v != "1.21.0.1" {
+		t.Errorf("Expected version 1.21.0.1 restored, got %q", v)
+	}
+	if got := tu.read(t, "bedrock_server"); got != "old binary" {
+		t.Errorf("Expected the old binary restored, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(tu.appDir, "release-notes.txt")); !os.IsNotExist(err) {
+		t.Error("Expected files added by the update removed")
+	}
+	if got := tu.read(t, "worlds/world/level.dat"); got != "old world" {
+		t.Errorf("Expected the world restored, got %q", got)
+	}
+	if !strings.Contains(strings.Join(tu.logs, "\n"), "rolling back") {
+		t.Errorf("Expected the rollback logged, got %q", tu.logs)
+	}
+}
+
+func TestUpdateReportsFailedRollback(t *testing.T) {
+	release := newRelease(t, "1.21.1.1", newFiles)
+	tu := newTestUpdate(t, release, func(appDir string) bool {
+		return downloader.InstalledVersion(appDir) != "1.21.1.1"
+	})
+	tu.updater.options.ReadyTimeout = time.Minute
+	tu.process.startErr = errors.New("exec format error")
+
+	// The error reaches the supervisor, which ends so the wrapper exits
+	err := tu.updater.Check()
+	if err == nil || !strings.Contains(err.Error(), "starting the previous version failed: exec format error") {
+		t.Fatalf("Expected the failed restart reported, got %v", err)
+	}
+	if tu.process.running {
+		t.Error("Expected the server left stopped")
+	}
+}
+
+func TestUpdateUpToDate(t *testing.T) {
+	release := newRelease(t, "1.21.0.1", newFiles)
+	tu := newTestUpdate(t, release, func(string) bool { return true })
+
+	if err := tu.updater.Check(); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(tu.process.calls) != 0 {
+		t.Errorf("Expected the server left alone, got %v", tu.process.calls)
+	}
+}
+
+func TestPinnedVersionSkipsUpdates(t *testing.T) {
+	release := newRelease(t, "1.21.1.1", newFiles)
+	tu := newTestUpdate(t, release, func(string) bool { return true })
+	if err := downloader.PinVersion(tu.appDir, "1.21.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tu.updater.Check(); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if len(tu.process.calls) != 0 {
+		t.Errorf("Expected the pinned version kept, got %v", tu.process.calls)
+	}
+
+	if err := tu.updater.Unpin(); err != nil {
+		t.Fatalf("Unpin failed: %v", err)
+	}
+	if err := tu.updater.Check(); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if v := downloader.InstalledVersion(tu.appDir); v != "1.21.1.1" {
+		t.Errorf("Expected the update installed once unpinned, got %q", v)
+	}
+}
+
+func TestUpdateWaitsForPlayers(t *testing.T) {
+	release := newRelease(t, "1.21.1.1", newFiles)
+	tu := newTestUpdate(t, release, func(string) bool { return true })
+
+	// Players leave after a few polls
+	polls := 0
+	tu.updater.options.Players = func() int {
+		polls++
+		if polls < 3 {
+			return 2
+		}
+		return 0
+	}
+	if err := tu.updater.Check(); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if polls != 3 || len(tu.process.calls) == 0 {
+		t.Errorf("Expected the update after players left, polled %d times", polls)
+	}
+}
+
+func TestUpdateRereadsInstalledVersion(t *testing.T) {
+	release := newRelease(t, "1.21.1.1", newFiles)
+	tu := newTestUpdate(t, release, func(string) bool { return true })
+
+	// Another version is switched to while the update waits for players
+	polls := 0
+	tu.updater.options.Players = func() int {
+		polls++
+		if polls == 1 {
+			os.WriteFile(filepath.Join(tu.appDir, downloader.VersionFile), []byte("1.21.0.5\n"), 0644)
+			return 1
+		}
+		return 0
+	}
+	if err := tu.updater.Check(); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if v := downloader.PreviousVersion(tu.appDir); v != "1.21.0.5" {
+		t.Errorf("Expected previous version 1.21.0.5, got %q", v)
+	}
+	backups, _ := os.ReadDir(filepath.Join(tu.appDir, "backups"))
+	if len(backups) != 1 || !strings.HasPrefix(backups[0].Name(), backupPrefix+"1.21.0.5-") {
+		t.Errorf("Expected the backup labelled 1.21.0.5, got %v", backups)
+	}
+}
+
+func TestMaintenanceWindow(t *testing.T) {
+	w, err := parseWindow("23:30-02:00")
+	if err != nil {
+		t.Fatalf("Failed to parse window: %v", err)
+	}
+	at := func(h, m int) time.Time { return time.Date(2024, 1, 1, h, m, 0, 0, time.UTC) }
+	tests := []struct {
+		t    time.Time
+		want bool
+	}{
+		{at(23, 45), true},
+		{at(1, 59), true},
+		{at(2, 0), false},
+		{at(12, 0), false},
+	}
+	for _, tt := range tests {
+		if got := w.contains(tt.t); got != tt.want {
+			t.Errorf("contains(%v) = %v, expected %v", tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+	for _, invalid := range []string{"23:30", "25:00-01:00", "a-b"} {
+		if _, err := parseWindow(invalid); err == nil {
+			t.Errorf("Expected %q rejected", invalid)
+		}
+	}
+}
+
+func TestSwitchAndRollbackFromCache(t *testing.T) {
+	release := newRelease(t, "1.21.1.1", newFiles)
+	tu := newTestUpdate(t, release, func(string) bool { return true })
+	cache := downloader.NewCache(t.TempDir(), 0)
+	tu.updater.options.Cache = cache
+
+	// The installed version is cached so it can be rolled back to offline
+	zipData, err := os.ReadFile(filepath.Join(tu.appDir, "bedrock_server"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeZip(t, cache.Path("1.21.0.1"), map[string]string{"bedrock_server": string(zipData)})
+
+	if err := tu.updater.Switch("1.21.1.1"); err != nil {
+		t.Fatalf("Switch failed: %v", err)
+	}
+	if v := downloader.PreviousVersion(tu.appDir); v != "1.21.0.1" {
+		t.Errorf("Expected previous version 1.21.0.1, got %q", v)
+	}
+
+	release.Close()
+	if err := tu.updater.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if v := downloader.InstalledVersion(tu.appDir); v != "1.21.0.1" {
+		t.Errorf("Expected version 1.21.0.1 installed, got %q", v)
+	}
+	if got := tu.read(t, "bedrock_server"); got != "old binary" {
+		t.Errorf("Expected the old binary, got %q", got)
+	}
+
+	versions, err := tu.updater.Versions()
+	if err != nil {
+		t.Fatalf("Versions failed: %v", err)
+	}
+	if versions.Previous != "1.21.1.1" || len(versions.Cached) != 2 {
+		t.Errorf("Expected 1.21.1.1 previous and two cached versions, got %+v", versions)
+	}
+	if versions.Pinned != "1.21.0.1" {
+		t.Errorf("Expected the rolled back version pinned, got %q", versions.Pinned)
+	}
+
+	if err := tu.updater.Switch("../1.0"); err == nil {
+		t.Error("Expected an invalid version rejected")
+	}
+	if err := tu.updater.Switch("1.22.0.1"); err == nil {
+		t.Error("Expected an uncached version to fail while offline")
+	}
+}
+
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		entry, _ := w.Create(name)
+		entry.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,185 @@
+// Package watchdog restarts the server when its memory use grows too large,
+// since Bedrock leaks memory on long running worlds
+package watchdog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/restart"
+)
+
+// Defaults for unset options
+const (
+	DefaultInterval = 30 * time.Second
+	DefaultDelay    = 5 * time.Minute
+)
+
+// NoDelay restarts the server as soon as it is over the limit, a zero Delay
+// means DefaultDelay
+const NoDelay time.Duration = -1
+
+// Options configure a Watchdog
+type Options struct {
+	Limit    int64         // Resident memory in bytes that triggers a restart
+	Warn     int64         // Resident memory in bytes that logs a warning, defaults to 90% of Limit
+	Delay    time.Duration // Notice given to players before restarting, defaults to DefaultDelay, NoDelay for none
+	Interval time.Duration // How often memory use is read, defaults to DefaultInterval
+
+	Pid     func() int                               // Process id of the server, 0 when it isn't running
+	Send    func(command string)                     // Sends a console command to the server
+	Restart func() error                             // Stops and starts the server
+	Log     func(format string, args ...interface{}) // Reports in the console stream
+}
+
+// Watchdog watches the memory use of the server
+type Watchdog struct {
+	options Options
+	rss     func(pid int) (int64, error)
+	sleep   func(d time.Duration) bool // Returns false when stopped
+	warned  bool                       // The warning was logged since memory use was last below it
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New validates the options and creates a watchdog
+func New(options Options) (*Watchdog, error) {
+	if options.Limit <= 0 {
+		return nil, fmt.Errorf("invalid memory limit %d", options.Limit)
+	}
+	if options.Warn <= 0 {
+		options.Warn = options.Limit / 10 * 9
+	}
+	if options.Warn > options.Limit {
+		return nil, fmt.Errorf("memory warning %s is above the limit %s", formatBytes(options.Warn), formatBytes(options.Limit))
+	}
+	switch {
+	case options.Delay == 0:
+		options.Delay = DefaultDelay
+	case options.Delay < 0:
+		options.Delay = 0
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultInterval
+	}
+
+	w := &Watchdog{
+		options: options,
+		rss:     ReadRSS,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	w.sleep = w.sleepUntilStopped
+	return w, nil
+}
+
+// Start watches in the background until Stop is called
+func (w *Watchdog) Start() {
+	go w.run()
+}
+
+// Stop stops watching
+func (w *Watchdog) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *Watchdog) run() {
+	defer close(w.done)
+	for w.sleep(w.options.Interval) && w.Check() {
+	}
+}
+
+// Check reads the memory use of the server once, warning when it is high
+// and restarting the server after notifying players when it is over the
+// limit. It returns false if the watchdog was stopped.
+func (w *Watchdog) Check() bool {
+	pid := w.options.Pid()
+	if pid == 0 {
+		return true
+	}
+	rss, err := w.rss(pid)
+	if err != nil {
+		return true // Exited since the pid was read
+	}
+
+	switch {
+	case rss >= w.options.Limit:
+		w.options.Log("Server memory use %s is over the limit of %s, restarting in %v", formatBytes(rss), formatBytes(w.options.Limit), w.options.Delay)
+		if w.options.Delay > 0 {
+			restart.Warn(w.options.Send, w.options.Delay, "to free memory")
+			if !w.sleep(w.options.Delay) {
+				return false
+			}
+		}
+		if err := w.options.Restart(); err != nil {
+			w.options.Log("Memory watchdog restart failed: %v", err)
+			return true
+		}
+		w.options.Log("Memory watchdog restart complete")
+		w.warned = false
+	case rss >= w.options.Warn:
+		if !w.warned {
+			w.options.Log("Warning: server memory use %s is approaching the limit of %s", formatBytes(rss), formatBytes(w.options.Limit))
+			w.warned = true
+		}
+	default:
+		w.warned = false
+	}
+	return true
+}
+
+func (w *Watchdog) sleepUntilStopped(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-w.stop:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// ReadRSS returns the resident memory of a process in bytes from /proc
+func ReadRSS(pid int) (int64, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	rss, err := parseRSS(f)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %v", f.Name(), err)
+	}
+	return rss, nil
+}
+
+// parseRSS reads the VmRSS line of /proc/<pid>/status, e.g. "VmRSS: 1024 kB"
+func parseRSS(r io.Reader) (int64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), "VmRSS:")
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid VmRSS %q", value)
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no VmRSS")
+}
+
+func formatBytes(n int64) string {
+	return fmt.Sprintf("%d MB", n/(1<<20))
+}
@@ -0,0 +1,203 @@
+package watchdog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mb = 1 << 20
+
+// fakeServer records what a watchdog does
+type fakeServer struct {
+	rss      int64
+	slept    []time.Duration
+	sent     []string
+	logs     []string
+	restarts int
+	fail     error
+}
+
+func newTestWatchdog(t *testing.T, f *fakeServer) *Watchdog {
+	t.Helper()
+	w, err := New(Options{
+		Limit: 1000 * mb,
+		Delay: time.Minute,
+		Pid:   func() int { return 42 },
+		Send:  func(command string) { f.sent = append(f.sent, command) },
+		Restart: func() error {
+			f.restarts++
+			return f.fail
+		},
+		Log: func(format string, args ...interface{}) {
+			f.logs = append(f.logs, fmt.Sprintf(format, args...))
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create watchdog: %v", err)
+	}
+	w.rss = func(pid int) (int64, error) { return f.rss, nil }
+	w.sleep = func(d time.Duration) bool {
+		f.slept = append(f.slept, d)
+		return true
+	}
+	return w
+}
+
+func TestWarnOnce(t *testing.T) {
+	f := &fakeServer{rss: 950 * mb}
+	w := newTestWatchdog(t, f)
+
+	w.Check()
+	w.Check()
+	if len(f.logs) != 1 || !strings.Contains(f.logs[0], "approaching the limit") {
+		t.Fatalf("Expected one warning, got %q", f.logs)
+	}
+
+	f.rss = 100 * mb
+	w.Check()
+	f.rss = 950 * mb
+	w.Check()
+	if len(f.logs) != 2 {
+		t.Errorf("Expected a second warning after memory use dropped, got %q", f.logs)
+	}
+	if f.restarts != 0 || len(f.sent) != 0 {
+		t.Errorf("Expected no restart below the limit, got %d restarts and %q", f.restarts, f.sent)
+	}
+}
+
+func TestRestartOverLimit(t *testing.T) {
+	f := &fakeServer{rss: 1200 * mb}
+	w := newTestWatchdog(t, f)
+
+	if !w.Check() {
+		t.Fatal("Expected the watchdog to keep running")
+	}
+	if f.restarts != 1 {
+		t.Fatalf("Expected one restart, got %d", f.restarts)
+	}
+	if len(f.slept) != 1 || f.slept[0] != time.Minute {
+		t.Errorf("Expected players to get a minute's notice, slept %v", f.slept)
+	}
+	if len(f.sent) == 0 || f.sent[0] != "say Server restarting in 1 minute to free memory" {
+		t.Errorf("Expected players to be warned, got %q", f.sent)
+	}
+	if got := f.logs[len(f.logs)-1]; got != "Memory watchdog restart complete" {
+		t.Errorf("Expected the restart to be logged, got %q", got)
+	}
+}
+
+func TestRestartFailure(t *testing.T) {
+	f := &fakeServer{rss: 1200 * mb, fail: errors.New("timed out")}
+	w := newTestWatchdog(t, f)
+
+	if !w.Check() {
+		t.Fatal("Expected the watchdog to keep running after a failed restart")
+	}
+	if got := f.logs[len(f.logs)-1]; got != "Memory watchdog restart failed: timed out" {
+		t.Errorf("Expected the failure to be logged, got %q", got)
+	}
+}
+
+func TestStoppedDuringNotice(t *testing.T) {
+	f := &fakeServer{rss: 1200 * mb}
+	w := newTestWatchdog(t, f)
+	w.sleep = func(d time.Duration) bool { return false }
+
+	if w.Check() {
+		t.Error("Expected the watchdog to stop")
+	}
+	if f.restarts != 0 {
+		t.Errorf("Expected no restart once stopped, got %d", f.restarts)
+	}
+}
+
+func TestNotRunning(t *testing.T) {
+	f := &fakeServer{rss: 1200 * mb}
+	w := newTestWatchdog(t, f)
+	w.options.Pid = func() int { return 0 }
+
+	w.Check()
+	if f.restarts != 0 || len(f.logs) != 0 {
+		t.Errorf("Expected nothing while the server isn't running, got %d restarts and %q", f.restarts, f.logs)
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	if _, err := New(Options{}); err == nil {
+		t.Error("Expected an error without a limit")
+	}
+	if _, err := New(Options{Limit: 100 * mb, Warn: 200 * mb}); err == nil {
+		t.Error("Expected an error with the warning above the limit")
+	}
+	w, err := New(Options{Limit: 1000 * mb})
+	if err != nil {
+		t.Fatalf("Failed to create watchdog: %v", err)
+	}
+	if w.options.Warn != 900*mb || w.options.Delay != DefaultDelay || w.options.Interval != DefaultInterval {
+		t.Errorf("Expected defaults, got %+v", w.options)
+	}
+}
+
+func TestNoDelay(t *testing.T) {
+	if w, err := New(Options{Limit: 1000 * mb, Delay: NoDelay}); err != nil || w.options.Delay != 0 {
+		t.Fatalf("Expected NoDelay to disable the notice, got %v %v", w, err)
+	}
+
+	f := &fakeServer{rss: 1200 * mb}
+	w := newTestWatchdog(t, f)
+	w.options.Delay = 0 // As set by New for NoDelay
+	w.Check()
+	if f.restarts != 1 || len(f.slept) != 0 || len(f.sent) != 0 {
+		t.Errorf("Expected an immediate restart without notice, got %d restarts, slept %v, sent %q", f.restarts, f.slept, f.sent)
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	w, err := New(Options{Limit: 1000 * mb, Pid: func() int { return 0 }})
+	if err != nil {
+		t.Fatalf("Failed to create watchdog: %v", err)
+	}
+	w.Start()
+	done := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out stopping the watchdog")
+	}
+}
+
+func TestParseRSS(t *testing.T) {
+	status := "Name:\tbedrock_server\nVmPeak:\t 2048 kB\nVmRSS:\t    1536 kB\nThreads:\t12\n"
+	rss, err := parseRSS(strings.NewReader(status))
+	if err != nil {
+		t.Fatalf("Failed to parse status: %v", err)
+	}
+	if rss != 1536*1024 {
+		t.Errorf("Expected %d bytes, got %d", 1536*1024, rss)
+	}
+
+	if _, err := parseRSS(strings.NewReader("Name:\tkthreadd\n")); err == nil {
+		t.Error("Expected an error without VmRSS")
+	}
+}
+
+func TestReadRSS(t *testing.T) {
+	if _, err := os.Stat("/proc/self/status"); err != nil {
+		t.Skip("No /proc")
+	}
+	rss, err := ReadRSS(os.Getpid())
+	if err != nil {
+		t.Fatalf("Failed to read RSS: %v", err)
+	}
+	if rss <= 0 {
+		t.Errorf("Expected a positive RSS, got %d", rss)
+	}
+}
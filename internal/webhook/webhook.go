@@ -0,0 +1,262 @@
+// Package webhook POSTs server and player events to HTTP endpoints
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/events"
+	"github.com/jsandas/bedrock-server/internal/logfile"
+)
+
+// Headers sent with every delivery
+const (
+	HeaderEvent     = "X-Webhook-Event"    // Event type, e.g. player_joined
+	HeaderDelivery  = "X-Webhook-Delivery" // Unique id of the delivery, the same across retries
+	HeaderSignature = "X-Signature-256"    // "sha256=" and the hex HMAC-SHA256 of the body
+)
+
+// Defaults for unset options
+const (
+	DefaultMaxAttempts = 5
+	DefaultBackoff     = time.Second
+	DefaultTimeout     = 10 * time.Second
+	maxBackoff         = time.Minute
+	queueSize          = 1000 // Pending deliveries per endpoint
+)
+
+// Options configure a Dispatcher
+type Options struct {
+	URLs        []string
+	Secret      string        // Key the payloads are signed with, unsigned when empty
+	Events      []events.Type // Event types to send, all when empty
+	MaxAttempts int           // Attempts per delivery before it is dead-lettered
+	Backoff     time.Duration // Wait before the first retry, doubled for each one after
+	Timeout     time.Duration // Timeout of one attempt
+	DeadLetter  string        // JSON lines file recording failed deliveries, disabled when empty
+	Client      *http.Client  // Defaults to a client with Timeout
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	ID    string       `json:"id"`
+	Event events.Event `json:"event"`
+}
+
+// DeadLetter records a delivery that could not be made
+type DeadLetter struct {
+	Time     time.Time `json:"time"`
+	URL      string    `json:"url"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Payload  Payload   `json:"payload"`
+}
+
+// Dispatcher delivers events to every endpoint in order, retrying failed
+// deliveries with exponential backoff. Each endpoint has its own queue so a
+// slow one doesn't hold up the others.
+type Dispatcher struct {
+	options    Options
+	events     map[events.Type]bool
+	endpoints  []*endpoint
+	deadLetter *logfile.File
+
+	mu      sync.Mutex
+	closed  bool
+	workers sync.WaitGroup
+}
+
+type endpoint struct {
+	url   string
+	queue chan Payload
+}
+
+// New creates a dispatcher and starts its delivery workers
+func New(options Options) (*Dispatcher, error) {
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DefaultMaxAttempts
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = DefaultBackoff
+	}
+	if options.Timeout <= 0 {
+		options.Timeout = DefaultTimeout
+	}
+	if options.Client == nil {
+		options.Client = &http.Client{Timeout: options.Timeout}
+	}
+
+	d := &Dispatcher{options: options}
+	if len(options.Events) > 0 {
+		d.events = make(map[events.Type]bool)
+		for _, t := range options.Events {
+			d.events[t] = true
+		}
+	}
+	if options.DeadLetter != "" {
+		var err error
+		d.deadLetter, err = logfile.Open(options.DeadLetter, logfile.Options{MaxSize: 10 * 1024 * 1024, MaxBackups: 3})
+		if err != nil {
+			return nil, fmt.Errorf("error opening dead-letter log: %v", err)
+		}
+	}
+
+	for _, url := range options.URLs {
+		e := &endpoint{url: url, queue: make(chan Payload, queueSize)}
+		d.endpoints = append(d.endpoints, e)
+		d.workers.Add(1)
+		go d.deliver(e)
+	}
+	return d, nil
+}
+
+// Dispatch queues an event for delivery to every endpoint
+func (d *Dispatcher) Dispatch(event events.Event) {
+	if d.events != nil && !d.events[event.Type] {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+	for i, e := range d.endpoints {
+		payload := Payload{ID: deliveryID(event, i), Event: event}
+		select {
+		case e.queue <- payload:
+		default:
+			d.recordDeadLetter(e.url, 0, errors.New("delivery queue full"), payload)
+		}
+	}
+}
+
+// Run dispatches events from c until it is closed, then waits for queued
+// deliveries to finish
+func (d *Dispatcher) Run(c <-chan events.Event) {
+	for event := range c {
+		d.Dispatch(event)
+	}
+	d.Close()
+}
+
+// Close stops accepting events and waits for queued deliveries, including
+// their retries
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, e := range d.endpoints {
+			close(e.queue)
+		}
+	}
+	d.mu.Unlock()
+
+	d.workers.Wait()
+	if d.deadLetter != nil {
+		d.deadLetter.Close()
+	}
+}
+
+func (d *Dispatcher) deliver(e *endpoint) {
+	defer d.workers.Done()
+
+	for payload := range e.queue {
+		body, err := json.Marshal(payload)
+		if err != nil {
+			d.recordDeadLetter(e.url, 0, err, payload)
+			continue
+		}
+
+		backoff := d.options.Backoff
+		for attempt := 1; ; attempt++ {
+			retry, err := d.post(e.url, payload, body)
+			if err == nil {
+				break
+			}
+			if !retry || attempt >= d.options.MaxAttempts {
+				fmt.Printf("Webhook delivery to %s failed after %d attempts: %v\n", e.url, attempt, err)
+				d.recordDeadLetter(e.url, attempt, err, payload)
+				break
+			}
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxBackoff)
+		}
+	}
+}
+
+// post makes one delivery attempt, reporting whether a failure is worth retrying
+func (d *Dispatcher) post(url string, payload Payload, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("error creating request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "bedrock-server-wrapper")
+	req.Header.Set(HeaderEvent, string(payload.Event.Type))
+	req.Header.Set(HeaderDelivery, payload.ID)
+	if d.options.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(d.options.Secret, body))
+	}
+
+	resp, err := d.options.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status %s", resp.Status)
+	default:
+		// The receiver rejected the payload, sending it again won't help
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+func (d *Dispatcher) recordDeadLetter(url string, attempts int, err error, payload Payload) {
+	if d.deadLetter == nil {
+		return
+	}
+	data, _ := json.Marshal(DeadLetter{
+		Time:     time.Now().UTC(),
+		URL:      url,
+		Attempts: attempts,
+		Error:    err.Error(),
+		Payload:  payload,
+	})
+	if _, err := d.deadLetter.Write(append(data, '\n')); err != nil {
+		fmt.Printf("Error writing webhook dead-letter log: %v\n", err)
+	}
+}
+
+// Sign returns the signature header value of a body. Receivers verify it
+// by computing the same HMAC with the shared secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is valid for body
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// deliveryID identifies an event's delivery to one endpoint
+func deliveryID(event events.Event, endpoint int) string {
+	return strconv.FormatInt(event.Time.UnixNano(), 36) + "-" + strconv.FormatUint(event.Seq, 10) + "-" + strconv.Itoa(endpoint)
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jsandas/bedrock-server/internal/events"
+)
+
+// receiver is an httptest endpoint answering with the given statuses in turn
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.bodies = append(rc.bodies, body)
+	rc.headers = append(rc.headers, r.Header.Clone())
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) requests() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.bodies)
+}
+
+func TestDispatchSignedPayload(t *testing.T) {
+	rc := &receiver{}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	d, err := New(Options{URLs: []string{ts.URL}, Secret: "s3cret"})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+	d.Dispatch(events.Event{Seq: 7, Time: time.Now(), Type: events.PlayerJoined, Player: "Steve"})
+	d.Close()
+
+	if rc.requests() != 1 {
+		t.Fatalf("Expected 1 request, got %d", rc.requests())
+	}
+	body, header := rc.bodies[0], rc.headers[0]
+	if !Verify("s3cret", body, header.Get(HeaderSignature)) {
+		t.Errorf("Signature %q does not match the body", header.Get(HeaderSignature))
+	}
+	if header.Get(HeaderEvent) != "player_joined" || header.Get(HeaderDelivery) == "" {
+		t.Errorf("Unexpected headers %v", header)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("Invalid payload: %v", err)
+	}
+	if payload.Event.Player != "Steve" || payload.ID != header.Get(HeaderDelivery) {
+		t.Errorf("Unexpected payload %+v", payload)
+	}
+}
+
+func TestDispatchRetriesWithBackoff(t *testing.T) {
+	rc := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusNoContent}}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	d, err := New(Options{URLs: []string{ts.URL}, Backoff: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+	start := time.Now()
+	d.Dispatch(events.Event{Type: events.ServerStarted})
+	d.Close()
+
+	if rc.requests() != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", rc.requests())
+	}
+	// 10ms then 20ms between attempts
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected retries to back off, took %v", elapsed)
+	}
+	if rc.headers[0].Get(HeaderDelivery) != rc.headers[2].Get(HeaderDelivery) {
+		t.Error("Expected the delivery id to stay the same across retries")
+	}
+}
+
+func TestDispatchDeadLetter(t *testing.T) {
+	failing := &receiver{statuses: []int{500, 500, 500}}
+	rejecting := &receiver{statuses: []int{http.StatusBadRequest}}
+	ts1, ts2 := httptest.NewServer(failing), httptest.NewServer(rejecting)
+	defer ts1.Close()
+	defer ts2.Close()
+
+	path := filepath.Join(t.TempDir(), "dead-letter.log")
+	d, err := New(Options{
+		URLs:        []string{ts1.URL, ts2.URL},
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		DeadLetter:  path,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+	d.Dispatch(events.Event{Type: events.ServerCrashed})
+	d.Close()
+
+	if failing.requests() != 3 {
+		t.Errorf("Expected 3 attempts to the failing endpoint, got %d", failing.requests())
+	}
+	// A rejected payload isn't retried
+	if rejecting.requests() != 1 {
+		t.Errorf("Expected 1 attempt to the rejecting endpoint, got %d", rejecting.requests())
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open dead-letter log: %v", err)
+	}
+	defer f.Close()
+	attempts := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var letter DeadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &letter); err != nil {
+			t.Fatalf("Invalid dead letter %q: %v", scanner.Text(), err)
+		}
+		if letter.Payload.Event.Type != events.ServerCrashed {
+			t.Errorf("Unexpected dead letter payload %+v", letter.Payload)
+		}
+		attempts[letter.URL] = letter.Attempts
+	}
+	if attempts[ts1.URL] != 3 || attempts[ts2.URL] != 1 {
+		t.Errorf("Expected dead letters for both endpoints, got %v", attempts)
+	}
+}
+
+func TestDispatchEventFilter(t *testing.T) {
+	rc := &receiver{}
+	ts := httptest.NewServer(rc)
+	defer ts.Close()
+
+	d, err := New(Options{URLs: []string{ts.URL}, Events: []events.Type{events.ServerCrashed}})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+
+	c := make(chan events.Event, 2)
+	c <- events.Event{Type: events.PlayerJoined}
+	c <- events.Event{Type: events.ServerCrashed}
+	close(c)
+	d.Run(c)
+
+	if rc.requests() != 1 || rc.headers[0].Get(HeaderEvent) != "server_crashed" {
+		t.Errorf("Expected only the crash delivered, got %d requests", rc.requests())
+	}
+}